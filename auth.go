@@ -0,0 +1,374 @@
+package oauth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rapidmidiex/oauth/internal/jose"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// DefaultSessionTTL is the lifetime of the session cookie rewritten by a
+	// SessionUsers created with NewSessionUsers after refreshing its tokens.
+	DefaultSessionTTL = 24 * time.Hour
+
+	// DefaultSessionCacheTTL is how long a SessionUsers created with
+	// NewSessionUsers reuses the user fetched for a session cookie.
+	DefaultSessionCacheTTL = 5 * time.Minute
+)
+
+// SessionUsers resolves the users of the session cookies set by SetSession,
+// for SessionAuth and WebSocketAuth. Users are fetched from the provider once
+// per cookie and cached, so that requests do not each cost a round trip to
+// the provider; concurrent requests with the same cookie wait for the same
+// fetch, and refresh, instead of each starting one. Give both middlewares the
+// same SessionUsers to share its cache:
+//
+//	auth := oauth.NewSessionAuth(provider, "/login")
+//	auth.Sessions.RefreshExpired = true
+//	wsAuth := oauth.NewWebSocketAuth(provider)
+//	wsAuth.Sessions = auth.Sessions
+type SessionUsers struct {
+	// Provider started the sessions and resolves their user.
+	Provider Provider
+	// RefreshExpired refreshes expired tokens with Provider.RefreshToken, and
+	// rewrites the session cookie to last SessionTTL. Tokens count as expired
+	// past the session's ExpiresAt or its ID token's exp, or when the provider
+	// answers FetchUser with a 401 *StatusError.
+	RefreshExpired bool
+	SessionTTL     time.Duration
+	// CacheTTL is how long the user of a session cookie is reused, at most
+	// until its tokens expire. A changed cookie, such as after a refresh, is
+	// fetched again. Zero fetches the user on every request.
+	CacheTTL time.Duration
+	Clock    Clock
+
+	mu       sync.Mutex
+	cache    map[string]cachedSessionUser
+	sweptAt  time.Time
+	fetching map[string]*sessionFetch
+}
+
+// sessionFetch is the fetch of the user of a session cookie in flight, shared
+// by the requests with the same cookie.
+type sessionFetch struct {
+	done   chan struct{}
+	cached cachedSessionUser
+	err    error
+}
+
+// cachedSessionUser is the user of a session cookie, and the session that
+// replaced it if its tokens were refreshed.
+type cachedSessionUser struct {
+	user      User
+	refreshed Session
+	expiresAt time.Time
+}
+
+// NewSessionUsers creates a SessionUsers caching users for
+// DefaultSessionCacheTTL.
+func NewSessionUsers(provider Provider) *SessionUsers {
+	return &SessionUsers{
+		Provider:   provider,
+		SessionTTL: DefaultSessionTTL,
+		CacheTTL:   DefaultSessionCacheTTL,
+	}
+}
+
+// User returns the user of the session cookie of r. When its tokens are
+// refreshed the cookie is rewritten through w.
+func (s *SessionUsers) User(w http.ResponseWriter, r *http.Request) (User, error) {
+	value, err := GetSession(r)
+	if err != nil {
+		return User{}, err
+	}
+	key := hashToken(string(value))
+	now := ClockWithFallBack(s.Clock).Now()
+
+	cached, fetch := s.cached(key, string(value), now)
+	if fetch != nil {
+		select {
+		case <-fetch.done:
+		case <-r.Context().Done():
+			return User{}, r.Context().Err()
+		}
+		if fetch.err != nil {
+			return User{}, fetch.err
+		}
+		cached = fetch.cached
+	}
+
+	if cached.refreshed != nil {
+		// also when another request with the same cookie refreshed it
+		if err := SetSession(w, cached.refreshed, s.SessionTTL); err != nil {
+			return User{}, err
+		}
+	}
+	return cached.user, nil
+}
+
+// cached returns the unexpired cache entry for key, the hash of the session
+// cookie value. Otherwise it returns the fetch of the user in flight, starting
+// one if there is none.
+func (s *SessionUsers) cached(key, value string, now time.Time) (cachedSessionUser, *sessionFetch) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cached, ok := s.cache[key]
+	if ok && now.Before(cached.expiresAt) {
+		return cached, nil
+	}
+	if ok {
+		delete(s.cache, key)
+	}
+	if fetch, ok := s.fetching[key]; ok {
+		return cachedSessionUser{}, fetch
+	}
+
+	if s.fetching == nil {
+		s.fetching = map[string]*sessionFetch{}
+	}
+	fetch := &sessionFetch{done: make(chan struct{})}
+	s.fetching[key] = fetch
+	go s.fetchOnce(key, value, now, fetch)
+	return cachedSessionUser{}, fetch
+}
+
+// fetchOnce fetches the user of the session cookie for the requests waiting
+// on fetch, and caches it. It runs on its own, so that a request giving up
+// does not fail the others.
+func (s *SessionUsers) fetchOnce(key, value string, now time.Time, fetch *sessionFetch) {
+	var cached cachedSessionUser
+	cached.user, cached.refreshed, fetch.err = s.fetch(value, now)
+	if fetch.err == nil {
+		fetch.cached = cached
+		s.store(key, cached, now)
+		if cached.refreshed != nil {
+			if refreshed, err := cached.refreshed.Marshal(); err == nil {
+				s.store(hashToken(refreshed), cachedSessionUser{user: cached.user}, now)
+			}
+		}
+	}
+
+	s.mu.Lock()
+	delete(s.fetching, key)
+	s.mu.Unlock()
+	close(fetch.done)
+}
+
+// fetch fetches the user of a marshalled session. With RefreshExpired, its
+// tokens are refreshed when they expired, and the refreshed session is
+// returned as well.
+func (s *SessionUsers) fetch(value string, now time.Time) (User, Session, error) {
+	sess, err := s.Provider.UnmarshalSession(value)
+	if err != nil {
+		return User{}, nil, err
+	}
+	tokens := sessionTokensOf(value)
+	refresh := s.RefreshExpired && s.Provider.RefreshTokenAvailable() && tokens.RefreshToken != ""
+
+	// other failures, such as the provider being down, are returned as they
+	// are rather than spending the refresh token
+	if !refresh || !tokens.expired(now) {
+		user, err := s.Provider.FetchUser(sess)
+		expired := unauthorized(err) || err == nil && !user.ExpiresAt.IsZero() && !now.Before(user.ExpiresAt)
+		if !refresh || !expired {
+			return user, nil, err
+		}
+	}
+
+	// providers return no user when they fail, so the refresh token is taken
+	// from the session itself
+	token, err := s.Provider.RefreshToken(tokens.RefreshToken)
+	if err != nil {
+		return User{}, nil, err
+	}
+	if token == nil {
+		return User{}, nil, errors.New("oauth: the provider refreshed no token")
+	}
+	if sess, err = refreshedSession(s.Provider, value, token); err != nil {
+		return User{}, nil, err
+	}
+	user, err := s.Provider.FetchUser(sess)
+	if err != nil {
+		return User{}, nil, err
+	}
+	return user, sess, nil
+}
+
+// unauthorized tells whether err is a 401 from the provider.
+func unauthorized(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusUnauthorized
+}
+
+// store caches a user for CacheTTL, or until its tokens expire. Entries of
+// cookies that are not presented again are dropped once per CacheTTL.
+func (s *SessionUsers) store(key string, cached cachedSessionUser, now time.Time) {
+	if s.CacheTTL <= 0 {
+		return
+	}
+	cached.expiresAt = now.Add(s.CacheTTL)
+	if expiresAt := cached.user.ExpiresAt; !expiresAt.IsZero() && expiresAt.Before(cached.expiresAt) {
+		cached.expiresAt = expiresAt
+	}
+	if !now.Before(cached.expiresAt) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cache == nil {
+		s.cache = map[string]cachedSessionUser{}
+	}
+	if now.Sub(s.sweptAt) >= s.CacheTTL {
+		for k, c := range s.cache {
+			if !now.Before(c.expiresAt) {
+				delete(s.cache, k)
+			}
+		}
+		s.sweptAt = now
+	}
+	s.cache[key] = cached
+}
+
+// SessionAuth requires requests to carry the session cookie set by SetSession:
+//
+//	auth := oauth.NewSessionAuth(provider, "/login")
+//	auth.Sessions.RefreshExpired = true
+//	http.Handle("/", auth.Middleware(app))
+//
+// Handlers behind it find the user with UserFromContext.
+type SessionAuth struct {
+	// Sessions resolves the user of the session cookie.
+	Sessions *SessionUsers
+	// LoginURL is where browsers without a session are redirected, with the
+	// URL they requested in the return_to query parameter.
+	LoginURL string
+	// APIPrefixes are the paths answered with a 401 JSON error instead of a
+	// redirect, as are requests accepting JSON but not HTML.
+	APIPrefixes []string
+}
+
+// NewSessionAuth creates a SessionAuth answering paths under /api/ with JSON
+// errors.
+func NewSessionAuth(provider Provider, loginURL string) *SessionAuth {
+	return &SessionAuth{
+		Sessions:    NewSessionUsers(provider),
+		LoginURL:    loginURL,
+		APIPrefixes: []string{"/api/"},
+	}
+}
+
+// Middleware lets requests with a session through to next, which finds the
+// user with UserFromContext. Other requests are redirected to LoginURL, or
+// answered with a 401 JSON error for API requests.
+func (a *SessionAuth) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := a.Sessions.User(w, r)
+		if err != nil {
+			a.unauthorized(w, r)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), user)))
+	})
+}
+
+func (a *SessionAuth) unauthorized(w http.ResponseWriter, r *http.Request) {
+	if a.isAPI(r) || a.LoginURL == "" {
+		writeError(w, &Error{StatusCode: http.StatusUnauthorized, Code: "login_required"})
+		return
+	}
+
+	loginURL, err := url.Parse(a.LoginURL)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	query := loginURL.Query()
+	query.Set("return_to", r.URL.RequestURI())
+	loginURL.RawQuery = query.Encode()
+	http.Redirect(w, r, loginURL.String(), http.StatusFound)
+}
+
+func (a *SessionAuth) isAPI(r *http.Request) bool {
+	for _, prefix := range a.APIPrefixes {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return true
+		}
+	}
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "application/json") && !strings.Contains(accept, "text/html")
+}
+
+// sessionTokens are the token members of a marshalled session.
+type sessionTokens struct {
+	RefreshToken string
+	ExpiresAt    time.Time
+	IDToken      string
+}
+
+// sessionTokensOf returns the token members of a marshalled session, those it
+// has.
+func sessionTokensOf(value string) sessionTokens {
+	var tokens sessionTokens
+	json.Unmarshal([]byte(value), &tokens)
+	return tokens
+}
+
+// expired tells whether the access token or the ID token expired. The ID
+// token is not verified: its exp only decides whether to refresh.
+func (t sessionTokens) expired(now time.Time) bool {
+	if !t.ExpiresAt.IsZero() && !now.Before(t.ExpiresAt) {
+		return true
+	}
+	if t.IDToken == "" {
+		return false
+	}
+	jws, err := jose.Parse(t.IDToken)
+	if err != nil {
+		return false
+	}
+	claims, err := jws.Claims()
+	if err != nil {
+		return false
+	}
+	exp, ok := claims["exp"].(float64)
+	return ok && !now.Before(time.Unix(int64(exp), 0))
+}
+
+// refreshedSession returns the session with the refreshed tokens. Sessions
+// have no setters, so this relies on the AccessToken, RefreshToken, ExpiresAt
+// and, for OpenID Connect, IDToken members that the sessions of the refreshing
+// providers marshal.
+func refreshedSession(provider Provider, value string, token *oauth2.Token) (Session, error) {
+	members := map[string]interface{}{}
+	d := json.NewDecoder(strings.NewReader(value))
+	d.UseNumber()
+	if err := d.Decode(&members); err != nil {
+		return nil, err
+	}
+	members["AccessToken"] = token.AccessToken
+	if token.RefreshToken != "" {
+		members["RefreshToken"] = token.RefreshToken
+	}
+	if !token.Expiry.IsZero() {
+		members["ExpiresAt"] = token.Expiry
+	}
+	if idToken, _ := token.Extra("id_token").(string); idToken != "" {
+		members["IDToken"] = idToken
+	}
+
+	b, err := json.Marshal(members)
+	if err != nil {
+		return nil, err
+	}
+	return provider.UnmarshalSession(string(b))
+}
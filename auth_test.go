@@ -0,0 +1,394 @@
+package oauth_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rapidmidiex/oauth"
+	"github.com/rapidmidiex/oauth/internal/jose"
+	"github.com/rapidmidiex/oauth/providers/faux"
+	"github.com/rapidmidiex/oauth/providers/openidConnect"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+// expiringSession is a session holding tokens that expire, like those of the
+// real providers.
+type expiringSession struct {
+	AuthURL      string
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time
+}
+
+func (s *expiringSession) GetAuthURL() (string, error) { return s.AuthURL, nil }
+
+func (s *expiringSession) Authorize(oauth.Provider, oauth.Params) (string, error) {
+	return s.AccessToken, nil
+}
+
+func (s *expiringSession) Marshal() (string, error) {
+	b, err := json.Marshal(s)
+	return string(b), err
+}
+
+// expiringProvider rejects expired access tokens, returning no user like the
+// real providers, and refreshes them.
+type expiringProvider struct {
+	faux.Provider
+	mu        sync.Mutex
+	now       time.Time
+	fetches   int
+	refreshes int
+	// fail is returned for the access token "access", if set.
+	fail error
+}
+
+func (p *expiringProvider) UnmarshalSession(data string) (oauth.Session, error) {
+	sess := &expiringSession{}
+	err := json.Unmarshal([]byte(data), sess)
+	return sess, err
+}
+
+func (p *expiringProvider) FetchUser(session oauth.Session) (oauth.User, error) {
+	sess := session.(*expiringSession)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.fetches++
+	user := oauth.User{
+		UserID:       "drummer",
+		AccessToken:  sess.AccessToken,
+		RefreshToken: sess.RefreshToken,
+		ExpiresAt:    sess.ExpiresAt,
+	}
+	if !p.now.Before(sess.ExpiresAt) {
+		return oauth.User{}, &oauth.StatusError{StatusCode: http.StatusUnauthorized, Message: "access token expired"}
+	}
+	if p.fail != nil && sess.AccessToken == "access" {
+		return oauth.User{}, p.fail
+	}
+	return user, nil
+}
+
+func (p *expiringProvider) RefreshTokenAvailable() bool { return true }
+
+func (p *expiringProvider) RefreshToken(refreshToken string) (*oauth2.Token, error) {
+	if refreshToken != "refresh" {
+		return nil, errors.New("invalid refresh token")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// leave time for concurrent requests to pile up
+	time.Sleep(10 * time.Millisecond)
+	p.refreshes++
+	return &oauth2.Token{AccessToken: "refreshed", RefreshToken: "refresh", Expiry: p.now.Add(time.Hour)}, nil
+}
+
+func Test_SessionAuth(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	auth := oauth.NewSessionAuth(&faux.Provider{}, "/login?provider=faux")
+	handler := auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := oauth.UserFromContext(r.Context())
+		a.True(ok)
+		a.Equal("drummer", user.UserID)
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/jams", nil)
+	r.AddCookie(sessionCookie(t, &faux.Session{ID: "drummer", AccessToken: "access"}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	a.Equal(http.StatusOK, w.Code)
+
+	// browsers are sent to log in
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/jams/1?tab=mixer", nil))
+	a.Equal(http.StatusFound, w.Code)
+	location, _ := url.Parse(w.Header().Get("Location"))
+	a.Equal("/login", location.Path)
+	a.Equal("faux", location.Query().Get("provider"))
+	a.Equal("/jams/1?tab=mixer", location.Query().Get("return_to"))
+
+	// API clients get a JSON error
+	for _, r := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/api/jams", nil),
+		func() *http.Request {
+			r := httptest.NewRequest(http.MethodGet, "/jams", nil)
+			r.Header.Set("Accept", "application/json")
+			return r
+		}(),
+	} {
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		a.Equal(http.StatusUnauthorized, w.Code)
+		a.JSONEq(`{"error":"login_required"}`, w.Body.String())
+	}
+
+	// a session without a token
+	r = httptest.NewRequest(http.MethodGet, "/api/jams", nil)
+	r.AddCookie(sessionCookie(t, &faux.Session{ID: "drummer"}))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	a.Equal(http.StatusUnauthorized, w.Code)
+}
+
+func Test_SessionAuth_RefreshExpired(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	now := time.Now()
+	provider := &expiringProvider{now: now}
+	auth := oauth.NewSessionAuth(provider, "/login")
+	auth.Sessions.Clock = oauth.ClockFunc(func() time.Time { return now })
+
+	var accessToken string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := oauth.UserFromContext(r.Context())
+		accessToken = user.AccessToken
+	})
+	cookie := sessionCookie(t, &expiringSession{AccessToken: "access", RefreshToken: "refresh", ExpiresAt: now.Add(-time.Minute)})
+
+	// expired tokens are not refreshed by default
+	r := httptest.NewRequest(http.MethodGet, "/api/jams", nil)
+	r.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	auth.Middleware(handler).ServeHTTP(w, r)
+	a.Equal(http.StatusUnauthorized, w.Code)
+
+	auth.Sessions.RefreshExpired = true
+	r = httptest.NewRequest(http.MethodGet, "/api/jams", nil)
+	r.AddCookie(cookie)
+	w = httptest.NewRecorder()
+	auth.Middleware(handler).ServeHTTP(w, r)
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal("refreshed", accessToken)
+	a.Equal(1, provider.refreshes)
+
+	// the refreshed session is stored
+	cookies := w.Result().Cookies()
+	a.Len(cookies, 1)
+	r = httptest.NewRequest(http.MethodGet, "/api/jams", nil)
+	r.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	auth.Middleware(handler).ServeHTTP(w, r)
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal(1, provider.refreshes)
+	a.Empty(w.Result().Cookies())
+
+	// requests still sending the expired cookie get the refreshed one too
+	r = httptest.NewRequest(http.MethodGet, "/api/jams", nil)
+	r.AddCookie(cookie)
+	w = httptest.NewRecorder()
+	auth.Middleware(handler).ServeHTTP(w, r)
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal("refreshed", accessToken)
+	a.Equal(1, provider.refreshes)
+	a.Equal(cookies[0].Value, w.Result().Cookies()[0].Value)
+
+	// a failed refresh is unauthorized
+	r = httptest.NewRequest(http.MethodGet, "/api/jams", nil)
+	r.AddCookie(sessionCookie(t, &expiringSession{AccessToken: "access", RefreshToken: "revoked", ExpiresAt: now.Add(-time.Minute)}))
+	w = httptest.NewRecorder()
+	auth.Middleware(handler).ServeHTTP(w, r)
+	a.Equal(http.StatusUnauthorized, w.Code)
+}
+
+func Test_SessionAuth_RefreshConcurrent(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	now := time.Now()
+	provider := &expiringProvider{now: now}
+	auth := oauth.NewSessionAuth(provider, "/login")
+	auth.Sessions.Clock = oauth.ClockFunc(func() time.Time { return now })
+	auth.Sessions.RefreshExpired = true
+	handler := auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	cookie := sessionCookie(t, &expiringSession{AccessToken: "access", RefreshToken: "refresh", ExpiresAt: now.Add(-time.Minute)})
+
+	var wg sync.WaitGroup
+	results := make([]*httptest.ResponseRecorder, 20)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r := httptest.NewRequest(http.MethodGet, "/api/jams", nil)
+			r.AddCookie(cookie)
+			results[i] = httptest.NewRecorder()
+			handler.ServeHTTP(results[i], r)
+		}(i)
+	}
+	wg.Wait()
+
+	// all requests get the same refreshed session from one refresh
+	for _, w := range results {
+		a.Equal(http.StatusOK, w.Code)
+		a.Equal(results[0].Result().Cookies()[0].Value, w.Result().Cookies()[0].Value)
+	}
+	a.Equal(1, provider.refreshes)
+	a.Equal(1, provider.fetches)
+}
+
+func Test_SessionAuth_RefreshOnlyUnauthorized(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	now := time.Now()
+	provider := &expiringProvider{now: now}
+	auth := oauth.NewSessionAuth(provider, "/login")
+	auth.Sessions.Clock = oauth.ClockFunc(func() time.Time { return now })
+	auth.Sessions.RefreshExpired = true
+	auth.Sessions.CacheTTL = 0
+	handler := auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	request := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/jams", nil)
+		r.AddCookie(sessionCookie(t, &expiringSession{AccessToken: "access", RefreshToken: "refresh", ExpiresAt: now.Add(time.Hour)}))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	// the provider being down does not spend the refresh token
+	provider.fail = &oauth.StatusError{StatusCode: http.StatusServiceUnavailable, Message: "unavailable"}
+	a.Equal(http.StatusUnauthorized, request().Code)
+	provider.fail = errors.New("connection refused")
+	a.Equal(http.StatusUnauthorized, request().Code)
+	a.Equal(0, provider.refreshes)
+
+	// a revoked access token is refreshed
+	provider.fail = &oauth.StatusError{StatusCode: http.StatusUnauthorized, Message: "revoked"}
+	w := request()
+	a.Equal(http.StatusOK, w.Code)
+	a.Len(w.Result().Cookies(), 1)
+	a.Equal(1, provider.refreshes)
+}
+
+func Test_SessionAuth_CachesUser(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	now := time.Now()
+	provider := &expiringProvider{now: now}
+	auth := oauth.NewSessionAuth(provider, "/login")
+	auth.Sessions.Clock = oauth.ClockFunc(func() time.Time { return now })
+	handler := auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	request := func(cookie *http.Cookie) int {
+		r := httptest.NewRequest(http.MethodGet, "/api/jams", nil)
+		r.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	cookie := sessionCookie(t, &expiringSession{AccessToken: "access", ExpiresAt: now.Add(time.Hour)})
+	a.Equal(http.StatusOK, request(cookie))
+	a.Equal(http.StatusOK, request(cookie))
+	a.Equal(1, provider.fetches)
+
+	// until CacheTTL passed
+	now = now.Add(oauth.DefaultSessionCacheTTL)
+	a.Equal(http.StatusOK, request(cookie))
+	a.Equal(2, provider.fetches)
+
+	// or the tokens expired
+	cookie = sessionCookie(t, &expiringSession{AccessToken: "access", ExpiresAt: now.Add(time.Minute)})
+	a.Equal(http.StatusOK, request(cookie))
+	now = now.Add(time.Minute)
+	provider.now = now
+	a.Equal(http.StatusUnauthorized, request(cookie))
+	a.Equal(4, provider.fetches)
+
+	// another cookie is fetched again
+	a.Equal(http.StatusOK, request(sessionCookie(t, &expiringSession{AccessToken: "other", ExpiresAt: now.Add(time.Hour)})))
+	a.Equal(5, provider.fetches)
+
+	auth.Sessions.CacheTTL = 0
+	cookie = sessionCookie(t, &expiringSession{AccessToken: "access", ExpiresAt: now.Add(time.Hour)})
+	a.Equal(http.StatusOK, request(cookie))
+	a.Equal(http.StatusOK, request(cookie))
+	a.Equal(7, provider.fetches)
+}
+
+func Test_SessionAuth_RefreshExpiredIDToken(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	now := time.Now()
+	idToken := func(exp time.Time) string {
+		token, err := jose.Sign(jose.Header{Alg: "HS256"}, map[string]interface{}{
+			"iss": "https://idp.example.com",
+			"aud": "client",
+			"sub": "drummer",
+			"exp": exp.Unix(),
+		}, []byte("secret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	var refreshToken string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		refreshToken = r.PostFormValue("refresh_token")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "refreshed",
+			"token_type":    "Bearer",
+			"refresh_token": "refresh-2",
+			"expires_in":    3600,
+			"id_token":      idToken(now.Add(time.Hour)),
+		})
+	}))
+	defer ts.Close()
+
+	provider, err := openidConnect.NewCustomisedURL("client", "secret", "http://localhost/callback",
+		"https://idp.example.com/auth", ts.URL, "https://idp.example.com", "", "")
+	a.NoError(err)
+	provider.Clock = oauth.ClockFunc(func() time.Time { return now })
+
+	auth := oauth.NewSessionAuth(provider, "/login")
+	auth.Sessions.Clock = provider.Clock
+	auth.Sessions.RefreshExpired = true
+
+	var user oauth.User
+	handler := auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ = oauth.UserFromContext(r.Context())
+	}))
+
+	// the access token is still valid, but the ID token expired
+	r := httptest.NewRequest(http.MethodGet, "/api/jams", nil)
+	r.AddCookie(sessionCookie(t, &openidConnect.Session{
+		AccessToken:  "access",
+		RefreshToken: "refresh-1",
+		ExpiresAt:    now.Add(time.Hour),
+		IDToken:      idToken(now.Add(-time.Hour)),
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal("refresh-1", refreshToken)
+	a.Equal("drummer", user.UserID)
+	a.Equal("refreshed", user.AccessToken)
+
+	// the new ID token is stored
+	cookies := w.Result().Cookies()
+	a.Len(cookies, 2)
+	a.Equal(oauth.SessionName, cookies[0].Name)
+	r = httptest.NewRequest(http.MethodGet, "/api/jams", nil)
+	r.AddCookie(cookies[0])
+	value, err := oauth.GetSession(r)
+	a.NoError(err)
+	sess, err := provider.UnmarshalSession(string(value))
+	a.NoError(err)
+	a.Equal("refresh-2", sess.(*openidConnect.Session).RefreshToken)
+	_, err = provider.FetchUser(sess)
+	a.NoError(err)
+}
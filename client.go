@@ -3,11 +3,13 @@ package oauth
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 )
 
@@ -76,9 +78,46 @@ var SetState = func(r *http.Request) string {
 func GetState(r *http.Request) string {
 	params := r.URL.Query()
 	if params.Encode() == "" && r.Method == http.MethodPost {
-		return r.FormValue("state")
+		if state := r.FormValue("state"); state != "" {
+			return state
+		}
+		return responseState(r.FormValue("response"))
 	}
-	return params.Get("state")
+	if state := params.Get("state"); state != "" {
+		return state
+	}
+	return responseState(params.Get("response"))
+}
+
+// responseState returns the state claim of a JWT secured authorization
+// response (JARM) without verifying it. The provider verifies the response
+// before using anything else from it when the session is authorized.
+func responseState(response string) string {
+	parts := strings.Split(response, ".")
+	if len(parts) != 3 {
+		return ""
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return ""
+	}
+	var claims struct {
+		State string `json:"state"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return ""
+	}
+	return claims.State
+}
+
+// CallbackParams returns the parameters of an authorization callback, taken
+// from the query string or, for response_mode=form_post, from the posted form.
+// Pass them to Session.Authorize.
+func CallbackParams(r *http.Request) (url.Values, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	return r.Form, nil
 }
 
 func ValidateState(r *http.Request, sess Session) error {
@@ -103,15 +142,26 @@ func ValidateState(r *http.Request, sess Session) error {
 
 var SessionName = "_rmx_oauth_session"
 
+// FormPostSessionName is the cookie holding a FormPostSession until the
+// provider posts the authorization response back. Callbacks using
+// response_mode=form_post are cross-site POST requests, which browsers do not
+// send the SameSite=Lax session cookie with.
+var FormPostSessionName = "_rmx_oauth_form_post"
+
+// FormPostSessionTTL is the longest the cookie named FormPostSessionName
+// lasts.
+const FormPostSessionTTL = 10 * time.Minute
+
 func SetSession(w http.ResponseWriter, sess Session, exp time.Duration) error {
 	bs, err := sess.Marshal()
 	if err != nil {
 		return err
 	}
+	value := base64.StdEncoding.EncodeToString([]byte(bs))
 
 	cookie := &http.Cookie{
 		Name:     SessionName,
-		Value:    base64.StdEncoding.EncodeToString([]byte(bs)),
+		Value:    value,
 		Expires:  time.Now().UTC().Add(exp),
 		Secure:   true,
 		HttpOnly: true,
@@ -119,11 +169,57 @@ func SetSession(w http.ResponseWriter, sess Session, exp time.Duration) error {
 	}
 
 	http.SetCookie(w, cookie)
+
+	formPost, ok := sess.(FormPostSession)
+	if !ok {
+		return nil
+	}
+	// once the authorization response arrived, the session must not linger in
+	// the SameSite=None cookie
+	if !formPost.AwaitsFormPost() {
+		expireCookie(w, FormPostSessionName, http.SameSiteNoneMode)
+		return nil
+	}
+	if exp > FormPostSessionTTL {
+		exp = FormPostSessionTTL
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     FormPostSessionName,
+		Value:    value,
+		Expires:  time.Now().UTC().Add(exp),
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteNoneMode,
+	})
 	return nil
 }
 
+// ClearSession expires the session cookies set by SetSession.
+func ClearSession(w http.ResponseWriter) {
+	expireCookie(w, SessionName, http.SameSiteLaxMode)
+	expireCookie(w, FormPostSessionName, http.SameSiteNoneMode)
+}
+
+func expireCookie(w http.ResponseWriter, name string, sameSite http.SameSite) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    "",
+		MaxAge:   -1,
+		Expires:  time.Unix(0, 0),
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: sameSite,
+	})
+}
+
+// GetSession returns the session stored by SetSession. When the browser did
+// not send the session cookie, as on the cross-site POST of a form_post
+// callback, the FormPostSession awaiting it is returned instead.
 func GetSession(r *http.Request) ([]byte, error) {
 	cookie, err := r.Cookie(SessionName)
+	if err == http.ErrNoCookie {
+		cookie, err = r.Cookie(FormPostSessionName)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,104 @@
+package oauth_test
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rapidmidiex/oauth"
+	"github.com/rapidmidiex/oauth/providers/openidConnect"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_GetState(t *testing.T) {
+	a := assert.New(t)
+
+	r := httptest.NewRequest(http.MethodGet, "/callback?code=abc&state=query_state", nil)
+	a.Equal("query_state", oauth.GetState(r))
+
+	r = httptest.NewRequest(http.MethodPost, "/callback", strings.NewReader("code=abc&state=form_state"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	a.Equal("form_state", oauth.GetState(r))
+
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"code":"abc","state":"jwt_state"}`))
+	response := "eyJhbGciOiJSUzI1NiJ9." + payload + ".c2ln"
+
+	r = httptest.NewRequest(http.MethodGet, "/callback?response="+response, nil)
+	a.Equal("jwt_state", oauth.GetState(r))
+
+	r = httptest.NewRequest(http.MethodPost, "/callback", strings.NewReader(url.Values{"response": {response}}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	a.Equal("jwt_state", oauth.GetState(r))
+}
+
+func Test_CallbackParams(t *testing.T) {
+	a := assert.New(t)
+
+	r := httptest.NewRequest(http.MethodPost, "/callback", strings.NewReader("code=abc&state=form_state"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	params, err := oauth.CallbackParams(r)
+	a.NoError(err)
+	a.Equal("abc", params.Get("code"))
+	a.Equal("form_state", params.Get("state"))
+
+	r = httptest.NewRequest(http.MethodGet, "/callback?code=def", nil)
+	params, err = oauth.CallbackParams(r)
+	a.NoError(err)
+	a.Equal("def", params.Get("code"))
+}
+
+func Test_ClearSession(t *testing.T) {
+	a := assert.New(t)
+
+	w := httptest.NewRecorder()
+	oauth.ClearSession(w)
+	cookies := w.Result().Cookies()
+	a.Len(cookies, 2)
+	a.Equal(oauth.SessionName, cookies[0].Name)
+	a.Equal(oauth.FormPostSessionName, cookies[1].Name)
+	for _, cookie := range cookies {
+		a.Equal(-1, cookie.MaxAge)
+	}
+}
+
+func Test_SetSession_FormPost(t *testing.T) {
+	a := assert.New(t)
+
+	pending := &openidConnect.Session{AuthURL: "https://idp.example.com/auth", ResponseMode: "form_post"}
+	w := httptest.NewRecorder()
+	a.NoError(oauth.SetSession(w, pending, time.Hour))
+	cookies := w.Result().Cookies()
+	a.Len(cookies, 2)
+	a.Equal(oauth.SessionName, cookies[0].Name)
+	a.Equal(http.SameSiteLaxMode, cookies[0].SameSite)
+	a.Equal(oauth.FormPostSessionName, cookies[1].Name)
+	a.Equal(http.SameSiteNoneMode, cookies[1].SameSite)
+	a.True(cookies[1].Secure)
+	a.WithinDuration(time.Now().Add(oauth.FormPostSessionTTL), cookies[1].Expires, time.Minute)
+
+	// the cross-site POST of the callback only carries the form_post cookie
+	r := httptest.NewRequest(http.MethodPost, "/callback", nil)
+	r.AddCookie(cookies[1])
+	value, err := oauth.GetSession(r)
+	a.NoError(err)
+	a.Contains(string(value), "form_post")
+
+	// authorized sessions stay SameSite=Lax, and the form_post cookie expires
+	pending.AccessToken = "at"
+	w = httptest.NewRecorder()
+	a.NoError(oauth.SetSession(w, pending, time.Hour))
+	a.Len(w.Result().Cookies(), 2)
+	a.Equal(oauth.FormPostSessionName, w.Result().Cookies()[1].Name)
+	a.Equal(-1, w.Result().Cookies()[1].MaxAge)
+
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(w.Result().Cookies()[0])
+	r.AddCookie(cookies[1])
+	value, err = oauth.GetSession(r)
+	a.NoError(err)
+	a.Contains(string(value), `"AccessToken":"at"`)
+}
@@ -0,0 +1,28 @@
+package oauth
+
+import "time"
+
+// Clock tells the current time. Providers use it wherever a token or state
+// lifetime is checked so that the time source can be replaced in tests.
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc adapts an ordinary function to the Clock interface.
+type ClockFunc func() time.Time
+
+// Now calls f().
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// SystemClock is the Clock backed by time.Now.
+var SystemClock Clock = ClockFunc(time.Now)
+
+// ClockWithFallBack returns c, or SystemClock if c is nil.
+func ClockWithFallBack(c Clock) Clock {
+	if c != nil {
+		return c
+	}
+	return SystemClock
+}
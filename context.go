@@ -0,0 +1,17 @@
+package oauth
+
+import "context"
+
+type userKey struct{}
+
+// WithUser returns a copy of ctx carrying the authenticated user.
+func WithUser(ctx context.Context, user User) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// UserFromContext returns the user authenticated by one of the middlewares,
+// or false when the request is not authenticated.
+func UserFromContext(ctx context.Context) (User, bool) {
+	user, ok := ctx.Value(userKey{}).(User)
+	return user, ok
+}
@@ -0,0 +1,136 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// DeviceCodeGrantType is the grant_type used to poll the token endpoint
+// during the device authorization grant.
+const DeviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// Error codes returned by the token endpoint while polling in the device
+// authorization grant. See RFC 8628 section 3.5.
+const (
+	ErrorCodeAuthorizationPending = "authorization_pending"
+	ErrorCodeSlowDown             = "slow_down"
+	ErrorCodeAccessDenied         = "access_denied"
+	ErrorCodeExpiredToken         = "expired_token"
+)
+
+const (
+	// defaultDeviceInterval is the polling interval used when the provider
+	// does not send one.
+	defaultDeviceInterval = 5 * time.Second
+
+	// slowDownIncrement is added to the polling interval on slow_down.
+	slowDownIncrement = 5 * time.Second
+)
+
+// DeviceAuth is a pending device authorization. Show the UserCode and
+// VerificationURI (or VerificationURIComplete) to the user, then poll for
+// the token with the provider's AuthorizeDevice.
+// See https://datatracker.ietf.org/doc/html/rfc8628#section-3.2
+type DeviceAuth struct {
+	DeviceCode              string
+	UserCode                string
+	VerificationURI         string
+	VerificationURIComplete string
+	ExpiresAt               time.Time
+	Interval                time.Duration
+}
+
+// DeviceFlowProvider is implemented by providers that support the OAuth 2.0
+// Device Authorization Grant, for clients that cannot receive a browser
+// callback.
+type DeviceFlowProvider interface {
+	Provider
+	// BeginDeviceAuth requests a device and user code from the provider.
+	BeginDeviceAuth(ctx context.Context) (*DeviceAuth, error)
+	// AuthorizeDevice polls the provider until the user has approved the
+	// request and returns a session that can be passed to FetchUser.
+	AuthorizeDevice(ctx context.Context, da *DeviceAuth) (Session, error)
+}
+
+// ParseDeviceAuthResponse decodes a device authorization response. The
+// non-standard verification_url member sent by Google is accepted as well.
+func ParseDeviceAuthResponse(body []byte, now time.Time) (*DeviceAuth, error) {
+	var dr struct {
+		DeviceCode              string      `json:"device_code"`
+		UserCode                string      `json:"user_code"`
+		VerificationURI         string      `json:"verification_uri"`
+		VerificationURL         string      `json:"verification_url"`
+		VerificationURIComplete string      `json:"verification_uri_complete"`
+		ExpiresIn               json.Number `json:"expires_in"`
+		Interval                json.Number `json:"interval"`
+	}
+	if err := json.Unmarshal(body, &dr); err != nil {
+		return nil, err
+	}
+	if dr.DeviceCode == "" || dr.UserCode == "" {
+		return nil, errors.New("oauth2: device authorization response missing device_code or user_code")
+	}
+
+	da := &DeviceAuth{
+		DeviceCode:              dr.DeviceCode,
+		UserCode:                dr.UserCode,
+		VerificationURI:         dr.VerificationURI,
+		VerificationURIComplete: dr.VerificationURIComplete,
+		Interval:                defaultDeviceInterval,
+	}
+	if da.VerificationURI == "" {
+		da.VerificationURI = dr.VerificationURL
+	}
+	if expiresIn, err := dr.ExpiresIn.Int64(); err == nil && expiresIn > 0 {
+		da.ExpiresAt = now.Add(time.Duration(expiresIn) * time.Second)
+	}
+	if interval, err := dr.Interval.Int64(); err == nil && interval > 0 {
+		da.Interval = time.Duration(interval) * time.Second
+	}
+	return da, nil
+}
+
+// PollDeviceToken calls requestToken every da.Interval until it returns a
+// token or fails with anything but authorization_pending or slow_down. On
+// slow_down the interval is increased by five seconds as RFC 8628 requires.
+// Polling stops with an expired_token *Error once da.ExpiresAt has passed
+// according to clock, which may be nil for the system clock.
+func PollDeviceToken(ctx context.Context, clock Clock, da *DeviceAuth, requestToken func() (*oauth2.Token, error)) (*oauth2.Token, error) {
+	clock = ClockWithFallBack(clock)
+	interval := da.Interval
+
+	for {
+		if !da.ExpiresAt.IsZero() && !clock.Now().Before(da.ExpiresAt) {
+			return nil, &Error{Code: ErrorCodeExpiredToken, Description: "the device code has expired"}
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		token, err := requestToken()
+		if err == nil {
+			return token, nil
+		}
+
+		var oauthErr *Error
+		if !errors.As(err, &oauthErr) {
+			return nil, err
+		}
+		switch oauthErr.Code {
+		case ErrorCodeAuthorizationPending:
+		case ErrorCodeSlowDown:
+			interval += slowDownIncrement
+		default:
+			return nil, err
+		}
+	}
+}
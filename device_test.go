@@ -0,0 +1,83 @@
+package oauth_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/rapidmidiex/oauth"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func Test_ParseDeviceAuthResponse(t *testing.T) {
+	a := assert.New(t)
+
+	now := time.Unix(1700000000, 0)
+	da, err := oauth.ParseDeviceAuthResponse([]byte(`{"device_code":"dc","user_code":"ABCD-EFGH","verification_url":"https://www.google.com/device","expires_in":1800,"interval":7}`), now)
+	a.NoError(err)
+	a.Equal("dc", da.DeviceCode)
+	a.Equal("ABCD-EFGH", da.UserCode)
+	a.Equal("https://www.google.com/device", da.VerificationURI)
+	a.Equal(now.Add(30*time.Minute), da.ExpiresAt)
+	a.Equal(7*time.Second, da.Interval)
+
+	da, err = oauth.ParseDeviceAuthResponse([]byte(`{"device_code":"dc","user_code":"WDJB-MJHT","verification_uri":"https://example.com/device"}`), now)
+	a.NoError(err)
+	a.Equal("https://example.com/device", da.VerificationURI)
+	a.Equal(5*time.Second, da.Interval)
+
+	_, err = oauth.ParseDeviceAuthResponse([]byte(`{}`), now)
+	a.Error(err)
+}
+
+func Test_PollDeviceToken(t *testing.T) {
+	a := assert.New(t)
+
+	responses := []error{
+		&oauth.Error{StatusCode: http.StatusBadRequest, Code: oauth.ErrorCodeAuthorizationPending},
+		&oauth.Error{StatusCode: http.StatusBadRequest, Code: oauth.ErrorCodeAuthorizationPending},
+	}
+	calls := 0
+	da := &oauth.DeviceAuth{DeviceCode: "dc", Interval: time.Millisecond}
+	token, err := oauth.PollDeviceToken(context.Background(), nil, da, func() (*oauth2.Token, error) {
+		calls++
+		if len(responses) > 0 {
+			err := responses[0]
+			responses = responses[1:]
+			return nil, err
+		}
+		return &oauth2.Token{AccessToken: "at"}, nil
+	})
+	a.NoError(err)
+	a.Equal("at", token.AccessToken)
+	a.Equal(3, calls)
+}
+
+func Test_PollDeviceToken_Errors(t *testing.T) {
+	a := assert.New(t)
+
+	da := &oauth.DeviceAuth{DeviceCode: "dc", Interval: time.Millisecond}
+	_, err := oauth.PollDeviceToken(context.Background(), nil, da, func() (*oauth2.Token, error) {
+		return nil, &oauth.Error{Code: oauth.ErrorCodeAccessDenied}
+	})
+	a.Equal(oauth.ErrorCodeAccessDenied, err.(*oauth.Error).Code)
+
+	now := time.Unix(1700000000, 0)
+	clock := oauth.ClockFunc(func() time.Time { return now })
+	da = &oauth.DeviceAuth{DeviceCode: "dc", Interval: time.Millisecond, ExpiresAt: now.Add(time.Second)}
+	_, err = oauth.PollDeviceToken(context.Background(), clock, da, func() (*oauth2.Token, error) {
+		now = now.Add(time.Second)
+		return nil, &oauth.Error{Code: oauth.ErrorCodeAuthorizationPending}
+	})
+	a.Equal(oauth.ErrorCodeExpiredToken, err.(*oauth.Error).Code)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	da = &oauth.DeviceAuth{DeviceCode: "dc", Interval: time.Millisecond}
+	_, err = oauth.PollDeviceToken(ctx, nil, da, func() (*oauth2.Token, error) {
+		cancel()
+		return nil, &oauth.Error{Code: oauth.ErrorCodeSlowDown}
+	})
+	a.Equal(context.Canceled, err)
+}
@@ -0,0 +1,60 @@
+package oauth
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Error codes defined by RFC 6749 section 5.2, and invalid_target from
+// RFC 8707 which token exchange uses as well.
+const (
+	ErrorCodeInvalidRequest       = "invalid_request"
+	ErrorCodeInvalidClient        = "invalid_client"
+	ErrorCodeInvalidGrant         = "invalid_grant"
+	ErrorCodeUnauthorizedClient   = "unauthorized_client"
+	ErrorCodeUnsupportedGrantType = "unsupported_grant_type"
+	ErrorCodeInvalidScope         = "invalid_scope"
+	ErrorCodeInvalidTarget        = "invalid_target"
+)
+
+// Error is an error response from an OAuth 2.0 endpoint, as described in
+// RFC 6749 section 5.2.
+type Error struct {
+	StatusCode  int    `json:"-"`
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+	URI         string `json:"error_uri,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("oauth2: server responded with %d", e.StatusCode)
+	}
+	if e.Description == "" {
+		return fmt.Sprintf("oauth2: %s", e.Code)
+	}
+	return fmt.Sprintf("oauth2: %s: %s", e.Code, e.Description)
+}
+
+// StatusError is an unexpected HTTP status from a provider's API, such as
+// while fetching the user. A 401 means the access token expired or was
+// revoked.
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	return e.Message
+}
+
+// ErrorFromResponse decodes the body of an error response. When the body is
+// not an OAuth 2.0 error object, only the status code is set.
+func ErrorFromResponse(statusCode int, body []byte) *Error {
+	e := &Error{}
+	if err := json.Unmarshal(body, e); err != nil {
+		e = &Error{}
+	}
+	e.StatusCode = statusCode
+	return e
+}
@@ -0,0 +1,253 @@
+package jose
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+)
+
+// Key management algorithms supported for JWE.
+const (
+	RSAOAEP    = "RSA-OAEP"
+	RSAOAEP256 = "RSA-OAEP-256"
+	ECDHES     = "ECDH-ES"
+)
+
+// Content encryption algorithms supported for JWE.
+const (
+	A128GCM = "A128GCM"
+	A256GCM = "A256GCM"
+)
+
+// IsJWE reports whether token looks like a compact serialized JWE, which has
+// five parts where a JWS has three.
+func IsJWE(token string) bool {
+	return strings.Count(token, ".") == 4
+}
+
+// Encrypt creates a compact serialized JWE of plaintext for the recipient's
+// public key. header.Alg and header.Enc select the algorithms; for ECDH-ES
+// the ephemeral public key is added to the header.
+func Encrypt(header Header, plaintext []byte, key interface{}) (string, error) {
+	keySize, err := contentKeySize(header.Enc)
+	if err != nil {
+		return "", err
+	}
+
+	var cek, encryptedKey []byte
+	switch header.Alg {
+	case RSAOAEP, RSAOAEP256:
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return "", fmt.Errorf("jose: %s requires an *rsa.PublicKey, got %T", header.Alg, key)
+		}
+		cek = make([]byte, keySize)
+		if _, err := io.ReadFull(rand.Reader, cek); err != nil {
+			return "", err
+		}
+		if encryptedKey, err = rsa.EncryptOAEP(oaepHash(header.Alg), rand.Reader, pub, cek, nil); err != nil {
+			return "", err
+		}
+	case ECDHES:
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return "", fmt.Errorf("jose: %s requires an *ecdsa.PublicKey, got %T", header.Alg, key)
+		}
+		ephemeral, err := ecdsa.GenerateKey(pub.Curve, rand.Reader)
+		if err != nil {
+			return "", err
+		}
+		if header.EPK, err = NewJWK(&ephemeral.PublicKey, ""); err != nil {
+			return "", err
+		}
+		if cek, err = ecdhesKey(ephemeral, pub, header, keySize); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("jose: unsupported key management algorithm %q", header.Alg)
+	}
+
+	h, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	protected := encodeSegment(h)
+
+	gcm, err := newGCM(cek)
+	if err != nil {
+		return "", err
+	}
+	iv := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nil, iv, plaintext, []byte(protected))
+	ciphertext, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+
+	return strings.Join([]string{
+		protected,
+		encodeSegment(encryptedKey),
+		encodeSegment(iv),
+		encodeSegment(ciphertext),
+		encodeSegment(tag),
+	}, "."), nil
+}
+
+// Decrypt decrypts a compact serialized JWE with the recipient's private key
+// and returns its header and plaintext.
+func Decrypt(token string, key interface{}) (*Header, []byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 5 {
+		return nil, nil, errors.New("jose: invalid JWE, not all parts available")
+	}
+
+	segments := make([][]byte, 5)
+	for i, part := range parts {
+		var err error
+		if segments[i], err = decodeSegment(part); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	header := &Header{}
+	if err := json.Unmarshal(segments[0], header); err != nil {
+		return nil, nil, err
+	}
+	keySize, err := contentKeySize(header.Enc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var cek []byte
+	switch header.Alg {
+	case RSAOAEP, RSAOAEP256:
+		priv, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, nil, fmt.Errorf("jose: %s requires an *rsa.PrivateKey, got %T", header.Alg, key)
+		}
+		if cek, err = rsa.DecryptOAEP(oaepHash(header.Alg), rand.Reader, priv, segments[1], nil); err != nil {
+			return nil, nil, err
+		}
+	case ECDHES:
+		priv, ok := key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, nil, fmt.Errorf("jose: %s requires an *ecdsa.PrivateKey, got %T", header.Alg, key)
+		}
+		if header.EPK == nil {
+			return nil, nil, errors.New("jose: ECDH-ES JWE without epk")
+		}
+		epk, err := header.EPK.Key()
+		if err != nil {
+			return nil, nil, err
+		}
+		pub, ok := epk.(*ecdsa.PublicKey)
+		if !ok {
+			return nil, nil, errors.New("jose: epk is not an EC public key")
+		}
+		if cek, err = ecdhesKey(priv, pub, *header, keySize); err != nil {
+			return nil, nil, err
+		}
+	default:
+		return nil, nil, fmt.Errorf("jose: unsupported key management algorithm %q", header.Alg)
+	}
+	if len(cek) != keySize {
+		return nil, nil, errors.New("jose: invalid content encryption key")
+	}
+
+	gcm, err := newGCM(cek)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(segments[2]) != gcm.NonceSize() {
+		return nil, nil, errors.New("jose: invalid JWE initialization vector")
+	}
+	sealed := append(segments[3], segments[4]...)
+	plaintext, err := gcm.Open(nil, segments[2], sealed, []byte(parts[0]))
+	if err != nil {
+		return nil, nil, err
+	}
+	return header, plaintext, nil
+}
+
+func contentKeySize(enc string) (int, error) {
+	switch enc {
+	case A128GCM:
+		return 16, nil
+	case A256GCM:
+		return 32, nil
+	}
+	return 0, fmt.Errorf("jose: unsupported content encryption algorithm %q", enc)
+}
+
+func oaepHash(alg string) hash.Hash {
+	if alg == RSAOAEP256 {
+		return sha256.New()
+	}
+	return sha1.New()
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// ecdhesKey derives the content encryption key for direct key agreement with
+// ECDH-ES, as described in RFC 7518 section 4.6.
+func ecdhesKey(priv *ecdsa.PrivateKey, pub *ecdsa.PublicKey, header Header, keySize int) ([]byte, error) {
+	ecdhPriv, err := priv.ECDH()
+	if err != nil {
+		return nil, err
+	}
+	ecdhPub, err := pub.ECDH()
+	if err != nil {
+		return nil, err
+	}
+	z, err := ecdhPriv.ECDH(ecdhPub)
+	if err != nil {
+		return nil, err
+	}
+
+	apu, err := decodeSegment(header.APU)
+	if err != nil {
+		return nil, err
+	}
+	apv, err := decodeSegment(header.APV)
+	if err != nil {
+		return nil, err
+	}
+	return concatKDF(z, header.Enc, apu, apv, keySize), nil
+}
+
+// concatKDF is the Concat KDF of NIST SP 800-56A with SHA-256.
+func concatKDF(z []byte, algID string, apu, apv []byte, keySize int) []byte {
+	var otherInfo []byte
+	for _, field := range [][]byte{[]byte(algID), apu, apv} {
+		otherInfo = binary.BigEndian.AppendUint32(otherInfo, uint32(len(field)))
+		otherInfo = append(otherInfo, field...)
+	}
+	otherInfo = binary.BigEndian.AppendUint32(otherInfo, uint32(keySize*8))
+
+	var key []byte
+	for counter := uint32(1); len(key) < keySize; counter++ {
+		h := sha256.New()
+		binary.Write(h, binary.BigEndian, counter)
+		h.Write(z)
+		h.Write(otherInfo)
+		key = h.Sum(key)
+	}
+	return key[:keySize]
+}
@@ -0,0 +1,69 @@
+package jose
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_EncryptDecrypt(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	cases := []struct {
+		alg, enc string
+		priv     interface{}
+	}{
+		{RSAOAEP, A128GCM, rsaKey},
+		{RSAOAEP256, A256GCM, rsaKey},
+		{ECDHES, A256GCM, ecKey},
+	}
+	for _, c := range cases {
+		token, err := Encrypt(Header{Alg: c.alg, Enc: c.enc, Cty: "JWT"}, []byte("secret payload"), PublicKey(c.priv))
+		a.NoError(err, c.alg)
+		a.True(IsJWE(token))
+
+		header, plaintext, err := Decrypt(token, c.priv)
+		a.NoError(err, c.alg)
+		a.Equal("JWT", header.Cty)
+		a.Equal("secret payload", string(plaintext))
+
+		_, _, err = Decrypt(token[:len(token)-3]+"AAA", c.priv)
+		a.Error(err, c.alg)
+	}
+}
+
+func Test_ConcatKDF(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	// example from RFC 7518 appendix C
+	z := []byte{158, 86, 217, 29, 129, 113, 53, 211, 114, 131, 66, 131, 191, 132,
+		38, 156, 251, 49, 110, 163, 218, 128, 106, 72, 246, 218, 167, 121,
+		140, 254, 144, 196}
+	key := concatKDF(z, A128GCM, []byte("Alice"), []byte("Bob"), 16)
+	a.Equal("VqqN6vgjbSBcIijNcacQGg", base64.RawURLEncoding.EncodeToString(key))
+}
+
+func Test_EncryptionKeys(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	set := &JWKS{Keys: []JWK{
+		{Kty: "RSA", Kid: "sig", Use: "sig"},
+		{Kty: "RSA", Kid: "enc", Use: "enc"},
+		{Kty: "EC", Kid: "ec-enc", Use: "enc"},
+	}}
+	a.Equal("enc", set.EncryptionKeys(RSAOAEP256)[0].Kid)
+	a.Len(set.EncryptionKeys(RSAOAEP256), 1)
+	a.Equal("ec-enc", set.EncryptionKeys(ECDHES)[0].Kid)
+	a.Len(set.Find("", "RS256"), 1)
+}
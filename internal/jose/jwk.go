@@ -0,0 +1,290 @@
+// Package jose implements the parts of JSON Web Signature, JSON Web Key and
+// JSON Web Token handling needed by the providers. It is intentionally small:
+// compact serialization only, and only the algorithms OpenID providers use.
+package jose
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// JWK is a JSON Web Key as described in RFC 7517.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// EC
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+
+	// private parts, RSA and EC
+	D  string `json:"d,omitempty"`
+	P  string `json:"p,omitempty"`
+	Q  string `json:"q,omitempty"`
+	DP string `json:"dp,omitempty"`
+	DQ string `json:"dq,omitempty"`
+	QI string `json:"qi,omitempty"`
+
+	// symmetric
+	K string `json:"k,omitempty"`
+
+	X5c     []string `json:"x5c,omitempty"`
+	X5tS256 string   `json:"x5t#S256,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// Find returns the keys that may verify a token signed with alg by the key
+// identified with kid. An empty kid matches every key.
+func (s *JWKS) Find(kid, alg string) []JWK {
+	var keys []JWK
+	for _, k := range s.Keys {
+		if kid != "" && k.Kid != kid {
+			continue
+		}
+		if k.Alg != "" && alg != "" && k.Alg != alg {
+			continue
+		}
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// EncryptionKeys returns the keys that may be used to encrypt content for the
+// owner of the set with the key management algorithm alg.
+func (s *JWKS) EncryptionKeys(alg string) []JWK {
+	kty := "RSA"
+	if alg == ECDHES {
+		kty = "EC"
+	}
+
+	var keys []JWK
+	for _, k := range s.Keys {
+		if k.Kty != kty || (k.Use != "" && k.Use != "enc") {
+			continue
+		}
+		if k.Alg != "" && k.Alg != alg {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// NewJWK returns the JWK representation of an RSA or ECDSA key, public or
+// private, or of a symmetric key given as []byte.
+func NewJWK(key interface{}, kid string) (*JWK, error) {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return &JWK{
+			Kty: "RSA",
+			Kid: kid,
+			N:   encodeBigInt(k.N),
+			E:   encodeBigInt(big.NewInt(int64(k.E))),
+		}, nil
+	case *rsa.PrivateKey:
+		jwk, _ := NewJWK(&k.PublicKey, kid)
+		jwk.D = encodeBigInt(k.D)
+		if len(k.Primes) == 2 {
+			k.Precompute()
+			jwk.P = encodeBigInt(k.Primes[0])
+			jwk.Q = encodeBigInt(k.Primes[1])
+			jwk.DP = encodeBigInt(k.Precomputed.Dp)
+			jwk.DQ = encodeBigInt(k.Precomputed.Dq)
+			jwk.QI = encodeBigInt(k.Precomputed.Qinv)
+		}
+		return jwk, nil
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		return &JWK{
+			Kty: "EC",
+			Kid: kid,
+			Crv: k.Curve.Params().Name,
+			X:   encodeFixed(k.X, size),
+			Y:   encodeFixed(k.Y, size),
+		}, nil
+	case *ecdsa.PrivateKey:
+		jwk, _ := NewJWK(&k.PublicKey, kid)
+		jwk.D = encodeFixed(k.D, (k.Curve.Params().BitSize+7)/8)
+		return jwk, nil
+	case []byte:
+		return &JWK{
+			Kty: "oct",
+			Kid: kid,
+			K:   base64.RawURLEncoding.EncodeToString(k),
+		}, nil
+	}
+	return nil, fmt.Errorf("jose: unsupported key type %T", key)
+}
+
+// Key returns the crypto key held by the JWK: *rsa.PublicKey,
+// *rsa.PrivateKey, *ecdsa.PublicKey, *ecdsa.PrivateKey or []byte.
+func (k *JWK) Key() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		pub := &rsa.PublicKey{N: n, E: int(e.Int64())}
+		if k.D == "" {
+			return pub, nil
+		}
+
+		d, err := decodeBigInt(k.D)
+		if err != nil {
+			return nil, err
+		}
+		priv := &rsa.PrivateKey{PublicKey: *pub, D: d}
+		if k.P != "" && k.Q != "" {
+			p, err := decodeBigInt(k.P)
+			if err != nil {
+				return nil, err
+			}
+			q, err := decodeBigInt(k.Q)
+			if err != nil {
+				return nil, err
+			}
+			priv.Primes = []*big.Int{p, q}
+			priv.Precompute()
+		}
+		return priv, nil
+	case "EC":
+		curve, err := curveByName(k.Crv)
+		if err != nil {
+			return nil, err
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("jose: EC point is not on the curve")
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		if k.D == "" {
+			return pub, nil
+		}
+
+		d, err := decodeBigInt(k.D)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PrivateKey{PublicKey: *pub, D: d}, nil
+	case "oct":
+		return base64.RawURLEncoding.DecodeString(k.K)
+	}
+	return nil, fmt.Errorf("jose: unsupported key type %q", k.Kty)
+}
+
+// Public returns the JWK without its private parts.
+func (k *JWK) Public() *JWK {
+	pub := *k
+	pub.D, pub.P, pub.Q, pub.DP, pub.DQ, pub.QI, pub.K = "", "", "", "", "", "", ""
+	return &pub
+}
+
+// Thumbprint computes the base64url encoded SHA-256 JWK thumbprint of the key
+// as described in RFC 7638.
+func (k *JWK) Thumbprint() (string, error) {
+	var members interface{}
+	switch k.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{k.E, k.Kty, k.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{k.Crv, k.Kty, k.X, k.Y}
+	case "oct":
+		members = struct {
+			K   string `json:"k"`
+			Kty string `json:"kty"`
+		}{k.K, k.Kty}
+	default:
+		return "", fmt.Errorf("jose: unsupported key type %q", k.Kty)
+	}
+
+	b, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// PublicKey returns the public half of a private key, or the key itself if it
+// is already public.
+func PublicKey(key interface{}) interface{} {
+	if signer, ok := key.(crypto.Signer); ok {
+		return signer.Public()
+	}
+	return key
+}
+
+func curveByName(name string) (elliptic.Curve, error) {
+	switch name {
+	case "P-256":
+		return elliptic.P256(), nil
+	case "P-384":
+		return elliptic.P384(), nil
+	case "P-521":
+		return elliptic.P521(), nil
+	}
+	return nil, fmt.Errorf("jose: unsupported curve %q", name)
+}
+
+func encodeBigInt(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+func encodeFixed(i *big.Int, size int) string {
+	b := make([]byte, size)
+	return base64.RawURLEncoding.EncodeToString(i.FillBytes(b))
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	if s == "" {
+		return nil, errors.New("jose: missing key parameter")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
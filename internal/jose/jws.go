@@ -0,0 +1,246 @@
+package jose
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	_ "crypto/sha256" // register SHA-256 for crypto.Hash
+	_ "crypto/sha512" // register SHA-384 and SHA-512 for crypto.Hash
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// ErrInvalidSignature is returned when no key verifies a JWS.
+var ErrInvalidSignature = errors.New("jose: invalid signature")
+
+// Header is the JOSE header of a JWS or JWE.
+type Header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+	Typ string `json:"typ,omitempty"`
+	Cty string `json:"cty,omitempty"`
+	JWK *JWK   `json:"jwk,omitempty"`
+
+	// JWE only
+	Enc string `json:"enc,omitempty"`
+	EPK *JWK   `json:"epk,omitempty"`
+	APU string `json:"apu,omitempty"`
+	APV string `json:"apv,omitempty"`
+}
+
+// JWS is a parsed compact serialized JSON Web Signature.
+type JWS struct {
+	Header    Header
+	Payload   []byte
+	signed    string
+	signature []byte
+}
+
+// Sign creates a compact serialized JWS over payload. payload may be a []byte
+// or a value that is marshalled to JSON. header.Alg selects the algorithm and
+// must match the type of key.
+func Sign(header Header, payload interface{}, key interface{}) (string, error) {
+	b, ok := payload.([]byte)
+	if !ok {
+		var err error
+		if b, err = json.Marshal(payload); err != nil {
+			return "", err
+		}
+	}
+
+	h, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+
+	signed := encodeSegment(h) + "." + encodeSegment(b)
+	sig, err := sign(header.Alg, key, []byte(signed))
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + encodeSegment(sig), nil
+}
+
+// Parse splits a compact serialized JWS into its parts without verifying it.
+func Parse(token string) (*JWS, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("jose: invalid token received, not all parts available")
+	}
+
+	h, err := decodeSegment(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	jws := &JWS{signed: parts[0] + "." + parts[1]}
+	if err := json.Unmarshal(h, &jws.Header); err != nil {
+		return nil, err
+	}
+	if jws.Payload, err = decodeSegment(parts[1]); err != nil {
+		return nil, err
+	}
+	if jws.signature, err = decodeSegment(parts[2]); err != nil {
+		return nil, err
+	}
+	return jws, nil
+}
+
+// Verify checks the signature of the JWS with key, which must be a public key
+// (or []byte secret) suitable for the algorithm in the header.
+func (j *JWS) Verify(key interface{}) error {
+	return verify(j.Header.Alg, key, []byte(j.signed), j.signature)
+}
+
+// VerifyAny checks the signature of the JWS against each key in turn and
+// succeeds as soon as one of them verifies it.
+func (j *JWS) VerifyAny(keys []JWK) error {
+	for _, k := range keys {
+		key, err := k.Key()
+		if err != nil {
+			continue
+		}
+		if j.Verify(PublicKey(key)) == nil {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// Claims unmarshals the JWS payload into a claims map.
+func (j *JWS) Claims() (map[string]interface{}, error) {
+	claims := make(map[string]interface{})
+	if err := json.Unmarshal(j.Payload, &claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func hashFor(alg string) (crypto.Hash, error) {
+	if len(alg) != 5 {
+		return 0, fmt.Errorf("jose: unsupported algorithm %q", alg)
+	}
+	switch alg[2:] {
+	case "256":
+		return crypto.SHA256, nil
+	case "384":
+		return crypto.SHA384, nil
+	case "512":
+		return crypto.SHA512, nil
+	}
+	return 0, fmt.Errorf("jose: unsupported algorithm %q", alg)
+}
+
+func sign(alg string, key interface{}, signed []byte) ([]byte, error) {
+	hash, err := hashFor(alg)
+	if err != nil {
+		return nil, err
+	}
+
+	switch alg[:2] {
+	case "HS":
+		secret, ok := key.([]byte)
+		if !ok {
+			return nil, fmt.Errorf("jose: %s requires a []byte key, got %T", alg, key)
+		}
+		mac := hmac.New(hash.New, secret)
+		mac.Write(signed)
+		return mac.Sum(nil), nil
+	case "RS", "PS":
+		priv, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("jose: %s requires an *rsa.PrivateKey, got %T", alg, key)
+		}
+		digest := hashed(hash, signed)
+		if alg[0] == 'P' {
+			return rsa.SignPSS(rand.Reader, priv, hash, digest, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
+		return rsa.SignPKCS1v15(rand.Reader, priv, hash, digest)
+	case "ES":
+		priv, ok := key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("jose: %s requires an *ecdsa.PrivateKey, got %T", alg, key)
+		}
+		r, s, err := ecdsa.Sign(rand.Reader, priv, hashed(hash, signed))
+		if err != nil {
+			return nil, err
+		}
+		size := (priv.Curve.Params().BitSize + 7) / 8
+		sig := make([]byte, 2*size)
+		r.FillBytes(sig[:size])
+		s.FillBytes(sig[size:])
+		return sig, nil
+	}
+	return nil, fmt.Errorf("jose: unsupported algorithm %q", alg)
+}
+
+func verify(alg string, key interface{}, signed, sig []byte) error {
+	hash, err := hashFor(alg)
+	if err != nil {
+		return err
+	}
+
+	switch alg[:2] {
+	case "HS":
+		secret, ok := key.([]byte)
+		if !ok {
+			return ErrInvalidSignature
+		}
+		mac := hmac.New(hash.New, secret)
+		mac.Write(signed)
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return ErrInvalidSignature
+		}
+		return nil
+	case "RS", "PS":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return ErrInvalidSignature
+		}
+		digest := hashed(hash, signed)
+		if alg[0] == 'P' {
+			err = rsa.VerifyPSS(pub, hash, digest, sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto})
+		} else {
+			err = rsa.VerifyPKCS1v15(pub, hash, digest, sig)
+		}
+		if err != nil {
+			return ErrInvalidSignature
+		}
+		return nil
+	case "ES":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return ErrInvalidSignature
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return ErrInvalidSignature
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(pub, hashed(hash, signed), r, s) {
+			return ErrInvalidSignature
+		}
+		return nil
+	}
+	return fmt.Errorf("jose: unsupported algorithm %q", alg)
+}
+
+func hashed(hash crypto.Hash, data []byte) []byte {
+	h := hash.New()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func encodeSegment(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeSegment(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
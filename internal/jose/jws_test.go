@@ -0,0 +1,115 @@
+package jose
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_SignVerify(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	a.NoError(err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	a.NoError(err)
+
+	cases := []struct {
+		alg  string
+		priv interface{}
+		pub  interface{}
+	}{
+		{"RS256", rsaKey, &rsaKey.PublicKey},
+		{"PS256", rsaKey, &rsaKey.PublicKey},
+		{"ES256", ecKey, &ecKey.PublicKey},
+		{"HS256", []byte("secret"), []byte("secret")},
+	}
+
+	for _, c := range cases {
+		token, err := Sign(Header{Alg: c.alg, Kid: "k1"}, map[string]interface{}{"sub": "1234"}, c.priv)
+		a.NoError(err, c.alg)
+
+		jws, err := Parse(token)
+		a.NoError(err, c.alg)
+		a.Equal("k1", jws.Header.Kid)
+		a.NoError(jws.Verify(c.pub), c.alg)
+
+		claims, err := jws.Claims()
+		a.NoError(err)
+		a.Equal("1234", claims["sub"])
+
+		tampered, _ := Parse(token[:len(token)-4] + "AAAA")
+		a.Error(tampered.Verify(c.pub), c.alg)
+	}
+}
+
+func Test_VerifyAny(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	token, err := Sign(Header{Alg: "RS256"}, []byte(`{}`), key)
+	a.NoError(err)
+	jws, _ := Parse(token)
+
+	otherJWK, _ := NewJWK(&other.PublicKey, "other")
+	keyJWK, _ := NewJWK(&key.PublicKey, "key")
+
+	a.Equal(ErrInvalidSignature, jws.VerifyAny([]JWK{*otherJWK}))
+	a.NoError(jws.VerifyAny([]JWK{*otherJWK, *keyJWK}))
+}
+
+func Test_RejectsNone(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	jws, err := Parse("eyJhbGciOiJub25lIn0.e30.")
+	a.NoError(err)
+	a.Error(jws.Verify(nil))
+}
+
+func Test_JWKRoundTrip(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	for _, key := range []interface{}{ecKey, rsaKey} {
+		jwk, err := NewJWK(key, "kid")
+		a.NoError(err)
+
+		b, _ := json.Marshal(jwk)
+		var decoded JWK
+		a.NoError(json.Unmarshal(b, &decoded))
+
+		k, err := decoded.Key()
+		a.NoError(err)
+		a.Equal(key, k)
+		a.Empty(decoded.Public().D)
+	}
+}
+
+func Test_Thumbprint(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	// example from RFC 7638 section 3.1
+	jwk := &JWK{
+		Kty: "RSA",
+		E:   "AQAB",
+		N:   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+	}
+
+	thumbprint, err := jwk.Thumbprint()
+	a.NoError(err)
+	a.Equal("NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", thumbprint)
+}
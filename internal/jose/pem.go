@@ -0,0 +1,61 @@
+package jose
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// ParsePrivateKeyPEM decodes the first PKCS #8, PKCS #1 or SEC 1 private key
+// found in data.
+func ParsePrivateKeyPEM(data []byte) (interface{}, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("jose: no private key found in PEM data")
+		}
+
+		switch block.Type {
+		case "PRIVATE KEY":
+			key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			switch key.(type) {
+			case *rsa.PrivateKey, *ecdsa.PrivateKey:
+				return key, nil
+			}
+			return nil, fmt.Errorf("jose: unsupported private key type %T", key)
+		case "RSA PRIVATE KEY":
+			return x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY":
+			return x509.ParseECPrivateKey(block.Bytes)
+		}
+	}
+}
+
+// SigningAlgorithm returns the JWS algorithm used to sign with key: RS256 for
+// RSA keys, ES256, ES384 or ES512 for ECDSA keys depending on the curve, and
+// HS256 for []byte secrets.
+func SigningAlgorithm(key interface{}) (string, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return "RS256", nil
+	case *ecdsa.PrivateKey:
+		switch k.Curve.Params().BitSize {
+		case 256:
+			return "ES256", nil
+		case 384:
+			return "ES384", nil
+		case 521:
+			return "ES512", nil
+		}
+	case []byte:
+		return "HS256", nil
+	}
+	return "", fmt.Errorf("jose: unsupported signing key type %T", key)
+}
@@ -0,0 +1,47 @@
+package jose
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParsePrivateKeyPEM(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	pkcs8, _ := x509.MarshalPKCS8PrivateKey(ecKey)
+	sec1, _ := x509.MarshalECPrivateKey(ecKey)
+
+	cases := []struct {
+		block *pem.Block
+		key   interface{}
+		alg   string
+	}{
+		{&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}, rsaKey, "RS256"},
+		{&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}, ecKey, "ES256"},
+		{&pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1}, ecKey, "ES256"},
+	}
+	for _, c := range cases {
+		key, err := ParsePrivateKeyPEM(pem.EncodeToMemory(c.block))
+		a.NoError(err, c.block.Type)
+		a.True(c.key.(interface{ Equal(crypto.PrivateKey) bool }).Equal(key), c.block.Type)
+
+		alg, err := SigningAlgorithm(key)
+		a.NoError(err)
+		a.Equal(c.alg, alg)
+	}
+
+	_, err := ParsePrivateKeyPEM([]byte("not a key"))
+	a.Error(err)
+}
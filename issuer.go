@@ -0,0 +1,339 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rapidmidiex/oauth/internal/jose"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// DefaultAccessTokenTTL and DefaultRefreshTokenTTL are the lifetimes of the
+	// tokens minted by an Issuer created with NewIssuer.
+	DefaultAccessTokenTTL  = 15 * time.Minute
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+
+	// DefaultRefreshGracePeriod is the RefreshGracePeriod of an Issuer created
+	// with NewIssuer.
+	DefaultRefreshGracePeriod = 10 * time.Second
+
+	// accessTokenType is the JWT typ of access tokens, see RFC 9068.
+	accessTokenType = "at+jwt"
+)
+
+// ErrNoSigningKey is returned when an Issuer mints a token before any signing
+// key was added.
+var ErrNoSigningKey = errors.New("oauth: the issuer has no signing key, see AddSigningKey")
+
+// AccessClaims are the claims of the access tokens minted by an Issuer. Besides
+// the registered claims they carry the profile of the user that logged in.
+type AccessClaims struct {
+	Issuer    string   `json:"iss"`
+	Subject   string   `json:"sub"`
+	Audience  []string `json:"aud,omitempty"`
+	IssuedAt  int64    `json:"iat"`
+	ExpiresAt int64    `json:"exp"`
+	ID        string   `json:"jti"`
+	// SessionID identifies the login, shared by the tokens refreshed from it.
+	SessionID string `json:"sid,omitempty"`
+
+	// Provider is the name of the provider the user logged in with.
+	Provider      string   `json:"idp,omitempty"`
+	Email         string   `json:"email,omitempty"`
+	EmailVerified bool     `json:"email_verified,omitempty"`
+	Name          string   `json:"name,omitempty"`
+	Username      string   `json:"preferred_username,omitempty"`
+	Picture       string   `json:"picture,omitempty"`
+	Locale        string   `json:"locale,omitempty"`
+	Roles         []string `json:"roles,omitempty"`
+	Groups        []string `json:"groups,omitempty"`
+}
+
+// profileClaims returns the claims about the user, without the registered
+// claims of a particular token.
+func profileClaims(subject string, user User) AccessClaims {
+	if subject == "" {
+		subject = user.Provider + ":" + user.UserID
+	}
+	return AccessClaims{
+		Subject:       subject,
+		Provider:      user.Provider,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		Name:          user.Name,
+		Username:      user.Username,
+		Picture:       user.AvatarURL,
+		Locale:        user.Locale,
+		Roles:         user.Roles,
+		Groups:        user.Groups,
+	}
+}
+
+// Issuer mints the service's own tokens for users that logged in with a
+// provider, so that other services only need to trust one issuer instead of
+// every provider: a signed JWT access token and an opaque refresh token, which
+// is replaced by a new one each time it is used. Reusing a replaced refresh
+// token revokes every token refreshed from the same login, see RefreshFamily.
+//
+//	issuer := oauth.NewIssuer("https://auth.rapidmidiex.com", "rapidmidiex")
+//	err := issuer.AddSigningKey(pemData, "2023-06")
+//	...
+//	token, err := issuer.Issue(r.Context(), accountID, user)
+type Issuer struct {
+	// Issuer is the iss claim, typically the URL of the service.
+	Issuer string
+	// Audience is the aud claim, the services the tokens are meant for.
+	Audience       []string
+	AccessTokenTTL time.Duration
+	// RefreshTokenTTL is how long refresh tokens can be used after the login,
+	// however often they were refreshed.
+	RefreshTokenTTL time.Duration
+	RefreshTokens   RefreshFamilyStore
+	// RefreshGracePeriod is how long a refresh token that was just used still
+	// returns the tokens it was refreshed to, rather than counting as reuse,
+	// so that concurrent refreshes and retries after a lost response succeed.
+	// Meanwhile the Issuer keeps those tokens in memory.
+	RefreshGracePeriod time.Duration
+	Clock              Clock
+
+	mu   sync.RWMutex
+	keys []signingKey
+
+	refreshes refreshResults
+}
+
+type signingKey struct {
+	key interface{}
+	jwk jose.JWK
+}
+
+// NewIssuer creates an Issuer with the default token lifetimes and refresh
+// tokens kept in memory. Add a signing key before issuing tokens.
+func NewIssuer(issuer string, audience ...string) *Issuer {
+	return &Issuer{
+		Issuer:             issuer,
+		Audience:           audience,
+		AccessTokenTTL:     DefaultAccessTokenTTL,
+		RefreshTokenTTL:    DefaultRefreshTokenTTL,
+		RefreshTokens:      NewMemoryRefreshFamilyStore(),
+		RefreshGracePeriod: DefaultRefreshGracePeriod,
+	}
+}
+
+// AddSigningKey adds a PEM encoded RSA or ECDSA private key, which signs the
+// tokens from now on. Keys added before are still published by the JWKS
+// handler, so that tokens they signed stay valid while keys are rotated. The
+// key ID defaults to the key's JWK thumbprint.
+func (i *Issuer) AddSigningKey(pemData []byte, keyID string) error {
+	key, err := jose.ParsePrivateKeyPEM(pemData)
+	if err != nil {
+		return err
+	}
+	alg, err := jose.SigningAlgorithm(key)
+	if err != nil {
+		return err
+	}
+
+	jwk, err := jose.NewJWK(jose.PublicKey(key), keyID)
+	if err != nil {
+		return err
+	}
+	if jwk.Kid == "" {
+		if jwk.Kid, err = jwk.Thumbprint(); err != nil {
+			return err
+		}
+	}
+	jwk.Use = "sig"
+	jwk.Alg = alg
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.keys = append([]signingKey{{key: key, jwk: *jwk}}, i.keys...)
+	return nil
+}
+
+// RemoveKey stops publishing the key, once the tokens it signed expired.
+func (i *Issuer) RemoveKey(keyID string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	keys := i.keys[:0:0]
+	for _, k := range i.keys {
+		if k.jwk.Kid != keyID {
+			keys = append(keys, k)
+		}
+	}
+	i.keys = keys
+}
+
+// JWKS returns the public keys that verify the tokens of the issuer.
+func (i *Issuer) JWKS() *jose.JWKS {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	set := &jose.JWKS{Keys: make([]jose.JWK, 0, len(i.keys))}
+	for _, k := range i.keys {
+		set.Keys = append(set.Keys, k.jwk)
+	}
+	return set
+}
+
+// JWKSHandler serves the public keys of the issuer as a JSON Web Key Set, for
+// the services verifying its tokens with NewVerifier.
+func (i *Issuer) JWKSHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		json.NewEncoder(w).Encode(i.JWKS())
+	})
+}
+
+// Issue mints an access and a refresh token for the user. subject is the sub
+// claim, such as the account ID returned by Linker.Login; it defaults to
+// "provider:userID".
+func (i *Issuer) Issue(ctx context.Context, subject string, user User) (*oauth2.Token, error) {
+	now := i.now()
+	sessionID, err := randomString(16)
+	if err != nil {
+		return nil, err
+	}
+	claims := profileClaims(subject, user)
+	claims.SessionID = sessionID
+
+	refreshToken, err := newRefreshFamily(ctx, i.RefreshTokens, RefreshFamily{
+		ID:        sessionID,
+		Claims:    claims,
+		ExpiresAt: now.Add(i.RefreshTokenTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return i.token(claims, refreshToken, now)
+}
+
+func (i *Issuer) token(claims AccessClaims, refreshToken string, now time.Time) (*oauth2.Token, error) {
+	accessToken, err := i.sign(claims, now)
+	if err != nil {
+		return nil, err
+	}
+	return &oauth2.Token{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		RefreshToken: refreshToken,
+		Expiry:       now.Add(i.AccessTokenTTL),
+	}, nil
+}
+
+// sign signs the access token with the newest key.
+func (i *Issuer) sign(claims AccessClaims, now time.Time) (string, error) {
+	i.mu.RLock()
+	if len(i.keys) == 0 {
+		i.mu.RUnlock()
+		return "", ErrNoSigningKey
+	}
+	key := i.keys[0]
+	i.mu.RUnlock()
+
+	jti, err := randomString(16)
+	if err != nil {
+		return "", err
+	}
+	claims.Issuer = i.Issuer
+	claims.Audience = i.Audience
+	claims.IssuedAt = now.Unix()
+	claims.ExpiresAt = now.Add(i.AccessTokenTTL).Unix()
+	claims.ID = jti
+
+	return jose.Sign(jose.Header{Alg: key.jwk.Alg, Kid: key.jwk.Kid, Typ: accessTokenType}, claims, key.key)
+}
+
+// Refresh exchanges a refresh token for new tokens. The refresh token can only
+// be used once; an unknown, reused or expired one is an invalid_grant *Error.
+// Within RefreshGracePeriod of its use, presenting it again returns the same
+// tokens, so that concurrent requests all get the same successor.
+func (i *Issuer) Refresh(ctx context.Context, refreshToken string) (*oauth2.Token, error) {
+	now := i.now()
+	return i.refreshes.do(ctx, refreshToken, now, i.RefreshGracePeriod, func() (*oauth2.Token, RefreshFamily, error) {
+		next, family, err := rotateRefreshToken(ctx, i.RefreshTokens, now, refreshToken)
+		if err != nil {
+			return nil, family, err
+		}
+		token, err := i.token(family.Claims, next, now)
+		return token, family, err
+	})
+}
+
+// RevokeSession revokes the refresh tokens of the login identified by the sid
+// claim of its access tokens, such as when the user logs out. The access
+// tokens stay valid until they expire.
+func (i *Issuer) RevokeSession(ctx context.Context, sessionID string) error {
+	i.refreshes.forget(sessionID)
+	return i.RefreshTokens.Revoke(ctx, sessionID)
+}
+
+// RefreshHandler is a token endpoint for the refresh_token grant, answering as
+// described in RFC 6749 section 5.
+func (i *Issuer) RefreshHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		if r.Method != http.MethodPost {
+			writeError(w, &Error{StatusCode: http.StatusMethodNotAllowed, Code: ErrorCodeInvalidRequest})
+			return
+		}
+		if r.PostFormValue("grant_type") != "refresh_token" {
+			writeError(w, &Error{StatusCode: http.StatusBadRequest, Code: ErrorCodeUnsupportedGrantType})
+			return
+		}
+
+		token, err := i.Refresh(r.Context(), r.PostFormValue("refresh_token"))
+		if err != nil {
+			oauthErr, ok := err.(*Error)
+			if !ok {
+				oauthErr = &Error{StatusCode: http.StatusInternalServerError, Code: "server_error"}
+			}
+			writeError(w, oauthErr)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  token.AccessToken,
+			"token_type":    token.TokenType,
+			"refresh_token": token.RefreshToken,
+			"expires_in":    int64(i.AccessTokenTTL / time.Second),
+		})
+	})
+}
+
+// Verifier returns a Verifier of the issuer's tokens using its keys directly.
+func (i *Issuer) Verifier() *Verifier {
+	return &Verifier{
+		Issuer:    i.Issuer,
+		Audience:  firstAudience(i.Audience),
+		Clock:     i.Clock,
+		ClockSkew: DefaultClockSkew,
+		keys:      func(context.Context, bool) (*jose.JWKS, error) { return i.JWKS(), nil },
+	}
+}
+
+func (i *Issuer) now() time.Time {
+	return ClockWithFallBack(i.Clock).Now()
+}
+
+func firstAudience(audience []string) string {
+	if len(audience) == 0 {
+		return ""
+	}
+	return audience[0]
+}
+
+func writeError(w http.ResponseWriter, e *Error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.StatusCode)
+	json.NewEncoder(w).Encode(e)
+}
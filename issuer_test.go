@@ -0,0 +1,178 @@
+package oauth_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rapidmidiex/oauth"
+	"github.com/stretchr/testify/assert"
+)
+
+func signingKeyPEM(t *testing.T) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+func testIssuer(t *testing.T) *oauth.Issuer {
+	issuer := oauth.NewIssuer("https://auth.example.com", "jam")
+	if err := issuer.AddSigningKey(signingKeyPEM(t), "key-1"); err != nil {
+		t.Fatal(err)
+	}
+	return issuer
+}
+
+func Test_Issuer_Issue(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+	ctx := context.Background()
+
+	issuer := testIssuer(t)
+	user := oauth.User{
+		Provider:      "github",
+		UserID:        "1",
+		Email:         "drummer@example.com",
+		EmailVerified: true,
+		Username:      "drummer",
+		Groups:        []string{"rapidmidiex"},
+		AccessToken:   "provider-token",
+	}
+
+	token, err := issuer.Issue(ctx, "account-1", user)
+	a.NoError(err)
+	a.Equal("Bearer", token.TokenType)
+	a.NotEmpty(token.RefreshToken)
+	a.WithinDuration(time.Now().Add(oauth.DefaultAccessTokenTTL), token.Expiry, time.Minute)
+	a.NotContains(token.AccessToken, "provider-token")
+
+	claims, err := issuer.Verifier().Verify(ctx, token.AccessToken)
+	a.NoError(err)
+	a.Equal("https://auth.example.com", claims.Issuer)
+	a.Equal([]string{"jam"}, claims.Audience)
+	a.Equal("account-1", claims.Subject)
+	a.Equal("github", claims.Provider)
+	a.Equal("drummer@example.com", claims.Email)
+	a.True(claims.EmailVerified)
+	a.Equal("drummer", claims.Username)
+	a.Equal([]string{"rapidmidiex"}, claims.Groups)
+
+	token, err = issuer.Issue(ctx, "", user)
+	a.NoError(err)
+	claims, _ = issuer.Verifier().Verify(ctx, token.AccessToken)
+	a.Equal("github:1", claims.Subject)
+
+	_, err = oauth.NewIssuer("https://auth.example.com").Issue(ctx, "", user)
+	a.Equal(oauth.ErrNoSigningKey, err)
+}
+
+func Test_Issuer_Refresh(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	issuer := testIssuer(t)
+	issuer.Clock = oauth.ClockFunc(func() time.Time { return now })
+
+	token, err := issuer.Issue(ctx, "account-1", oauth.User{Provider: "github", UserID: "1", Name: "Drummer"})
+	a.NoError(err)
+
+	refreshed, err := issuer.Refresh(ctx, token.RefreshToken)
+	a.NoError(err)
+	a.NotEqual(token.RefreshToken, refreshed.RefreshToken)
+	claims, err := issuer.Verifier().Verify(ctx, refreshed.AccessToken)
+	a.NoError(err)
+	a.Equal("account-1", claims.Subject)
+	a.Equal("Drummer", claims.Name)
+	first, _ := issuer.Verifier().Verify(ctx, token.AccessToken)
+	a.NotEmpty(claims.SessionID)
+	a.Equal(first.SessionID, claims.SessionID)
+
+	_, err = issuer.Refresh(ctx, "unknown")
+	a.EqualError(err, "oauth2: invalid_grant: invalid refresh token")
+
+	// the lifetime counts from the login
+	now = now.Add(oauth.DefaultRefreshTokenTTL)
+	_, err = issuer.Refresh(ctx, refreshed.RefreshToken)
+	a.EqualError(err, "oauth2: invalid_grant: refresh token expired")
+}
+
+func Test_Issuer_RefreshHandler(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	now := time.Now()
+	issuer := testIssuer(t)
+	issuer.Clock = oauth.ClockFunc(func() time.Time { return now })
+	token, _ := issuer.Issue(context.Background(), "account-1", oauth.User{})
+
+	refresh := func(form url.Values) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		issuer.RefreshHandler().ServeHTTP(w, r)
+		return w
+	}
+
+	w := refresh(url.Values{"grant_type": {"refresh_token"}, "refresh_token": {token.RefreshToken}})
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal("no-store", w.Header().Get("Cache-Control"))
+	parsed, err := oauth.ParseTokenResponse(w.Body.Bytes(), time.Now())
+	a.NoError(err)
+	a.Equal("Bearer", parsed.TokenType)
+	a.NotEmpty(parsed.RefreshToken)
+
+	now = now.Add(oauth.DefaultRefreshGracePeriod)
+	w = refresh(url.Values{"grant_type": {"refresh_token"}, "refresh_token": {token.RefreshToken}})
+	a.Equal(http.StatusBadRequest, w.Code)
+	a.JSONEq(`{"error":"invalid_grant","error_description":"refresh token reused"}`, w.Body.String())
+
+	w = refresh(url.Values{"grant_type": {"password"}})
+	a.Equal(http.StatusBadRequest, w.Code)
+	a.JSONEq(`{"error":"unsupported_grant_type"}`, w.Body.String())
+}
+
+func Test_Issuer_JWKSHandler(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	issuer := testIssuer(t)
+	a.NoError(issuer.AddSigningKey(signingKeyPEM(t), ""))
+
+	w := httptest.NewRecorder()
+	issuer.JWKSHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/jwks", nil))
+	a.Equal(http.StatusOK, w.Code)
+
+	var set struct {
+		Keys []map[string]interface{} `json:"keys"`
+	}
+	a.NoError(json.Unmarshal(w.Body.Bytes(), &set))
+	a.Len(set.Keys, 2)
+	a.NotEmpty(set.Keys[0]["kid"])
+	a.Equal("key-1", set.Keys[1]["kid"])
+	for _, key := range set.Keys {
+		a.Equal("sig", key["use"])
+		a.Equal("ES256", key["alg"])
+		a.NotContains(key, "d")
+	}
+
+	issuer.RemoveKey("key-1")
+	a.Len(issuer.JWKS().Keys, 1)
+}
@@ -0,0 +1,157 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNoSession is returned by Linker.Link and Linker.Unlink when there is
+	// no logged in user to change the account of.
+	ErrNoSession = errors.New("oauth: linking requires a logged in user")
+	// ErrLastIdentity is returned by Linker.Unlink and UserStore.Unlink for
+	// the only identity of an account, which would leave no way to log into
+	// it.
+	ErrLastIdentity = errors.New("oauth: cannot unlink the last identity of an account")
+)
+
+// LinkPolicy decides whether a user logging in with a new identity is linked
+// to the account of an existing identity that has the same email.
+type LinkPolicy func(existing, user User) bool
+
+// LinkVerifiedEmail links identities whose providers both verified the email.
+func LinkVerifiedEmail(existing, user User) bool {
+	return existing.EmailVerified && user.EmailVerified &&
+		existing.Email != "" && strings.EqualFold(existing.Email, user.Email)
+}
+
+// LinkVerifiedEmailFrom is LinkVerifiedEmail restricted to identities of the
+// given providers, for when only some providers are trusted to verify emails.
+func LinkVerifiedEmailFrom(providers ...string) LinkPolicy {
+	trusted := func(provider string) bool {
+		for _, p := range providers {
+			if p == provider {
+				return true
+			}
+		}
+		return false
+	}
+	return func(existing, user User) bool {
+		return trusted(existing.Provider) && trusted(user.Provider) && LinkVerifiedEmail(existing, user)
+	}
+}
+
+// Linker maps the users of every provider to the application's accounts, so
+// that someone logging in with GitHub one day and Google the next ends up in
+// the same account:
+//
+//	linker := &oauth.Linker{Store: store, LinkByEmail: oauth.LinkVerifiedEmail}
+//	accountID, err := linker.Login(r.Context(), user)
+type Linker struct {
+	Store UserStore
+	// LinkByEmail decides whether a new identity joins the account of an
+	// identity with the same email. When nil, identities are only linked
+	// explicitly through Link.
+	LinkByEmail LinkPolicy
+}
+
+// Login returns the account of a user that logged in. A new identity is linked
+// to an existing account when LinkByEmail allows it for exactly one account,
+// and gets an account of its own otherwise. The user is stored without its
+// tokens and RawData.
+func (l *Linker) Login(ctx context.Context, user User) (string, error) {
+	user = profile(user)
+	accountID, err := l.Store.Find(ctx, user.Provider, user.UserID)
+	if err == nil {
+		// keep the stored profile up to date
+		return accountID, l.Store.Link(ctx, accountID, user)
+	}
+	if err != ErrAccountNotFound {
+		return "", err
+	}
+
+	accountID, err = l.emailAccount(ctx, user)
+	if err != nil {
+		return "", err
+	}
+	if accountID != "" {
+		return accountID, l.Store.Link(ctx, accountID, user)
+	}
+
+	accountID, err = l.Store.Create(ctx, user)
+	if err == ErrIdentityLinked {
+		// a concurrent login created the account first
+		return l.Store.Find(ctx, user.Provider, user.UserID)
+	}
+	return accountID, err
+}
+
+// emailAccount returns the only account LinkByEmail links the user to, if any.
+func (l *Linker) emailAccount(ctx context.Context, user User) (string, error) {
+	if l.LinkByEmail == nil || user.Email == "" {
+		return "", nil
+	}
+	candidates, err := l.Store.FindByEmail(ctx, user.Email)
+	if err != nil {
+		return "", err
+	}
+
+	accountID := ""
+	for _, candidate := range candidates {
+		if !l.LinkByEmail(candidate.User, user) {
+			continue
+		}
+		if accountID != "" && accountID != candidate.AccountID {
+			// ambiguous, leave it to the user to link explicitly
+			return "", nil
+		}
+		accountID = candidate.AccountID
+	}
+	return accountID, nil
+}
+
+// Link links user, who just logged in with another provider, to the account of
+// current, the user of the existing session. It returns ErrIdentityLinked when
+// user belongs to another account.
+func (l *Linker) Link(ctx context.Context, current, user User) (string, error) {
+	accountID, err := l.currentAccount(ctx, current)
+	if err != nil {
+		return "", err
+	}
+	return accountID, l.Store.Link(ctx, accountID, profile(user))
+}
+
+// Unlink removes an identity from the account of current, the user of the
+// existing session. The last identity of an account cannot be unlinked.
+func (l *Linker) Unlink(ctx context.Context, current User, provider, userID string) error {
+	accountID, err := l.currentAccount(ctx, current)
+	if err != nil {
+		return err
+	}
+	return l.Store.Unlink(ctx, accountID, provider, userID)
+}
+
+func (l *Linker) currentAccount(ctx context.Context, current User) (string, error) {
+	if current.Provider == "" || current.UserID == "" {
+		return "", ErrNoSession
+	}
+	accountID, err := l.Store.Find(ctx, current.Provider, current.UserID)
+	if err == ErrAccountNotFound {
+		return "", ErrNoSession
+	}
+	return accountID, err
+}
+
+// profile strips user of its tokens and the provider's RawData, which may
+// hold them as well, so that a UserStore never keeps credentials.
+func profile(user User) User {
+	user.AccessToken = ""
+	user.AccessTokenSecret = ""
+	user.RefreshToken = ""
+	user.IDToken = ""
+	user.ExpiresAt = time.Time{}
+	user.RawData = nil
+	return user
+}
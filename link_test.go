@@ -0,0 +1,187 @@
+package oauth_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/rapidmidiex/oauth"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Linker_Login(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+	ctx := context.Background()
+
+	linker := &oauth.Linker{Store: oauth.NewMemoryUserStore(), LinkByEmail: oauth.LinkVerifiedEmail}
+
+	github := oauth.User{Provider: "github", UserID: "1", Email: "drummer@example.com", EmailVerified: true}
+	accountID, err := linker.Login(ctx, github)
+	a.NoError(err)
+
+	again, err := linker.Login(ctx, github)
+	a.NoError(err)
+	a.Equal(accountID, again)
+
+	// same verified email
+	google := oauth.User{Provider: "google", UserID: "1", Email: "Drummer@example.com", EmailVerified: true}
+	linked, err := linker.Login(ctx, google)
+	a.NoError(err)
+	a.Equal(accountID, linked)
+
+	// unverified emails are never linked
+	slack := oauth.User{Provider: "slack", UserID: "1", Email: "drummer@example.com"}
+	other, err := linker.Login(ctx, slack)
+	a.NoError(err)
+	a.NotEqual(accountID, other)
+
+	// without a policy every identity gets its own account
+	linker = &oauth.Linker{Store: oauth.NewMemoryUserStore()}
+	first, _ := linker.Login(ctx, github)
+	second, _ := linker.Login(ctx, google)
+	a.NotEqual(first, second)
+}
+
+func Test_Linker_LoginAmbiguous(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+	ctx := context.Background()
+
+	store := oauth.NewMemoryUserStore()
+	first, _ := store.Create(ctx, oauth.User{Provider: "github", UserID: "1", Email: "drummer@example.com", EmailVerified: true})
+	second, _ := store.Create(ctx, oauth.User{Provider: "discord", UserID: "1", Email: "drummer@example.com", EmailVerified: true})
+
+	linker := &oauth.Linker{Store: store, LinkByEmail: oauth.LinkVerifiedEmail}
+	accountID, err := linker.Login(ctx, oauth.User{Provider: "google", UserID: "1", Email: "drummer@example.com", EmailVerified: true})
+	a.NoError(err)
+	a.NotEqual(first, accountID)
+	a.NotEqual(second, accountID)
+}
+
+func Test_Linker_LoginConcurrent(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	linker := &oauth.Linker{Store: oauth.NewMemoryUserStore()}
+	user := oauth.User{Provider: "github", UserID: "1"}
+
+	var wg sync.WaitGroup
+	accountIDs := make([]string, 10)
+	for i := range accountIDs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			accountIDs[i], _ = linker.Login(context.Background(), user)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, accountID := range accountIDs {
+		a.Equal(accountIDs[0], accountID)
+	}
+}
+
+func Test_Linker_StoresNoTokens(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+	ctx := context.Background()
+
+	linker := &oauth.Linker{Store: oauth.NewMemoryUserStore()}
+	github := oauth.User{
+		Provider:     "github",
+		UserID:       "1",
+		Name:         "Drummer",
+		AccessToken:  "access",
+		RefreshToken: "refresh",
+		IDToken:      "id",
+		RawData:      map[string]interface{}{"access_token": "access"},
+	}
+	google := oauth.User{Provider: "google", UserID: "1", AccessTokenSecret: "secret"}
+
+	accountID, err := linker.Login(ctx, github)
+	a.NoError(err)
+	_, err = linker.Link(ctx, github, google)
+	a.NoError(err)
+
+	users, _ := linker.Store.Users(ctx, accountID)
+	a.Equal([]oauth.User{
+		{Provider: "github", UserID: "1", Name: "Drummer"},
+		{Provider: "google", UserID: "1"},
+	}, users)
+}
+
+func Test_Linker_UnlinkConcurrent(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+	ctx := context.Background()
+
+	linker := &oauth.Linker{Store: oauth.NewMemoryUserStore()}
+	github := oauth.User{Provider: "github", UserID: "1"}
+	google := oauth.User{Provider: "google", UserID: "1"}
+	accountID, _ := linker.Login(ctx, github)
+	linker.Link(ctx, github, google)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, user := range []oauth.User{github, google} {
+		wg.Add(1)
+		go func(i int, user oauth.User) {
+			defer wg.Done()
+			errs[i] = linker.Unlink(ctx, user, user.Provider, user.UserID)
+		}(i, user)
+	}
+	wg.Wait()
+
+	a.ElementsMatch([]error{nil, oauth.ErrLastIdentity}, errs)
+	users, _ := linker.Store.Users(ctx, accountID)
+	a.Len(users, 1)
+}
+
+func Test_LinkVerifiedEmailFrom(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	policy := oauth.LinkVerifiedEmailFrom("github", "google")
+	github := oauth.User{Provider: "github", Email: "drummer@example.com", EmailVerified: true}
+	google := oauth.User{Provider: "google", Email: "drummer@example.com", EmailVerified: true}
+	discord := oauth.User{Provider: "discord", Email: "drummer@example.com", EmailVerified: true}
+
+	a.True(policy(github, google))
+	a.False(policy(github, discord))
+	a.False(policy(discord, google))
+}
+
+func Test_Linker_LinkUnlink(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+	ctx := context.Background()
+
+	linker := &oauth.Linker{Store: oauth.NewMemoryUserStore()}
+	github := oauth.User{Provider: "github", UserID: "1"}
+	google := oauth.User{Provider: "google", UserID: "1"}
+
+	accountID, _ := linker.Login(ctx, github)
+
+	_, err := linker.Link(ctx, oauth.User{}, google)
+	a.Equal(oauth.ErrNoSession, err)
+	_, err = linker.Link(ctx, oauth.User{Provider: "slack", UserID: "1"}, google)
+	a.Equal(oauth.ErrNoSession, err)
+
+	linked, err := linker.Link(ctx, github, google)
+	a.NoError(err)
+	a.Equal(accountID, linked)
+	found, _ := linker.Login(ctx, google)
+	a.Equal(accountID, found)
+
+	// google belongs to the first account now
+	discord := oauth.User{Provider: "discord", UserID: "1"}
+	linker.Login(ctx, discord)
+	_, err = linker.Link(ctx, discord, google)
+	a.Equal(oauth.ErrIdentityLinked, err)
+
+	a.Equal(oauth.ErrNoSession, linker.Unlink(ctx, oauth.User{}, "google", "1"))
+	a.Equal(oauth.ErrIdentityNotLinked, linker.Unlink(ctx, github, "discord", "1"))
+	a.NoError(linker.Unlink(ctx, github, "google", "1"))
+	a.Equal(oauth.ErrLastIdentity, linker.Unlink(ctx, github, "github", "1"))
+}
@@ -0,0 +1,210 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// LoopbackTimeout bounds how long LoopbackLogin.Wait waits for the callback.
+var LoopbackTimeout = 5 * time.Minute
+
+// loopbackCallbackPath is the path of the redirect URI served by the loopback
+// listener.
+const loopbackCallbackPath = "/callback"
+
+// LoopbackLogin is a login from a native application using a loopback
+// interface redirect, as described in RFC 8252 section 7.3. Open AuthURL in
+// the user's browser, then call Wait.
+type LoopbackLogin struct {
+	// AuthURL is the authorization URL the user has to visit.
+	AuthURL string
+	// RedirectURI is the redirect_uri sent to the provider.
+	RedirectURI string
+
+	provider Provider
+	session  Session
+	state    string
+	verifier string
+
+	server *http.Server
+	// once claims the login for the first callback with the right state.
+	once   sync.Once
+	result chan loopbackResult
+}
+
+type loopbackResult struct {
+	user User
+	err  error
+}
+
+// BeginLoopbackAuth starts a loopback login with the named provider. It
+// listens on a random port of 127.0.0.1 and builds the authorization URL with
+// the matching redirect_uri, a random state and a PKCE challenge. Nothing is
+// opened; it is up to the caller to send the user to AuthURL.
+//
+// The provider's OAuth client must allow http://127.0.0.1 redirect URIs with
+// any port. The callback may carry the response in the query string, post it
+// with response_mode=form_post, or send it as a JWT secured response (JARM).
+func (c *Client) BeginLoopbackAuth(providerName string) (*LoopbackLogin, error) {
+	provider, err := c.GetProvider(providerName)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := GenerateCodeVerifier()
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	l := &LoopbackLogin{
+		RedirectURI: fmt.Sprintf("http://%s%s", listener.Addr().String(), loopbackCallbackPath),
+		provider:    provider,
+		state:       state,
+		verifier:    verifier,
+		result:      make(chan loopbackResult, 1),
+	}
+
+	opts := []oauth2.AuthCodeOption{
+		oauth2.SetAuthURLParam("redirect_uri", l.RedirectURI),
+		oauth2.SetAuthURLParam("code_challenge", CodeChallengeS256(verifier)),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	}
+	if p, ok := provider.(AuthOptionsProvider); ok {
+		l.session, err = p.BeginAuthWithOptions(state, opts...)
+		if err == nil {
+			l.AuthURL, err = l.session.GetAuthURL()
+		}
+	} else {
+		l.session, err = provider.BeginAuth(state)
+		if err == nil {
+			l.AuthURL, err = l.session.GetAuthURL()
+		}
+		if err == nil {
+			l.AuthURL, err = setAuthURLParams(l.AuthURL, opts)
+		}
+	}
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(loopbackCallbackPath, l.handleCallback)
+	l.server = &http.Server{Handler: mux}
+	go l.server.Serve(listener)
+
+	return l, nil
+}
+
+// Wait blocks until the provider redirects back to the loopback listener, ctx
+// is done, or LoopbackTimeout has passed. On success it returns the
+// authorized Session and the user fetched with it. The listener is closed
+// before Wait returns.
+func (l *LoopbackLogin) Wait(ctx context.Context) (Session, User, error) {
+	defer l.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, LoopbackTimeout)
+	defer cancel()
+
+	select {
+	case res := <-l.result:
+		if res.err != nil {
+			return nil, User{}, res.err
+		}
+		return l.session, res.user, nil
+	case <-ctx.Done():
+		return nil, User{}, ctx.Err()
+	}
+}
+
+// Close stops the loopback listener.
+func (l *LoopbackLogin) Close() error {
+	return l.server.Close()
+}
+
+func (l *LoopbackLogin) handleCallback(w http.ResponseWriter, r *http.Request) {
+	if GetState(r) != l.state {
+		// not ours, leave the login pending
+		http.Error(w, "state token mismatch", http.StatusBadRequest)
+		return
+	}
+	params, err := CallbackParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// the code is exchanged once, later callbacks do not wait for it
+	claimed := false
+	l.once.Do(func() { claimed = true })
+	if !claimed {
+		http.Error(w, "login already completed", http.StatusConflict)
+		return
+	}
+
+	res := loopbackResult{}
+	if code := params.Get("error"); code != "" {
+		res.err = &Error{Code: code, Description: params.Get("error_description"), URI: params.Get("error_uri")}
+	} else {
+		params.Set("redirect_uri", l.RedirectURI)
+		params.Set("code_verifier", l.verifier)
+		if _, res.err = l.session.Authorize(l.provider, params); res.err == nil {
+			res.user, res.err = l.provider.FetchUser(l.session)
+		}
+	}
+
+	l.result <- res
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if res.err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, "<!DOCTYPE html><html><body>Login failed, you can close this window.</body></html>")
+		return
+	}
+	fmt.Fprint(w, "<!DOCTYPE html><html><body>Login complete, you can close this window.</body></html>")
+}
+
+// setAuthURLParams adds opts to an existing authorization URL, for providers
+// that do not implement AuthOptionsProvider.
+func setAuthURLParams(authURL string, opts []oauth2.AuthCodeOption) (string, error) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return "", err
+	}
+
+	// let the oauth2 package apply the options to an empty URL
+	applied, err := url.Parse((&oauth2.Config{}).AuthCodeURL("", opts...))
+	if err != nil {
+		return "", err
+	}
+
+	q := u.Query()
+	for k, v := range applied.Query() {
+		switch k {
+		case "redirect_uri", "code_challenge", "code_challenge_method":
+			q[k] = v
+		}
+	}
+	if q.Get("redirect_uri") == "" {
+		return "", errors.New("oauth: could not set redirect_uri on the authorization URL")
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
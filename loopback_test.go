@@ -0,0 +1,111 @@
+package oauth_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/rapidmidiex/oauth"
+	"github.com/rapidmidiex/oauth/providers/faux"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_LoopbackLogin(t *testing.T) {
+	a := assert.New(t)
+
+	client := oauth.NewClient()
+	client.UseProviders(&faux.Provider{})
+
+	login, err := client.BeginLoopbackAuth("faux")
+	a.NoError(err)
+	a.True(strings.HasPrefix(login.RedirectURI, "http://127.0.0.1:"))
+
+	authURL, err := url.Parse(login.AuthURL)
+	a.NoError(err)
+	a.Equal("example.com", authURL.Host)
+	a.Equal(login.RedirectURI, authURL.Query().Get("redirect_uri"))
+	a.Equal("S256", authURL.Query().Get("code_challenge_method"))
+	a.NotEmpty(authURL.Query().Get("code_challenge"))
+
+	// a callback with the wrong state is rejected and the login stays pending
+	resp, err := http.Get(login.RedirectURI + "?code=abc&state=wrong")
+	a.NoError(err)
+	resp.Body.Close()
+	a.Equal(http.StatusBadRequest, resp.StatusCode)
+
+	resp, err = http.Get(login.RedirectURI + "?code=abc&state=" + url.QueryEscape(authURL.Query().Get("state")))
+	a.NoError(err)
+	resp.Body.Close()
+	a.Equal(http.StatusOK, resp.StatusCode)
+
+	// the code is exchanged once
+	resp, err = http.Get(login.RedirectURI + "?code=abc&state=" + url.QueryEscape(authURL.Query().Get("state")))
+	a.NoError(err)
+	resp.Body.Close()
+	a.Equal(http.StatusConflict, resp.StatusCode)
+
+	session, user, err := login.Wait(context.Background())
+	a.NoError(err)
+	a.Equal("access", session.(*faux.Session).AccessToken)
+	a.Equal("faux", user.Provider)
+	a.Equal("access", user.AccessToken)
+}
+
+func Test_LoopbackLogin_FormPost(t *testing.T) {
+	a := assert.New(t)
+
+	client := oauth.NewClient()
+	client.UseProviders(&faux.Provider{})
+
+	login, err := client.BeginLoopbackAuth("faux")
+	a.NoError(err)
+	authURL, _ := url.Parse(login.AuthURL)
+
+	resp, err := http.PostForm(login.RedirectURI, url.Values{"code": {"abc"}, "state": {authURL.Query().Get("state")}})
+	a.NoError(err)
+	resp.Body.Close()
+	a.Equal(http.StatusOK, resp.StatusCode)
+
+	_, user, err := login.Wait(context.Background())
+	a.NoError(err)
+	a.Equal("access", user.AccessToken)
+}
+
+func Test_LoopbackLogin_ProviderError(t *testing.T) {
+	a := assert.New(t)
+
+	client := oauth.NewClient()
+	client.UseProviders(&faux.Provider{})
+
+	login, err := client.BeginLoopbackAuth("faux")
+	a.NoError(err)
+	authURL, _ := url.Parse(login.AuthURL)
+
+	resp, err := http.Get(login.RedirectURI + "?error=access_denied&state=" + url.QueryEscape(authURL.Query().Get("state")))
+	a.NoError(err)
+	resp.Body.Close()
+	a.Equal(http.StatusUnauthorized, resp.StatusCode)
+
+	_, _, err = login.Wait(context.Background())
+	a.Equal("access_denied", err.(*oauth.Error).Code)
+}
+
+func Test_LoopbackLogin_Timeout(t *testing.T) {
+	a := assert.New(t)
+
+	client := oauth.NewClient()
+	client.UseProviders(&faux.Provider{})
+
+	login, err := client.BeginLoopbackAuth("faux")
+	a.NoError(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err = login.Wait(ctx)
+	a.Equal(context.Canceled, err)
+
+	_, err = client.BeginLoopbackAuth("unknown")
+	a.Error(err)
+}
@@ -0,0 +1,45 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+
+	"golang.org/x/oauth2"
+)
+
+// GenerateCodeVerifier returns a random PKCE code_verifier as described in
+// RFC 7636 section 4.1.
+func GenerateCodeVerifier() (string, error) {
+	return randomString(32)
+}
+
+// CodeChallengeS256 returns the S256 code_challenge for verifier.
+func CodeChallengeS256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeExchangeOptions returns the options for exchanging an authorization
+// code that were passed as params: a redirect_uri overriding the provider's
+// callback URL, and a PKCE code_verifier.
+func AuthCodeExchangeOptions(params Params) []oauth2.AuthCodeOption {
+	var opts []oauth2.AuthCodeOption
+	if redirectURL := params.Get("redirect_uri"); redirectURL != "" {
+		opts = append(opts, oauth2.SetAuthURLParam("redirect_uri", redirectURL))
+	}
+	if codeVerifier := params.Get("code_verifier"); codeVerifier != "" {
+		opts = append(opts, oauth2.SetAuthURLParam("code_verifier", codeVerifier))
+	}
+	return opts
+}
+
+// randomString returns n random bytes, base64url encoded without padding.
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
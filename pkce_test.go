@@ -0,0 +1,27 @@
+package oauth_test
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/rapidmidiex/oauth"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_CodeChallengeS256(t *testing.T) {
+	a := assert.New(t)
+
+	// example from RFC 7636 appendix B
+	a.Equal("E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", oauth.CodeChallengeS256("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"))
+
+	verifier, err := oauth.GenerateCodeVerifier()
+	a.NoError(err)
+	a.Len(verifier, 43)
+}
+
+func Test_AuthCodeExchangeOptions(t *testing.T) {
+	a := assert.New(t)
+
+	a.Empty(oauth.AuthCodeExchangeOptions(url.Values{"code": {"abc"}}))
+	a.Len(oauth.AuthCodeExchangeOptions(url.Values{"redirect_uri": {"http://127.0.0.1/cb"}, "code_verifier": {"v"}}), 2)
+}
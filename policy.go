@@ -0,0 +1,92 @@
+package oauth
+
+import "errors"
+
+// ErrForbidden is returned by Policy.Check when the user does not satisfy the
+// policy.
+var ErrForbidden = errors.New("oauth: user is not allowed by the policy")
+
+// Policy decides whether a user is allowed in, typically in the login
+// callback once FetchUser returned:
+//
+//	admin := oauth.RequireAnyGroup("google", "jam-admins@rapidmidiex.com")
+//	if err := admin.Check(user); err != nil {
+//		http.Error(w, err.Error(), http.StatusForbidden)
+//		return
+//	}
+//
+// Group and role names are only unique per provider: anyone can create a
+// GitHub organization or Discord server named like a group elsewhere. The
+// group and role policies therefore only accept users of the given provider.
+type Policy func(User) bool
+
+// Check returns ErrForbidden when the user does not satisfy the policy.
+func (p Policy) Check(user User) error {
+	if !p(user) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// RequireAnyGroup allows users of provider in at least one of the groups.
+func RequireAnyGroup(provider string, groups ...string) Policy {
+	return func(u User) bool { return u.Provider == provider && containsAny(u.Groups, groups) }
+}
+
+// RequireAllGroups allows users of provider in every one of the groups. It
+// allows no one without groups.
+func RequireAllGroups(provider string, groups ...string) Policy {
+	return func(u User) bool { return u.Provider == provider && containsAll(u.Groups, groups) }
+}
+
+// RequireAnyRole allows users of provider with at least one of the roles.
+func RequireAnyRole(provider string, roles ...string) Policy {
+	return func(u User) bool { return u.Provider == provider && containsAny(u.Roles, roles) }
+}
+
+// RequireAllRoles allows users of provider with every one of the roles. It
+// allows no one without roles.
+func RequireAllRoles(provider string, roles ...string) Policy {
+	return func(u User) bool { return u.Provider == provider && containsAll(u.Roles, roles) }
+}
+
+// AllOf allows users satisfying every one of the policies. It allows no one
+// without policies.
+func AllOf(policies ...Policy) Policy {
+	return func(u User) bool {
+		if len(policies) == 0 {
+			return false
+		}
+		for _, p := range policies {
+			if !p(u) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func containsAny(have, want []string) bool {
+	for _, w := range want {
+		for _, h := range have {
+			if h == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// containsAll tells whether have contains every one of want, which must not be
+// empty.
+func containsAll(have, want []string) bool {
+	if len(want) == 0 {
+		return false
+	}
+	for _, w := range want {
+		if !containsAny(have, []string{w}) {
+			return false
+		}
+	}
+	return true
+}
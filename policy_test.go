@@ -0,0 +1,36 @@
+package oauth_test
+
+import (
+	"testing"
+
+	"github.com/rapidmidiex/oauth"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Policy(t *testing.T) {
+	a := assert.New(t)
+
+	user := oauth.User{Provider: "google", Groups: []string{"band", "crew"}, Roles: []string{"drummer"}}
+
+	a.NoError(oauth.RequireAnyGroup("google", "staff", "band").Check(user))
+	a.Equal(oauth.ErrForbidden, oauth.RequireAnyGroup("google", "staff").Check(user))
+	a.NoError(oauth.RequireAllGroups("google", "band", "crew").Check(user))
+	a.Equal(oauth.ErrForbidden, oauth.RequireAllGroups("google", "band", "staff").Check(user))
+	a.NoError(oauth.RequireAnyRole("google", "drummer").Check(user))
+	a.Equal(oauth.ErrForbidden, oauth.RequireAllRoles("google", "drummer", "singer").Check(user))
+
+	a.NoError(oauth.AllOf(oauth.RequireAnyGroup("google", "band"), oauth.RequireAnyRole("google", "drummer")).Check(user))
+	a.Equal(oauth.ErrForbidden, oauth.AllOf(oauth.RequireAnyGroup("google", "band"), oauth.RequireAnyRole("google", "singer")).Check(user))
+	a.Equal(oauth.ErrForbidden, oauth.RequireAnyGroup("google", "band").Check(oauth.User{}))
+
+	// groups of the same name at another provider do not count
+	github := oauth.User{Provider: "github", Groups: []string{"band"}, Roles: []string{"drummer"}}
+	a.Equal(oauth.ErrForbidden, oauth.RequireAnyGroup("google", "band").Check(github))
+	a.Equal(oauth.ErrForbidden, oauth.RequireAllRoles("google", "drummer").Check(github))
+	a.NoError(oauth.RequireAnyGroup("github", "band").Check(github))
+
+	// empty policies allow no one
+	a.Equal(oauth.ErrForbidden, oauth.RequireAllGroups("google").Check(user))
+	a.Equal(oauth.ErrForbidden, oauth.RequireAllRoles("google").Check(user))
+	a.Equal(oauth.ErrForbidden, oauth.AllOf().Check(user))
+}
@@ -20,6 +20,13 @@ type Provider interface {
 	RefreshTokenAvailable() bool                             // Refresh token is provided by auth provider or not
 }
 
+// AuthOptionsProvider is implemented by providers that can add extra
+// parameters to the authorization request they start.
+type AuthOptionsProvider interface {
+	Provider
+	BeginAuthWithOptions(state string, opts ...oauth2.AuthCodeOption) (Session, error)
+}
+
 const NoAuthUrlErrorMessage = "an AuthURL has not been set"
 
 // providers is list of known/available providers.
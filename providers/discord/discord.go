@@ -5,10 +5,12 @@ package discord
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 
 	rmxOAuth "github.com/rapidmidiex/oauth"
 	"golang.org/x/oauth2"
@@ -18,6 +20,9 @@ const (
 	authURL      string = "https://discord.com/api/oauth2/authorize"
 	tokenURL     string = "https://discord.com/api/oauth2/token"
 	userEndpoint string = "https://discord.com/api/users/@me"
+
+	guildsEndpoint      string = "https://discord.com/api/users/@me/guilds"
+	guildMemberEndpoint string = "https://discord.com/api/users/@me/guilds/%s/member"
 )
 
 const (
@@ -64,6 +69,7 @@ type Provider struct {
 	config       *oauth2.Config
 	providerName string
 	permissions  string
+	roleGuilds   []string
 }
 
 // Name gets the name used to retrieve this provider.
@@ -81,6 +87,13 @@ func (p *Provider) SetPermissions(permissions string) {
 	p.permissions = permissions
 }
 
+// SetRoleGuilds sets the guilds whose roles the user has are returned as
+// Roles by FetchUser, which requires ScopeReadGuilds. Discord role IDs are
+// unique across guilds.
+func (p *Provider) SetRoleGuilds(guildIDs ...string) {
+	p.roleGuilds = guildIDs
+}
+
 func (p *Provider) Client() *http.Client {
 	return rmxOAuth.HTTPClientWithFallBack(p.HTTPClient)
 }
@@ -140,7 +153,7 @@ func (p *Provider) FetchUser(session rmxOAuth.Session) (rmxOAuth.User, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return user, fmt.Errorf("%s responded with a %d trying to fetch user information", p.providerName, resp.StatusCode)
+		return user, &rmxOAuth.StatusError{StatusCode: resp.StatusCode, Message: fmt.Sprintf("%s responded with a %d trying to fetch user information", p.providerName, resp.StatusCode)}
 	}
 
 	bits, err := ioutil.ReadAll(resp.Body)
@@ -158,9 +171,82 @@ func (p *Provider) FetchUser(session rmxOAuth.Session) (rmxOAuth.User, error) {
 		return user, err
 	}
 
+	for _, scope := range p.config.Scopes {
+		switch scope {
+		case ScopeGuilds:
+			if user.Groups, err = p.fetchGuilds(s.AccessToken); err != nil {
+				return user, err
+			}
+		case ScopeReadGuilds:
+			if user.Roles, err = p.fetchRoles(s.AccessToken); err != nil {
+				return user, err
+			}
+		}
+	}
+
 	return user, err
 }
 
+// fetchGuilds returns the IDs of the guilds the user is a member of.
+func (p *Provider) fetchGuilds(accessToken string) ([]string, error) {
+	var guilds []struct {
+		ID string `json:"id"`
+	}
+	if err := p.getJSON(guildsEndpoint, accessToken, &guilds); err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(guilds))
+	for _, guild := range guilds {
+		ids = append(ids, guild.ID)
+	}
+	return ids, nil
+}
+
+// fetchRoles returns the IDs of the roles the user has in the role guilds.
+// Guilds the user is not a member of are skipped.
+func (p *Provider) fetchRoles(accessToken string) ([]string, error) {
+	var roles []string
+	for _, guildID := range p.roleGuilds {
+		var member struct {
+			Roles []string `json:"roles"`
+		}
+		err := p.getJSON(fmt.Sprintf(guildMemberEndpoint, url.PathEscape(guildID)), accessToken, &member)
+		if err == errNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, member.Roles...)
+	}
+	return roles, nil
+}
+
+var errNotFound = errors.New("discord: not found")
+
+func (p *Provider) getJSON(endpoint, accessToken string, v interface{}) error {
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	resp, err := p.Client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return json.NewDecoder(resp.Body).Decode(v)
+	case http.StatusNotFound:
+		return errNotFound
+	}
+	return fmt.Errorf("%s responded with a %d trying to fetch %s", p.providerName, resp.StatusCode, req.URL.Path)
+}
+
 func userFromReader(r io.Reader, user *rmxOAuth.User) error {
 	u := struct {
 		Name          string `json:"username"`
@@ -170,6 +256,7 @@ func userFromReader(r io.Reader, user *rmxOAuth.User) error {
 		Discriminator string `json:"discriminator"`
 		Verified      bool   `json:"verified"`
 		ID            string `json:"id"`
+		Locale        string `json:"locale"`
 	}{}
 
 	err := json.NewDecoder(r).Decode(&u)
@@ -192,7 +279,16 @@ func userFromReader(r io.Reader, user *rmxOAuth.User) error {
 
 	user.Name = u.Name
 	user.Email = u.Email
+	user.EmailVerified = u.Email != "" && u.Verified
 	user.UserID = u.ID
+	user.Username = u.Name
+	// Users that did not move to unique usernames are still known by their
+	// name and discriminator, like "drummer#1234".
+	if u.Discriminator != "" && u.Discriminator != "0" {
+		user.Username += "#" + u.Discriminator
+	}
+	user.Locale = u.Locale
+	user.ProfileURL = "https://discord.com/users/" + u.ID
 
 	return nil
 }
@@ -1,6 +1,10 @@
 package discord
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"testing"
 
@@ -52,3 +56,58 @@ func Test_SessionFromJSON(t *testing.T) {
 	a.Equal(s.AuthURL, "https://discord.com/api/oauth2/authorize")
 	a.Equal(s.AccessToken, "1234567890")
 }
+
+func Test_FetchUserGuilds(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.Equal("Bearer 1234567890", r.Header.Get("Authorization"))
+		switch r.URL.Path {
+		case "/api/users/@me":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"id":            "80351110224678912",
+				"username":      "drummer",
+				"discriminator": "1337",
+				"email":         "drummer@example.com",
+				"verified":      true,
+				"locale":        "en-US",
+			})
+		case "/api/users/@me/guilds":
+			json.NewEncoder(w).Encode([]map[string]string{{"id": "guild-1"}, {"id": "guild-2"}})
+		case "/api/users/@me/guilds/guild-1/member":
+			json.NewEncoder(w).Encode(map[string]interface{}{"roles": []string{"role-1", "role-2"}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	p := New("key", "secret", "/foo", ScopeIdentify, ScopeGuilds, ScopeReadGuilds)
+	p.SetRoleGuilds("guild-1", "guild-3")
+	p.HTTPClient = &http.Client{Transport: rewriteTransport(ts.URL)}
+
+	user, err := p.FetchUser(&Session{AccessToken: "1234567890"})
+	a.NoError(err)
+	a.Equal("80351110224678912", user.UserID)
+	a.True(user.EmailVerified)
+	a.Equal("drummer#1337", user.Username)
+	a.Equal("en-US", user.Locale)
+	a.Equal("https://discord.com/users/80351110224678912", user.ProfileURL)
+	a.Equal([]string{"guild-1", "guild-2"}, user.Groups)
+	a.Equal([]string{"role-1", "role-2"}, user.Roles)
+}
+
+// rewriteTransport sends every request to the test server at serverURL.
+func rewriteTransport(serverURL string) http.RoundTripper {
+	target, _ := url.Parse(serverURL)
+	return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		r.URL.Scheme = target.Scheme
+		r.URL.Host = target.Host
+		return http.DefaultTransport.RoundTrip(r)
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
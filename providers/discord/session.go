@@ -31,7 +31,7 @@ func (s Session) GetAuthURL() (string, error) {
 // token to be stored for future use.
 func (s *Session) Authorize(provider rmxOAuth.Provider, params rmxOAuth.Params) (string, error) {
 	p := provider.(*Provider)
-	token, err := p.config.Exchange(context.Background(), params.Get("code"))
+	token, err := p.config.Exchange(context.Background(), params.Get("code"), rmxOAuth.AuthCodeExchangeOptions(params)...)
 	if err != nil {
 		return "", err
 	}
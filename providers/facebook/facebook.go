@@ -124,7 +124,7 @@ func (p *Provider) FetchUser(session rmxOAuth.Session) (rmxOAuth.User, error) {
 	defer response.Body.Close()
 
 	if response.StatusCode != http.StatusOK {
-		return user, fmt.Errorf("%s responded with a %d trying to fetch user information", p.providerName, response.StatusCode)
+		return user, &rmxOAuth.StatusError{StatusCode: response.StatusCode, Message: fmt.Sprintf("%s responded with a %d trying to fetch user information", p.providerName, response.StatusCode)}
 	}
 
 	bits, err := ioutil.ReadAll(response.Body)
@@ -150,6 +150,7 @@ func userFromReader(reader io.Reader, user *rmxOAuth.User) error {
 		FirstName string `json:"first_name"`
 		LastName  string `json:"last_name"`
 		Link      string `json:"link"`
+		Locale    string `json:"locale"` // only when listed in SetCustomFields
 		Picture   struct {
 			Data struct {
 				URL string `json:"url"`
@@ -165,6 +166,8 @@ func userFromReader(reader io.Reader, user *rmxOAuth.User) error {
 		return err
 	}
 
+	// the Graph API neither tells whether the email is verified nor has
+	// usernames, so EmailVerified and Username stay unset
 	user.Name = u.Name
 	user.FirstName = u.FirstName
 	user.LastName = u.LastName
@@ -174,6 +177,8 @@ func userFromReader(reader io.Reader, user *rmxOAuth.User) error {
 	user.AvatarURL = u.Picture.Data.URL
 	user.UserID = u.ID
 	user.Location = u.Location.Name
+	user.Locale = u.Locale
+	user.ProfileURL = u.Link
 
 	return err
 }
@@ -20,11 +20,12 @@ type Provider struct {
 
 // Session is used only for testing.
 type Session struct {
-	ID          string
-	Name        string
-	Email       string
-	AuthURL     string
-	AccessToken string
+	ID            string
+	Name          string
+	Email         string
+	EmailVerified bool
+	AuthURL       string
+	AccessToken   string
 }
 
 // Name is used only for testing.
@@ -55,11 +56,12 @@ func (p *Provider) BeginAuth(state string) (rmxOAuth.Session, error) {
 func (p *Provider) FetchUser(session rmxOAuth.Session) (rmxOAuth.User, error) {
 	sess := session.(*Session)
 	user := rmxOAuth.User{
-		UserID:      sess.ID,
-		Name:        sess.Name,
-		Email:       sess.Email,
-		Provider:    p.Name(),
-		AccessToken: sess.AccessToken,
+		UserID:        sess.ID,
+		Name:          sess.Name,
+		Email:         sess.Email,
+		EmailVerified: sess.EmailVerified,
+		Provider:      p.Name(),
+		AccessToken:   sess.AccessToken,
 	}
 
 	if user.AccessToken == "" {
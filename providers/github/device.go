@@ -0,0 +1,52 @@
+package github
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	rmxOAuth "github.com/rapidmidiex/oauth"
+	"golang.org/x/oauth2"
+)
+
+var _ rmxOAuth.DeviceFlowProvider = &Provider{}
+
+// BeginDeviceAuth starts the device flow for clients that cannot receive the
+// OAuth callback, such as CLIs. The device flow must be enabled in the
+// settings of the GitHub OAuth app.
+// See https://docs.github.com/en/apps/oauth-apps/building-oauth-apps/authorizing-oauth-apps#device-flow
+func (p *Provider) BeginDeviceAuth(ctx context.Context) (*rmxOAuth.DeviceAuth, error) {
+	body, err := rmxOAuth.PostForm(ctx, p.Client(), p.deviceURL, nil, url.Values{
+		"client_id": {p.ClientKey},
+		"scope":     {strings.Join(p.config.Scopes, " ")},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rmxOAuth.ParseDeviceAuthResponse(body, rmxOAuth.ClockWithFallBack(p.Clock).Now())
+}
+
+// AuthorizeDevice polls GitHub until the user has entered the user code and
+// returns a Session ready for FetchUser.
+func (p *Provider) AuthorizeDevice(ctx context.Context, da *rmxOAuth.DeviceAuth) (rmxOAuth.Session, error) {
+	token, err := rmxOAuth.PollDeviceToken(ctx, p.Clock, da, func() (*oauth2.Token, error) {
+		body, err := rmxOAuth.PostForm(ctx, p.Client(), p.config.Endpoint.TokenURL, nil, url.Values{
+			"client_id":   {p.ClientKey},
+			"device_code": {da.DeviceCode},
+			"grant_type":  {rmxOAuth.DeviceCodeGrantType},
+		})
+		if err != nil {
+			return nil, err
+		}
+		// GitHub reports pending authorizations with a 200 status, which
+		// ParseTokenResponse turns into an *rmxOAuth.Error
+		return rmxOAuth.ParseTokenResponse(body, rmxOAuth.ClockWithFallBack(p.Clock).Now())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Session{
+		AccessToken: token.AccessToken,
+	}, nil
+}
@@ -0,0 +1,58 @@
+package github_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rapidmidiex/oauth"
+	"github.com/rapidmidiex/oauth/providers/github"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test_DeviceFlow is not parallel as it changes github.DeviceAuthURL.
+func Test_DeviceFlow(t *testing.T) {
+	a := assert.New(t)
+
+	polls := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login/device/code", func(w http.ResponseWriter, r *http.Request) {
+		a.Equal("client", r.PostFormValue("client_id"))
+		a.Equal("user", r.PostFormValue("scope"))
+		fmt.Fprint(w, `{"device_code":"dc","user_code":"WDJB-MJHT","verification_uri":"https://github.com/login/device","expires_in":900,"interval":5}`)
+	})
+	mux.HandleFunc("/login/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		if polls == 1 {
+			fmt.Fprint(w, `{"error":"authorization_pending","error_description":"The authorization request is still pending."}`)
+			return
+		}
+		fmt.Fprint(w, `{"access_token":"gho_token","token_type":"bearer","scope":"user"}`)
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	defer func(deviceAuthURL string) { github.DeviceAuthURL = deviceAuthURL }(github.DeviceAuthURL)
+	github.DeviceAuthURL = ts.URL + "/login/device/code"
+
+	p := github.NewCustomisedURL("client", "secret", "/foo", ts.URL+"/login/oauth/authorize", ts.URL+"/login/oauth/access_token", ts.URL+"/user", ts.URL+"/user/emails", "user")
+	// the URL is taken when the provider is created
+	github.DeviceAuthURL = "https://github.invalid/login/device/code"
+	now := time.Now()
+	p.Clock = oauth.ClockFunc(func() time.Time { return now })
+
+	da, err := p.BeginDeviceAuth(context.Background())
+	a.NoError(err)
+	a.Equal("WDJB-MJHT", da.UserCode)
+	a.Equal(5*time.Second, da.Interval)
+	a.Equal(now.Add(900*time.Second), da.ExpiresAt)
+
+	da.Interval = time.Millisecond
+	session, err := p.AuthorizeDevice(context.Background(), da)
+	a.NoError(err)
+	a.Equal(2, polls)
+	a.Equal("gho_token", session.(*github.Session).AccessToken)
+}
@@ -26,11 +26,13 @@ import (
 //	github.TokenURL = "https://github.acme.com/login/oauth/access_token
 //	github.ProfileURL = "https://github.acme.com/api/v3/user
 //	github.EmailURL = "https://github.acme.com/api/v3/user/emails
+//	github.DeviceAuthURL = "https://github.acme.com/login/device/code
 var (
-	AuthURL    = "https://github.com/login/oauth/authorize"
-	TokenURL   = "https://github.com/login/oauth/access_token"
-	ProfileURL = "https://api.github.com/user"
-	EmailURL   = "https://api.github.com/user/emails"
+	AuthURL       = "https://github.com/login/oauth/authorize"
+	TokenURL      = "https://github.com/login/oauth/access_token"
+	ProfileURL    = "https://api.github.com/user"
+	EmailURL      = "https://api.github.com/user/emails"
+	DeviceAuthURL = "https://github.com/login/device/code"
 )
 
 var (
@@ -54,6 +56,7 @@ func NewCustomisedURL(clientKey, secret, callbackURL, authURL, tokenURL, profile
 		providerName: "github",
 		profileURL:   profileURL,
 		emailURL:     emailURL,
+		deviceURL:    DeviceAuthURL,
 	}
 	p.config = newConfig(p, authURL, tokenURL, scopes)
 	return p
@@ -69,6 +72,11 @@ type Provider struct {
 	providerName string
 	profileURL   string
 	emailURL     string
+	deviceURL    string
+
+	// Clock is used for the expiry of device authorizations. It defaults to
+	// the system clock.
+	Clock rmxOAuth.Clock
 }
 
 // Name is the name used to retrieve this provider later.
@@ -98,6 +106,8 @@ func (p *Provider) BeginAuth(state string) (rmxOAuth.Session, error) {
 }
 
 // FetchUser will go to Github and access basic information about the user.
+// With the read:org scope, the user's organizations and teams are returned as
+// Groups.
 func (p *Provider) FetchUser(session rmxOAuth.Session) (rmxOAuth.User, error) {
 	sess := session.(*Session)
 	user := rmxOAuth.User{
@@ -123,7 +133,7 @@ func (p *Provider) FetchUser(session rmxOAuth.Session) (rmxOAuth.User, error) {
 	defer response.Body.Close()
 
 	if response.StatusCode != http.StatusOK {
-		return user, fmt.Errorf("GitHub API responded with a %d trying to fetch user information", response.StatusCode)
+		return user, &rmxOAuth.StatusError{StatusCode: response.StatusCode, Message: fmt.Sprintf("GitHub API responded with a %d trying to fetch user information", response.StatusCode)}
 	}
 
 	bits, err := ioutil.ReadAll(response.Body)
@@ -148,10 +158,19 @@ func (p *Provider) FetchUser(session rmxOAuth.Session) (rmxOAuth.User, error) {
 				if err != nil {
 					return user, err
 				}
+				user.EmailVerified = true
 				break
 			}
 		}
 	}
+
+	for _, scope := range p.config.Scopes {
+		switch strings.TrimSpace(scope) {
+		case "read:org", "write:org", "admin:org":
+			user.Groups, err = getGroups(p, sess)
+			return user, err
+		}
+	}
 	return user, err
 }
 
@@ -164,6 +183,7 @@ func userFromReader(reader io.Reader, user *rmxOAuth.User) error {
 		Login    string `json:"login"`
 		Picture  string `json:"avatar_url"`
 		Location string `json:"location"`
+		HTMLURL  string `json:"html_url"`
 	}{}
 
 	err := json.NewDecoder(reader).Decode(&u)
@@ -173,11 +193,15 @@ func userFromReader(reader io.Reader, user *rmxOAuth.User) error {
 
 	user.Name = u.Name
 	user.NickName = u.Login
+	user.Username = u.Login
 	user.Email = u.Email
+	// GitHub only lets users make a verified address their public email.
+	user.EmailVerified = u.Email != ""
 	user.Description = u.Bio
 	user.AvatarURL = u.Picture
 	user.UserID = strconv.Itoa(u.ID)
 	user.Location = u.Location
+	user.ProfileURL = u.HTMLURL
 
 	return err
 }
@@ -215,6 +239,87 @@ func getPrivateMail(p *Provider, sess *Session) (email string, err error) {
 	return email, ErrNoVerifiedGitHubPrimaryEmail
 }
 
+// getGroups returns the logins of the user's organizations followed by their
+// teams as "org/team-slug". It needs the read:org scope.
+func getGroups(p *Provider, sess *Session) ([]string, error) {
+	var groups []string
+
+	err := getPages(p, sess, p.profileURL+"/orgs", func(r io.Reader) error {
+		var page []struct {
+			Login string `json:"login"`
+		}
+		if err := json.NewDecoder(r).Decode(&page); err != nil {
+			return err
+		}
+		for _, org := range page {
+			groups = append(groups, org.Login)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = getPages(p, sess, p.profileURL+"/teams", func(r io.Reader) error {
+		var page []struct {
+			Slug         string `json:"slug"`
+			Organization struct {
+				Login string `json:"login"`
+			} `json:"organization"`
+		}
+		if err := json.NewDecoder(r).Decode(&page); err != nil {
+			return err
+		}
+		for _, team := range page {
+			groups = append(groups, team.Organization.Login+"/"+team.Slug)
+		}
+		return nil
+	})
+	return groups, err
+}
+
+// getPages GETs every page of a paginated GitHub API list, following the
+// next links of the Link header.
+func getPages(p *Provider, sess *Session, url string, decode func(io.Reader) error) error {
+	url += "?per_page=100"
+	for url != "" {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Add("Authorization", "Bearer "+sess.AccessToken)
+		response, err := p.Client().Do(req)
+		if err != nil {
+			return err
+		}
+
+		if response.StatusCode != http.StatusOK {
+			response.Body.Close()
+			return fmt.Errorf("GitHub API responded with a %d trying to fetch %s", response.StatusCode, req.URL.Path)
+		}
+		err = decode(response.Body)
+		response.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		url = nextPage(response.Header.Get("Link"))
+	}
+	return nil
+}
+
+// nextPage returns the rel="next" URL of a Link header.
+func nextPage(link string) string {
+	for _, part := range strings.Split(link, ",") {
+		segments := strings.Split(part, ";")
+		if len(segments) < 2 || strings.TrimSpace(segments[1]) != `rel="next"` {
+			continue
+		}
+		return strings.Trim(strings.TrimSpace(segments[0]), "<>")
+	}
+	return ""
+}
+
 func newConfig(provider *Provider, authURL, tokenURL string, scopes []string) *oauth2.Config {
 	c := &oauth2.Config{
 		ClientID:     provider.ClientKey,
@@ -1,7 +1,10 @@
 package github_test
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
 
@@ -64,6 +67,39 @@ func Test_SessionFromJSON(t *testing.T) {
 	a.Equal(session.AccessToken, "1234567890")
 }
 
+func Test_FetchUserGroups(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.Equal("Bearer 1234567890", r.Header.Get("Authorization"))
+		switch r.URL.Path + "?" + r.URL.RawQuery {
+		case "/user?":
+			json.NewEncoder(w).Encode(map[string]interface{}{"id": 1, "login": "drummer", "email": "drummer@example.com", "html_url": "https://github.com/drummer"})
+		case "/user/orgs?per_page=100":
+			w.Header().Set("Link", fmt.Sprintf(`<%s/user/orgs?per_page=100&page=2>; rel="next", <%s/user/orgs?per_page=100&page=2>; rel="last"`, ts.URL, ts.URL))
+			json.NewEncoder(w).Encode([]map[string]interface{}{{"login": "rapidmidiex"}})
+		case "/user/orgs?per_page=100&page=2":
+			json.NewEncoder(w).Encode([]map[string]interface{}{{"login": "jam-org"}})
+		case "/user/teams?per_page=100":
+			json.NewEncoder(w).Encode([]map[string]interface{}{{"slug": "rhythm", "organization": map[string]string{"login": "rapidmidiex"}}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	provider := github.NewCustomisedURL("key", "secret", "/foo", ts.URL+"/authorize", ts.URL+"/token", ts.URL+"/user", ts.URL+"/user/emails", "read:org")
+	user, err := provider.FetchUser(&github.Session{AccessToken: "1234567890"})
+	a.NoError(err)
+	a.Equal("drummer@example.com", user.Email)
+	a.True(user.EmailVerified)
+	a.Equal("drummer", user.Username)
+	a.Equal("https://github.com/drummer", user.ProfileURL)
+	a.Equal([]string{"rapidmidiex", "jam-org", "rapidmidiex/rhythm"}, user.Groups)
+}
+
 func githubProvider() *github.Provider {
 	return github.New(os.Getenv("GITHUB_KEY"), os.Getenv("GITHUB_SECRET"), "/foo", "user")
 }
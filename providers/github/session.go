@@ -25,7 +25,7 @@ func (s Session) GetAuthURL() (string, error) {
 // Authorize the session with GitHub and return the access token to be stored for future use.
 func (s *Session) Authorize(provider rmxOAuth.Provider, params rmxOAuth.Params) (string, error) {
 	p := provider.(*Provider)
-	token, err := p.config.Exchange(rmxOAuth.ContextForClient(p.Client()), params.Get("code"))
+	token, err := p.config.Exchange(rmxOAuth.ContextForClient(p.Client()), params.Get("code"), rmxOAuth.AuthCodeExchangeOptions(params)...)
 	if err != nil {
 		return "", err
 	}
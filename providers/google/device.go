@@ -0,0 +1,59 @@
+package google
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	rmxOAuth "github.com/rapidmidiex/oauth"
+	"golang.org/x/oauth2"
+)
+
+// DeviceAuthURL is Google's device authorization endpoint. Change it before
+// calling New.
+var DeviceAuthURL = "https://oauth2.googleapis.com/device/code"
+
+var _ rmxOAuth.DeviceFlowProvider = &Provider{}
+
+// BeginDeviceAuth starts the device flow for clients that cannot receive the
+// OAuth callback. Google only allows it for OAuth clients of the "TVs and
+// Limited Input devices" type, and only for a limited set of scopes.
+// See https://developers.google.com/identity/protocols/oauth2/limited-input-device
+func (p *Provider) BeginDeviceAuth(ctx context.Context) (*rmxOAuth.DeviceAuth, error) {
+	body, err := rmxOAuth.PostForm(ctx, p.Client(), p.deviceURL, nil, url.Values{
+		"client_id": {p.ClientKey},
+		"scope":     {strings.Join(p.config.Scopes, " ")},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rmxOAuth.ParseDeviceAuthResponse(body, rmxOAuth.ClockWithFallBack(p.Clock).Now())
+}
+
+// AuthorizeDevice polls Google until the user has approved the request and
+// returns a Session ready for FetchUser.
+func (p *Provider) AuthorizeDevice(ctx context.Context, da *rmxOAuth.DeviceAuth) (rmxOAuth.Session, error) {
+	token, err := rmxOAuth.PollDeviceToken(ctx, p.Clock, da, func() (*oauth2.Token, error) {
+		body, err := rmxOAuth.PostForm(ctx, p.Client(), p.config.Endpoint.TokenURL, nil, url.Values{
+			"client_id":     {p.ClientKey},
+			"client_secret": {p.Secret},
+			"device_code":   {da.DeviceCode},
+			"grant_type":    {rmxOAuth.DeviceCodeGrantType},
+		})
+		if err != nil {
+			return nil, err
+		}
+		return rmxOAuth.ParseTokenResponse(body, rmxOAuth.ClockWithFallBack(p.Clock).Now())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Session{
+		AccessToken:  token.AccessToken,
+		RefreshToken: token.RefreshToken,
+		ExpiresAt:    token.Expiry,
+	}
+	s.IDToken, _ = token.Extra("id_token").(string)
+	return s, nil
+}
@@ -0,0 +1,40 @@
+package google_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rapidmidiex/oauth"
+	"github.com/rapidmidiex/oauth/providers/google"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test_BeginDeviceAuth is not parallel as it changes google.DeviceAuthURL.
+func Test_BeginDeviceAuth(t *testing.T) {
+	a := assert.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.Equal("email", r.PostFormValue("scope"))
+		fmt.Fprint(w, `{"device_code":"dc","user_code":"GQVQ-JKEC","verification_url":"https://www.google.com/device","expires_in":1800,"interval":5}`)
+	}))
+	defer ts.Close()
+
+	defer func(deviceAuthURL string) { google.DeviceAuthURL = deviceAuthURL }(google.DeviceAuthURL)
+	google.DeviceAuthURL = ts.URL
+
+	p := googleProvider()
+	// the URL is taken when the provider is created
+	google.DeviceAuthURL = "https://google.invalid/device/code"
+	now := time.Now()
+	p.Clock = oauth.ClockFunc(func() time.Time { return now })
+
+	da, err := p.BeginDeviceAuth(context.Background())
+	a.NoError(err)
+	a.Equal("GQVQ-JKEC", da.UserCode)
+	a.Equal("https://www.google.com/device", da.VerificationURI)
+	a.Equal(now.Add(1800*time.Second), da.ExpiresAt)
+}
@@ -14,7 +14,14 @@ import (
 	"golang.org/x/oauth2"
 )
 
-const endpointProfile string = "https://www.googleapis.com/oauth2/v2/userinfo"
+const (
+	endpointProfile string = "https://www.googleapis.com/oauth2/v2/userinfo"
+	endpointGroups  string = "https://cloudidentity.googleapis.com/v1/groups/-/memberships:searchTransitiveGroups"
+)
+
+// ScopeGroupsReadOnly lets FetchUser return the user's Google Workspace
+// groups, through the Cloud Identity API, as Groups.
+const ScopeGroupsReadOnly = "https://www.googleapis.com/auth/cloud-identity.groups.readonly"
 
 // New creates a new Google provider, and sets up important connection details.
 // You should always call `google.New` to get a new Provider. Never try to create
@@ -25,6 +32,7 @@ func New(clientKey, secret, callbackURL string, scopes ...string) *Provider {
 		Secret:       secret,
 		CallbackURL:  callbackURL,
 		providerName: "google",
+		deviceURL:    DeviceAuthURL,
 
 		// We can get a refresh token from Google by this option.
 		// See https://developers.google.com/identity/protocols/oauth2/openid-connect#access-type-param
@@ -45,6 +53,11 @@ type Provider struct {
 	config          *oauth2.Config
 	authCodeOptions []oauth2.AuthCodeOption
 	providerName    string
+	deviceURL       string
+
+	// Clock is used for the expiry of device authorizations. It defaults to
+	// the system clock.
+	Clock rmxOAuth.Clock
 }
 
 // Name is the name used to retrieve this provider later.
@@ -67,7 +80,14 @@ func (p *Provider) Debug(debug bool) {}
 
 // BeginAuth asks Google for an authentication endpoint.
 func (p *Provider) BeginAuth(state string) (rmxOAuth.Session, error) {
-	url := p.config.AuthCodeURL(state, p.authCodeOptions...)
+	return p.BeginAuthWithOptions(state)
+}
+
+// BeginAuthWithOptions is like BeginAuth, adding opts to the authorization
+// request.
+func (p *Provider) BeginAuthWithOptions(state string, opts ...oauth2.AuthCodeOption) (rmxOAuth.Session, error) {
+	opts = append(append([]oauth2.AuthCodeOption{}, p.authCodeOptions...), opts...)
+	url := p.config.AuthCodeURL(state, opts...)
 	session := &Session{
 		AuthURL: url,
 	}
@@ -75,13 +95,15 @@ func (p *Provider) BeginAuth(state string) (rmxOAuth.Session, error) {
 }
 
 type googleUser struct {
-	ID        string `json:"id"`
-	Email     string `json:"email"`
-	Name      string `json:"name"`
-	FirstName string `json:"given_name"`
-	LastName  string `json:"family_name"`
-	Link      string `json:"link"`
-	Picture   string `json:"picture"`
+	ID            string `json:"id"`
+	Email         string `json:"email"`
+	VerifiedEmail bool   `json:"verified_email"`
+	Name          string `json:"name"`
+	FirstName     string `json:"given_name"`
+	LastName      string `json:"family_name"`
+	Link          string `json:"link"`
+	Picture       string `json:"picture"`
+	Locale        string `json:"locale"`
 }
 
 // FetchUser will go to Google and access basic information about the user.
@@ -107,7 +129,7 @@ func (p *Provider) FetchUser(session rmxOAuth.Session) (rmxOAuth.User, error) {
 	defer response.Body.Close()
 
 	if response.StatusCode != http.StatusOK {
-		return user, fmt.Errorf("%s responded with a %d trying to fetch user information", p.providerName, response.StatusCode)
+		return user, &rmxOAuth.StatusError{StatusCode: response.StatusCode, Message: fmt.Sprintf("%s responded with a %d trying to fetch user information", p.providerName, response.StatusCode)}
 	}
 
 	responseBytes, err := ioutil.ReadAll(response.Body)
@@ -126,16 +148,78 @@ func (p *Provider) FetchUser(session rmxOAuth.Session) (rmxOAuth.User, error) {
 	user.LastName = u.LastName
 	user.NickName = u.Name
 	user.Email = u.Email
+	user.EmailVerified = u.VerifiedEmail
 	user.AvatarURL = u.Picture
 	user.UserID = u.ID
+	user.Locale = u.Locale
+	user.ProfileURL = u.Link
 	// Google provides other useful fields such as 'hd'; get them from RawData
 	if err := json.Unmarshal(responseBytes, &user.RawData); err != nil {
 		return user, err
 	}
 
+	for _, scope := range p.config.Scopes {
+		if scope == ScopeGroupsReadOnly && user.Email != "" {
+			user.Groups, err = p.fetchGroups(sess.AccessToken, user.Email)
+			return user, err
+		}
+	}
 	return user, nil
 }
 
+// celEscaper escapes a value quoted in single quotes in a CEL query.
+var celEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+// fetchGroups returns the email addresses of the Google Workspace groups the
+// user is a member of, directly or through other groups.
+// See https://cloud.google.com/identity/docs/how-to/query-memberships
+func (p *Provider) fetchGroups(accessToken, email string) ([]string, error) {
+	var groups []string
+
+	query := url.Values{
+		"query":    {fmt.Sprintf("member_key_id == '%s' && 'cloudidentity.googleapis.com/groups.discussion_forum' in labels", celEscaper.Replace(email))},
+		"pageSize": {"500"},
+	}
+	for {
+		req, err := http.NewRequest("GET", endpointGroups+"?"+query.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+
+		response, err := p.Client().Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		var page struct {
+			Memberships []struct {
+				GroupKey struct {
+					ID string `json:"id"`
+				} `json:"groupKey"`
+			} `json:"memberships"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		if response.StatusCode != http.StatusOK {
+			response.Body.Close()
+			return nil, fmt.Errorf("%s responded with a %d trying to fetch groups", p.providerName, response.StatusCode)
+		}
+		err = json.NewDecoder(response.Body).Decode(&page)
+		response.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, membership := range page.Memberships {
+			groups = append(groups, membership.GroupKey.ID)
+		}
+		if page.NextPageToken == "" {
+			return groups, nil
+		}
+		query.Set("pageToken", page.NextPageToken)
+	}
+}
+
 func newConfig(provider *Provider, scopes []string) *oauth2.Config {
 	c := &oauth2.Config{
 		ClientID:     provider.ClientKey,
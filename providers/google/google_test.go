@@ -1,8 +1,13 @@
 package google_test
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"strings"
 	"testing"
 
 	rmxOAuth "github.com/rapidmidiex/oauth"
@@ -118,3 +123,86 @@ func Test_SessionFromJSON(t *testing.T) {
 func googleProvider() *google.Provider {
 	return google.New(os.Getenv("GOOGLE_KEY"), os.Getenv("GOOGEL_SECRET"), "/foo")
 }
+
+func Test_FetchUserGroups(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth2/v2/userinfo":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"id":             "1",
+				"email":          "drummer@example.com",
+				"verified_email": true,
+				"locale":         "en-GB",
+				"link":           "https://plus.google.com/1",
+			})
+		case "/v1/groups/-/memberships:searchTransitiveGroups":
+			a.Equal("Bearer 1234567890", r.Header.Get("Authorization"))
+			a.Contains(r.URL.Query().Get("query"), "member_key_id == 'drummer@example.com'")
+			if r.URL.Query().Get("pageToken") == "" {
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"memberships":   []interface{}{map[string]interface{}{"groupKey": map[string]string{"id": "band@example.com"}}},
+					"nextPageToken": "next",
+				})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"memberships": []interface{}{map[string]interface{}{"groupKey": map[string]string{"id": "crew@example.com"}}},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	provider := google.New("key", "secret", "/foo", "email", google.ScopeGroupsReadOnly)
+	provider.HTTPClient = &http.Client{Transport: rewriteTransport(ts.URL)}
+
+	user, err := provider.FetchUser(&google.Session{AccessToken: "1234567890"})
+	a.NoError(err)
+	a.Equal("1", user.UserID)
+	a.True(user.EmailVerified)
+	a.Equal("en-GB", user.Locale)
+	a.Equal("https://plus.google.com/1", user.ProfileURL)
+	a.Equal([]string{"band@example.com", "crew@example.com"}, user.Groups)
+}
+
+func Test_FetchUserGroups_EscapesEmail(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	var query string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth2/v2/userinfo":
+			json.NewEncoder(w).Encode(map[string]interface{}{"id": "1", "email": `o'brien\' || true || '@example.com`})
+		case "/v1/groups/-/memberships:searchTransitiveGroups":
+			query = r.URL.Query().Get("query")
+			json.NewEncoder(w).Encode(map[string]interface{}{})
+		}
+	}))
+	defer ts.Close()
+
+	provider := google.New("key", "secret", "/foo", "email", google.ScopeGroupsReadOnly)
+	provider.HTTPClient = &http.Client{Transport: rewriteTransport(ts.URL)}
+
+	_, err := provider.FetchUser(&google.Session{AccessToken: "1234567890"})
+	a.NoError(err)
+	a.True(strings.HasPrefix(query, `member_key_id == 'o\'brien\\\' || true || \'@example.com' && `), query)
+}
+
+// rewriteTransport sends every request to the test server at serverURL.
+func rewriteTransport(serverURL string) http.RoundTripper {
+	target, _ := url.Parse(serverURL)
+	return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		r.URL.Scheme = target.Scheme
+		r.URL.Host = target.Host
+		return http.DefaultTransport.RoundTrip(r)
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
@@ -0,0 +1,143 @@
+package openidConnect
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	// backChannelLogoutEvent is the member of the events claim identifying a
+	// Logout Token.
+	backChannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+	sessionIDClaim = "sid"
+	eventsClaim    = "events"
+	nonceClaim     = "nonce"
+	jwtIDClaim     = "jti"
+)
+
+// SessionTerminator ends local sessions when the OpenID provider reports that
+// the user has logged out. Either sub or sid may be empty; when sid is set only
+// the sessions established with that provider session must be ended, otherwise
+// every session of the subject must be.
+type SessionTerminator interface {
+	TerminateSessions(ctx context.Context, sub, sid string) error
+}
+
+// SessionTerminatorFunc adapts an ordinary function to the SessionTerminator
+// interface.
+type SessionTerminatorFunc func(ctx context.Context, sub, sid string) error
+
+// TerminateSessions calls f(ctx, sub, sid).
+func (f SessionTerminatorFunc) TerminateSessions(ctx context.Context, sub, sid string) error {
+	return f(ctx, sub, sid)
+}
+
+// LogoutToken holds the validated claims of a back-channel Logout Token.
+type LogoutToken struct {
+	Issuer    string
+	Subject   string
+	SessionID string
+	JWTID     string
+	IssuedAt  time.Time
+}
+
+// ValidateLogoutToken verifies the signature and claims of a Logout Token as
+// required by Back-Channel Logout 1.0.
+// See https://openid.net/specs/openid-connect-backchannel-1_0.html#Validation
+func (p *Provider) ValidateLogoutToken(token string) (*LogoutToken, error) {
+	_, claims, err := p.verifyJWT(token, p.OpenIDConfig.IDTokenSigningAlgValuesSupported)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.validateIssuerAndAudience(claims); err != nil {
+		return nil, err
+	}
+
+	now := p.now()
+	iat, ok := claims[issuedAtClaim].(float64)
+	if !ok {
+		return nil, errors.New("logout token does not contain an iat claim")
+	}
+	issuedAt := time.Unix(int64(iat), 0)
+	if issuedAt.Add(-p.ClockSkew).After(now) {
+		return nil, errors.New("logout token was issued in the future")
+	}
+	if exp, ok := claims[expiryClaim].(float64); ok {
+		if time.Unix(int64(exp), 0).Add(p.ClockSkew).Before(now) {
+			return nil, errors.New("logout token is expired")
+		}
+	}
+
+	events, ok := claims[eventsClaim].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("logout token does not contain an events claim")
+	}
+	if _, ok := events[backChannelLogoutEvent].(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("logout token events claim does not contain %s", backChannelLogoutEvent)
+	}
+
+	if _, ok := claims[nonceClaim]; ok {
+		return nil, errors.New("logout token must not contain a nonce claim")
+	}
+
+	logoutToken := &LogoutToken{
+		Issuer:    getClaimValue(claims, []string{issuerClaim}),
+		Subject:   getClaimValue(claims, []string{subjectClaim}),
+		SessionID: getClaimValue(claims, []string{sessionIDClaim}),
+		JWTID:     getClaimValue(claims, []string{jwtIDClaim}),
+		IssuedAt:  issuedAt,
+	}
+	if logoutToken.Subject == "" && logoutToken.SessionID == "" {
+		return nil, errors.New("logout token contains neither a sub nor a sid claim")
+	}
+	return logoutToken, nil
+}
+
+// BackChannelLogoutHandler receives Logout Tokens POSTed by the OpenID provider
+// and ends the matching local sessions through terminator.
+// See https://openid.net/specs/openid-connect-backchannel-1_0.html#BCRequest
+func (p *Provider) BackChannelLogoutHandler(terminator SessionTerminator) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		token := r.PostFormValue("logout_token")
+		if token == "" {
+			writeLogoutError(w, "missing logout_token")
+			return
+		}
+
+		logoutToken, err := p.ValidateLogoutToken(token)
+		if err != nil {
+			writeLogoutError(w, err.Error())
+			return
+		}
+
+		if err := terminator.TerminateSessions(r.Context(), logoutToken.Subject, logoutToken.SessionID); err != nil {
+			writeLogoutError(w, err.Error())
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+func writeLogoutError(w http.ResponseWriter, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":             "invalid_request",
+		"error_description": description,
+	})
+}
@@ -0,0 +1,134 @@
+package openidConnect
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	rmxOAuth "github.com/rapidmidiex/oauth"
+	"github.com/rapidmidiex/oauth/internal/jose"
+	"github.com/stretchr/testify/assert"
+)
+
+var signingKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+
+func Test_ValidateLogoutToken(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	provider, now := jwksProvider(t)
+
+	logoutToken, err := provider.ValidateLogoutToken(signJWT(t, logoutClaims(now)))
+	a.NoError(err)
+	a.Equal("user-1", logoutToken.Subject)
+	a.Equal("session-1", logoutToken.SessionID)
+
+	invalid := []struct {
+		name   string
+		mutate func(map[string]interface{})
+	}{
+		{"nonce", func(c map[string]interface{}) { c["nonce"] = "n" }},
+		{"events", func(c map[string]interface{}) { delete(c, "events") }},
+		{"subject", func(c map[string]interface{}) { delete(c, "sub"); delete(c, "sid") }},
+		{"audience", func(c map[string]interface{}) { c["aud"] = "someone-else" }},
+		{"issued at", func(c map[string]interface{}) { c["iat"] = float64(now.Add(time.Hour).Unix()) }},
+	}
+	for _, tc := range invalid {
+		claims := logoutClaims(now)
+		tc.mutate(claims)
+		_, err := provider.ValidateLogoutToken(signJWT(t, claims))
+		a.Error(err, tc.name)
+	}
+
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	forged, _ := jose.Sign(jose.Header{Alg: "RS256", Kid: "test-key"}, logoutClaims(now), other)
+	_, err = provider.ValidateLogoutToken(forged)
+	a.Equal(jose.ErrInvalidSignature, err)
+}
+
+func Test_BackChannelLogoutHandler(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	provider, now := jwksProvider(t)
+
+	var gotSub, gotSid string
+	handler := provider.BackChannelLogoutHandler(SessionTerminatorFunc(func(ctx context.Context, sub, sid string) error {
+		gotSub, gotSid = sub, sid
+		return nil
+	}))
+
+	form := url.Values{"logout_token": {signJWT(t, logoutClaims(now))}}
+	r := httptest.NewRequest(http.MethodPost, "/backchannel-logout", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal("no-store", w.Header().Get("Cache-Control"))
+	a.Equal("user-1", gotSub)
+	a.Equal("session-1", gotSid)
+
+	r = httptest.NewRequest(http.MethodPost, "/backchannel-logout", strings.NewReader("logout_token=garbage"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	a.Equal(http.StatusBadRequest, w.Code)
+	a.Contains(w.Body.String(), "invalid_request")
+}
+
+func logoutClaims(now time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"iss": "https://idp.example.com",
+		"aud": "client",
+		"iat": float64(now.Unix()),
+		"exp": float64(now.Add(2 * time.Minute).Unix()),
+		"jti": "logout-1",
+		"sub": "user-1",
+		"sid": "session-1",
+		"events": map[string]interface{}{
+			"http://schemas.openid.net/event/backchannel-logout": map[string]interface{}{},
+		},
+	}
+}
+
+// jwksProvider returns a provider whose jwks_uri serves the public half of
+// signingKey, and the fixed time its clock reports.
+func jwksProvider(t *testing.T) (*Provider, time.Time) {
+	jwk, _ := jose.NewJWK(&signingKey.PublicKey, "test-key")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jose.JWKS{Keys: []jose.JWK{*jwk}})
+	}))
+	t.Cleanup(ts.Close)
+
+	now := time.Unix(1700000000, 0)
+	provider, _ := NewCustomisedURL(
+		"client",
+		"secret",
+		"http://localhost/foo",
+		"https://idp.example.com/auth",
+		"https://idp.example.com/token",
+		"https://idp.example.com",
+		"",
+		"",
+	)
+	provider.OpenIDConfig.JWKSURI = ts.URL
+	provider.Clock = rmxOAuth.ClockFunc(func() time.Time { return now })
+	return provider, now
+}
+
+func signJWT(t *testing.T, claims map[string]interface{}) string {
+	token, err := jose.Sign(jose.Header{Alg: "RS256", Kid: "test-key"}, claims, signingKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
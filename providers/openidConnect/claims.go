@@ -0,0 +1,100 @@
+package openidConnect
+
+import (
+	"strconv"
+	"strings"
+)
+
+// claimValueSeparator joins the elements of array claims mapped to a single
+// string field.
+const claimValueSeparator = ", "
+
+// lookupClaim finds the value of a claim mapping. A mapping is either a claim
+// name, a dotted path into nested objects such as "realm_access.roles", or a
+// JSON pointer such as "/address/locality". A claim whose name contains dots,
+// like namespaced "https://example.com/roles" claims, is matched by its name
+// first.
+func lookupClaim(data map[string]interface{}, path string) (interface{}, bool) {
+	if value, ok := data[path]; ok {
+		return value, true
+	}
+
+	var segments []string
+	switch {
+	case strings.HasPrefix(path, "/"):
+		// RFC 6901
+		for _, segment := range strings.Split(path[1:], "/") {
+			segment = strings.ReplaceAll(segment, "~1", "/")
+			segments = append(segments, strings.ReplaceAll(segment, "~0", "~"))
+		}
+	case strings.Contains(path, "."):
+		segments = strings.Split(path, ".")
+	default:
+		return nil, false
+	}
+
+	var value interface{} = data
+	for _, segment := range segments {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if value, ok = v[segment]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			value = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// claimString converts a claim value to a string. Numbers and booleans are
+// formatted, arrays joined, and address objects use their formatted member or
+// else their locality, region and country.
+func claimString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case []interface{}:
+		return strings.Join(claimStrings(v), claimValueSeparator)
+	case map[string]interface{}:
+		if formatted, ok := v["formatted"].(string); ok && formatted != "" {
+			return formatted
+		}
+		var parts []string
+		for _, member := range []string{"locality", "region", "country"} {
+			if s, ok := v[member].(string); ok && s != "" {
+				parts = append(parts, s)
+			}
+		}
+		return strings.Join(parts, claimValueSeparator)
+	}
+	return ""
+}
+
+// claimStrings converts a single or multi valued claim to a list of non-empty
+// strings.
+func claimStrings(value interface{}) []string {
+	values, ok := value.([]interface{})
+	if !ok {
+		values = []interface{}{value}
+	}
+
+	var result []string
+	for _, v := range values {
+		if s := claimString(v); s != "" {
+			result = append(result, s)
+		}
+	}
+	return result
+}
@@ -0,0 +1,84 @@
+package openidConnect
+
+import (
+	"testing"
+
+	rmxOAuth "github.com/rapidmidiex/oauth"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_LookupClaim(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	data := map[string]interface{}{
+		"sub":                        "user-1",
+		"https://example.com/claims": "namespaced",
+		"realm_access": map[string]interface{}{
+			"roles": []interface{}{"admin", "user"},
+		},
+		"a/b":    map[string]interface{}{"c~d": "escaped"},
+		"emails": []interface{}{"first@example.com", "second@example.com"},
+	}
+
+	for path, expected := range map[string]interface{}{
+		"sub":                        "user-1",
+		"https://example.com/claims": "namespaced",
+		"realm_access.roles":         []interface{}{"admin", "user"},
+		"/realm_access/roles/1":      "user",
+		"/a~1b/c~0d":                 "escaped",
+		"emails.0":                   "first@example.com",
+	} {
+		value, ok := lookupClaim(data, path)
+		a.True(ok, path)
+		a.Equal(expected, value, path)
+	}
+
+	for _, path := range []string{"missing", "realm_access.groups", "sub.value", "emails.2", "/realm_access/roles/x"} {
+		_, ok := lookupClaim(data, path)
+		a.False(ok, path)
+	}
+}
+
+func Test_ClaimString(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	a.Equal("text", claimString("text"))
+	a.Equal("42", claimString(float64(42)))
+	a.Equal("1.5", claimString(1.5))
+	a.Equal("true", claimString(true))
+	a.Equal("a, 2", claimString([]interface{}{"a", float64(2), nil}))
+	a.Equal("1 Main St, Springfield", claimString(map[string]interface{}{"formatted": "1 Main St, Springfield", "locality": "Springfield"}))
+	a.Equal("Springfield, IL, US", claimString(map[string]interface{}{"locality": "Springfield", "region": "IL", "country": "US"}))
+	a.Equal("", claimString(nil))
+}
+
+func Test_UserFromClaims_Paths(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	provider := openidConnectProvider()
+	provider.UserIdClaims = []string{"employee_id"}
+	provider.GroupsClaims = []string{GroupsClaim, "/resource_access/jam/roles"}
+
+	claims := map[string]interface{}{
+		"sub":         "user-1",
+		"employee_id": float64(1234),
+		"address":     map[string]interface{}{"locality": "Berlin", "country": "DE"},
+		"realm_access": map[string]interface{}{
+			"roles": []interface{}{"admin", "user"},
+		},
+		"resource_access": map[string]interface{}{
+			"jam": map[string]interface{}{"roles": []interface{}{"drummer", "band"}},
+		},
+		"groups": []interface{}{"band"},
+	}
+
+	user := rmxOAuth.User{}
+	provider.userFromClaims(claims, &user)
+	a.Equal("1234", user.UserID)
+	a.Equal("Berlin, DE", user.Location)
+	a.Equal([]string{"admin", "user"}, user.Roles)
+	a.Equal([]string{"band", "drummer"}, user.Groups)
+}
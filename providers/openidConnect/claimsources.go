@@ -0,0 +1,169 @@
+package openidConnect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rapidmidiex/oauth/internal/jose"
+)
+
+const (
+	claimNamesClaim   = "_claim_names"
+	claimSourcesClaim = "_claim_sources"
+)
+
+// protectedClaims are never taken from a claim source: they identify the user
+// and the token, and only the provider itself may assert them.
+var protectedClaims = []string{
+	subjectClaim, issuerClaim, audienceClaim, expiryClaim, issuedAtClaim, notBeforeClaim,
+	"jti", "nonce", "azp", "auth_time", "acr", "amr", "at_hash", "c_hash", "cnf", sessionIDClaim,
+	EmailClaim, EmailVerifiedClaim, PhoneNumberClaim, PhoneNumberVerifiedClaim,
+	claimNamesClaim, claimSourcesClaim,
+}
+
+// resolveClaimSources replaces the aggregated and distributed claims referenced
+// by _claim_names with their values from _claim_sources. Aggregated claims are
+// embedded as JWTs, distributed ones are fetched from the source endpoint. Each
+// JWT must verify with the provider's keys, or those of a claims provider
+// listed in ClaimsProviderJWKS. Only the claims named in _claim_names are
+// taken from a source, and never the protected ones, nor those mapped to the
+// user's ID, email or verified email.
+// See https://openid.net/specs/openid-connect-core-1_0.html#AggregatedDistributedClaims
+func (p *Provider) resolveClaimSources(ctx context.Context, claims map[string]interface{}) error {
+	names, _ := claims[claimNamesClaim].(map[string]interface{})
+	sources, _ := claims[claimSourcesClaim].(map[string]interface{})
+	delete(claims, claimNamesClaim)
+	delete(claims, claimSourcesClaim)
+	if len(names) == 0 {
+		return nil
+	}
+
+	resolved := map[string]map[string]interface{}{}
+	for name, ref := range names {
+		if p.protectedClaim(name) {
+			continue
+		}
+		sourceName, _ := ref.(string)
+		sourceClaims, ok := resolved[sourceName]
+		if !ok {
+			source, _ := sources[sourceName].(map[string]interface{})
+			if source == nil {
+				return fmt.Errorf("openidConnect: claim %q references unknown source %q", name, sourceName)
+			}
+
+			var err error
+			if sourceClaims, err = p.claimSource(ctx, source); err != nil {
+				return fmt.Errorf("openidConnect: claim source %q: %v", sourceName, err)
+			}
+			resolved[sourceName] = sourceClaims
+		}
+
+		if value, ok := sourceClaims[name]; ok {
+			claims[name] = value
+		}
+	}
+	return nil
+}
+
+// protectedClaim tells whether name may not be taken from a claim source.
+func (p *Provider) protectedClaim(name string) bool {
+	if contains(protectedClaims, name) {
+		return true
+	}
+	for _, mapped := range [][]string{p.UserIdClaims, p.EmailClaims, p.EmailVerifiedClaims} {
+		for _, path := range mapped {
+			// the claim itself, or the top level claim of a path into it
+			if path == name || strings.HasPrefix(path, name+".") || path == "/"+name || strings.HasPrefix(path, "/"+name+"/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// claimSource returns the verified claims of an aggregated or distributed
+// claim source.
+func (p *Provider) claimSource(ctx context.Context, source map[string]interface{}) (map[string]interface{}, error) {
+	if token, ok := source["JWT"].(string); ok {
+		return p.verifyClaimsJWT(token)
+	}
+
+	endpoint, _ := source["endpoint"].(string)
+	if endpoint == "" {
+		return nil, errors.New("neither JWT nor endpoint set")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accessToken, ok := source["access_token"].(string); ok {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	req.Header.Set("Accept", "application/jwt")
+
+	res, err := p.Client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Non-200 response from %s: %d", endpoint, res.StatusCode)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	return p.verifyClaimsJWT(strings.TrimSpace(string(body)))
+}
+
+// verifyClaimsJWT verifies a JWT of a claim source, signed by either the
+// provider itself or one of the ClaimsProviderJWKS issuers.
+func (p *Provider) verifyClaimsJWT(token string) (map[string]interface{}, error) {
+	jws, err := jose.Parse(token)
+	if err != nil {
+		return nil, err
+	}
+	unverified, err := jws.Claims()
+	if err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	issuer := getClaimValue(unverified, []string{issuerClaim})
+	if issuer == p.OpenIDConfig.Issuer {
+		if _, claims, err = p.verifyJWT(token, p.OpenIDConfig.IDTokenSigningAlgValuesSupported); err != nil {
+			return nil, err
+		}
+	} else {
+		jwksURI, ok := p.ClaimsProviderJWKS[issuer]
+		if !ok {
+			return nil, fmt.Errorf("untrusted claims provider %q", issuer)
+		}
+		alg := jws.Header.Alg
+		if strings.HasPrefix(alg, "HS") || len(p.SigningAlgorithms) > 0 && !contains(p.SigningAlgorithms, alg) {
+			return nil, fmt.Errorf("claims provider may not use %s", alg)
+		}
+		keys := p.claimsProviderKeys(jwksURI, func(set *jose.JWKS) []jose.JWK {
+			return set.Find(jws.Header.Kid, alg)
+		})
+		if err := jws.VerifyAny(keys); err != nil {
+			return nil, err
+		}
+		claims = unverified
+	}
+
+	if exp, ok := claims[expiryClaim].(float64); ok {
+		if time.Unix(int64(exp), 0).Add(p.ClockSkew).Before(p.now()) {
+			return nil, errors.New("claims JWT is expired")
+		}
+	}
+	return claims, nil
+}
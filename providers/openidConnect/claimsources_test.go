@@ -0,0 +1,144 @@
+package openidConnect
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rapidmidiex/oauth/internal/jose"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_FetchUser_ClaimSources(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	provider, now := jwksProvider(t)
+
+	claimsKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	claimsJWK, _ := jose.NewJWK(&claimsKey.PublicKey, "claims-key")
+	distributed, _ := jose.Sign(jose.Header{Alg: "ES256", Kid: "claims-key"}, map[string]interface{}{
+		"iss":    "https://claims.example.com",
+		"sub":    "user-1",
+		"groups": []interface{}{"band", "crew"},
+	}, claimsKey)
+
+	var authorization string
+	var userInfo map[string]interface{}
+	jwksFetches := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/userinfo":
+			json.NewEncoder(w).Encode(userInfo)
+		case "/claims":
+			authorization = r.Header.Get("Authorization")
+			w.Header().Set("Content-Type", "application/jwt")
+			w.Write([]byte(distributed))
+		case "/claims-jwks":
+			jwksFetches++
+			json.NewEncoder(w).Encode(jose.JWKS{Keys: []jose.JWK{*claimsJWK}})
+		}
+	}))
+	defer ts.Close()
+
+	provider.OpenIDConfig.UserInfoEndpoint = ts.URL + "/userinfo"
+	provider.ClaimsProviderJWKS = map[string]string{"https://claims.example.com": ts.URL + "/claims-jwks"}
+
+	session := &Session{
+		AccessToken: "at",
+		IDToken: signJWT(t, map[string]interface{}{
+			"iss": "https://idp.example.com",
+			"aud": "client",
+			"sub": "user-1",
+			"exp": float64(now.Add(time.Hour).Unix()),
+		}),
+	}
+
+	userInfo = map[string]interface{}{
+		"sub": "user-1",
+		"_claim_names": map[string]interface{}{
+			"locale": "src1",
+			"groups": "src2",
+		},
+		"_claim_sources": map[string]interface{}{
+			"src1": map[string]interface{}{"JWT": signJWT(t, map[string]interface{}{
+				"iss":    "https://idp.example.com",
+				"locale": "nl-BE",
+				"name":   "not named in _claim_names",
+			})},
+			"src2": map[string]interface{}{"endpoint": ts.URL + "/claims", "access_token": "source-at"},
+		},
+	}
+	user, err := provider.FetchUser(session)
+	a.NoError(err)
+	a.Equal("nl-BE", user.Locale)
+	a.Empty(user.Name)
+	a.Equal([]interface{}{"band", "crew"}, user.RawData["groups"])
+	a.NotContains(user.RawData, "_claim_names")
+	a.NotContains(user.RawData, "_claim_sources")
+	a.Equal("Bearer source-at", authorization)
+
+	_, err = provider.FetchUser(session)
+	a.NoError(err)
+	a.Equal(1, jwksFetches, "the claims provider's JWKS is cached")
+
+	userInfo["_claim_sources"].(map[string]interface{})["src1"] = map[string]interface{}{"JWT": signJWT(t, map[string]interface{}{
+		"iss":    "https://evil.example.com",
+		"locale": "en-US",
+	})}
+	_, err = provider.FetchUser(session)
+	a.EqualError(err, `openidConnect: claim source "src1": untrusted claims provider "https://evil.example.com"`)
+}
+
+func Test_ResolveClaimSources_Forged(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	provider, _ := jwksProvider(t)
+
+	forgedKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	forged, _ := jose.Sign(jose.Header{Alg: "ES256", Kid: "test-key"}, map[string]interface{}{
+		"iss":    "https://idp.example.com",
+		"locale": "en-US",
+	}, forgedKey)
+
+	claims := map[string]interface{}{
+		"_claim_names":   map[string]interface{}{"locale": "src1"},
+		"_claim_sources": map[string]interface{}{"src1": map[string]interface{}{"JWT": forged}},
+	}
+	a.Error(provider.resolveClaimSources(context.Background(), claims))
+	a.NotContains(claims, "locale")
+}
+
+func Test_ResolveClaimSources_Protected(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	provider, now := jwksProvider(t)
+	provider.EmailClaims = []string{"contact.email"}
+
+	source := signJWT(t, map[string]interface{}{
+		"iss":            "https://idp.example.com",
+		"sub":            "admin",
+		"exp":            float64(now.Add(time.Hour).Unix()),
+		"email":          "admin@example.com",
+		"email_verified": true,
+		"contact":        map[string]interface{}{"email": "admin@example.com"},
+		"locale":         "nl-BE",
+	})
+	claims := map[string]interface{}{
+		"sub": "user-1",
+		"_claim_names": map[string]interface{}{
+			"sub": "src1", "exp": "src1", "email": "src1", "email_verified": "src1", "contact": "src1", "locale": "src1",
+		},
+		"_claim_sources": map[string]interface{}{"src1": map[string]interface{}{"JWT": source}},
+	}
+	a.NoError(provider.resolveClaimSources(context.Background(), claims))
+	a.Equal(map[string]interface{}{"sub": "user-1", "locale": "nl-BE"}, claims)
+}
@@ -0,0 +1,188 @@
+package openidConnect
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	rmxOAuth "github.com/rapidmidiex/oauth"
+	"github.com/rapidmidiex/oauth/internal/jose"
+	"golang.org/x/oauth2"
+)
+
+// Client authentication methods for the token endpoint.
+// See https://openid.net/specs/openid-connect-core-1_0.html#ClientAuthentication
+const (
+	ClientSecretBasic = "client_secret_basic"
+	ClientSecretPost  = "client_secret_post"
+	ClientSecretJWT   = "client_secret_jwt"
+	PrivateKeyJWT     = "private_key_jwt"
+)
+
+const (
+	clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+	// clientAssertionTTL is how long a client assertion JWT is valid for.
+	clientAssertionTTL = 5 * time.Minute
+)
+
+// SetClientAssertionKey loads the private key used for private_key_jwt client
+// authentication from PEM data. RSA keys sign with RS256 and EC keys with
+// ES256, ES384 or ES512 depending on the curve. keyID is sent as the kid of
+// the assertion and may be empty.
+func (p *Provider) SetClientAssertionKey(pemData []byte, keyID string) error {
+	key, err := jose.ParsePrivateKeyPEM(pemData)
+	if err != nil {
+		return err
+	}
+	p.clientAssertionKey = key
+	p.clientAssertionKeyID = keyID
+	return nil
+}
+
+// tokenEndpointAuthMethod returns TokenEndpointAuthMethod if set. Otherwise
+// tls_client_auth is used when a client certificate was configured and
+// private_key_jwt when a key was, as long as the provider supports them,
+// falling back to the first supported secret based method.
+func (p *Provider) tokenEndpointAuthMethod() string {
+	if p.TokenEndpointAuthMethod != "" {
+		return p.TokenEndpointAuthMethod
+	}
+
+	supported := p.OpenIDConfig.TokenEndpointAuthMethodsSupported
+	if len(supported) == 0 {
+		// the default according to OpenID Connect Discovery 1.0
+		supported = []string{ClientSecretBasic}
+		if p.clientAssertionKey != nil {
+			supported = append(supported, PrivateKeyJWT)
+		}
+	}
+
+	if p.clientCertificate != nil {
+		for _, method := range []string{TLSClientAuth, SelfSignedTLSClientAuth} {
+			if contains(supported, method) {
+				return method
+			}
+		}
+	}
+	if p.clientAssertionKey != nil && contains(supported, PrivateKeyJWT) {
+		return PrivateKeyJWT
+	}
+	for _, method := range []string{ClientSecretBasic, ClientSecretPost, ClientSecretJWT} {
+		if contains(supported, method) {
+			return method
+		}
+	}
+	return ClientSecretBasic
+}
+
+// authenticateClient adds the client credentials for the configured method to
+// the request header or form values.
+func (p *Provider) authenticateClient(header http.Header, values url.Values) error {
+	switch method := p.tokenEndpointAuthMethod(); method {
+	case ClientSecretBasic:
+		// RFC 6749 section 2.3.1 requires the credentials to be form encoded
+		credentials := url.QueryEscape(p.ClientKey) + ":" + url.QueryEscape(p.Secret)
+		header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)))
+	case ClientSecretPost:
+		values.Set("client_id", p.ClientKey)
+		values.Set("client_secret", p.Secret)
+	case ClientSecretJWT, PrivateKeyJWT:
+		var key interface{} = []byte(p.Secret)
+		if method == PrivateKeyJWT {
+			if p.clientAssertionKey == nil {
+				return fmt.Errorf("openidConnect: %s requires a key, see SetClientAssertionKey", PrivateKeyJWT)
+			}
+			key = p.clientAssertionKey
+		}
+
+		assertion, err := p.clientAssertion(key)
+		if err != nil {
+			return err
+		}
+		values.Set("client_id", p.ClientKey)
+		values.Set("client_assertion_type", clientAssertionType)
+		values.Set("client_assertion", assertion)
+	case TLSClientAuth, SelfSignedTLSClientAuth:
+		if p.clientCertificate == nil {
+			return fmt.Errorf("openidConnect: %s requires a client certificate, see SetClientCertificate", method)
+		}
+		// the certificate presented on the connection authenticates us
+		values.Set("client_id", p.ClientKey)
+	default:
+		return fmt.Errorf("openidConnect: unsupported token endpoint auth method %q", method)
+	}
+	return nil
+}
+
+// clientAssertion creates a JWT authenticating the client as described in
+// RFC 7523 section 2.2.
+func (p *Provider) clientAssertion(key interface{}) (string, error) {
+	alg, err := jose.SigningAlgorithm(key)
+	if err != nil {
+		return "", err
+	}
+
+	jti, err := randomString(16)
+	if err != nil {
+		return "", err
+	}
+
+	now := p.now()
+	claims := map[string]interface{}{
+		"iss": p.ClientKey,
+		"sub": p.ClientKey,
+		"aud": p.OpenIDConfig.TokenEndpoint,
+		"jti": jti,
+		"iat": now.Unix(),
+		"exp": now.Add(clientAssertionTTL).Unix(),
+	}
+
+	header := jose.Header{Alg: alg, Typ: "JWT"}
+	if alg != "HS256" {
+		header.Kid = p.clientAssertionKeyID
+	}
+	return jose.Sign(header, claims, key)
+}
+
+// postForm sends an authenticated form POST to one of the provider's
+// endpoints and returns the body of a successful response. Any other response
+// is returned as an *rmxOAuth.Error.
+func (p *Provider) postForm(ctx context.Context, endpoint string, values url.Values) ([]byte, error) {
+	header := http.Header{}
+	if err := p.authenticateClient(header, values); err != nil {
+		return nil, err
+	}
+	return rmxOAuth.PostForm(ctx, p.endpointClient(), p.endpointURL(endpoint), header, values)
+}
+
+// requestToken performs a token request with the given grant parameters.
+func (p *Provider) requestToken(ctx context.Context, values url.Values) (*oauth2.Token, error) {
+	body, err := p.postForm(ctx, p.OpenIDConfig.TokenEndpoint, values)
+	if err != nil {
+		return nil, err
+	}
+	return p.parseTokenResponse(body)
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,155 @@
+package openidConnect
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	rmxOAuth "github.com/rapidmidiex/oauth"
+	"github.com/rapidmidiex/oauth/internal/jose"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_TokenEndpointAuthMethod(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	provider := openidConnectProvider()
+	a.Equal(ClientSecretBasic, provider.tokenEndpointAuthMethod())
+
+	provider.OpenIDConfig.TokenEndpointAuthMethodsSupported = []string{ClientSecretPost}
+	a.Equal(ClientSecretPost, provider.tokenEndpointAuthMethod())
+
+	a.NoError(provider.SetClientAssertionKey(ecKeyPEM(t), "key-1"))
+	a.Equal(ClientSecretPost, provider.tokenEndpointAuthMethod())
+
+	provider.OpenIDConfig.TokenEndpointAuthMethodsSupported = []string{ClientSecretBasic, PrivateKeyJWT}
+	a.Equal(PrivateKeyJWT, provider.tokenEndpointAuthMethod())
+
+	provider.TokenEndpointAuthMethod = ClientSecretJWT
+	a.Equal(ClientSecretJWT, provider.tokenEndpointAuthMethod())
+}
+
+func Test_RefreshToken_PrivateKeyJWT(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	pemData := ecKeyPEM(t)
+	key, _ := jose.ParsePrivateKeyPEM(pemData)
+
+	var form url.Values
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		form = r.PostForm
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token":"new-access","refresh_token":"new-refresh","expires_in":60,"id_token":"new-id"}`)
+	}))
+	defer ts.Close()
+
+	provider := tokenProvider(ts.URL)
+	provider.TokenEndpointAuthMethod = PrivateKeyJWT
+	a.NoError(provider.SetClientAssertionKey(pemData, "key-1"))
+
+	token, err := provider.RefreshToken("old-refresh")
+	a.NoError(err)
+	a.Equal("new-access", token.AccessToken)
+	a.Equal("new-refresh", token.RefreshToken)
+	a.Equal("new-id", token.Extra("id_token"))
+
+	a.Equal("refresh_token", form.Get("grant_type"))
+	a.Equal("old-refresh", form.Get("refresh_token"))
+	a.Empty(form.Get("client_secret"))
+	a.Equal(clientAssertionType, form.Get("client_assertion_type"))
+
+	jws, err := jose.Parse(form.Get("client_assertion"))
+	a.NoError(err)
+	a.Equal("ES256", jws.Header.Alg)
+	a.Equal("key-1", jws.Header.Kid)
+	a.NoError(jws.Verify(jose.PublicKey(key)))
+
+	claims, _ := jws.Claims()
+	a.Equal("client", claims["iss"])
+	a.Equal("client", claims["sub"])
+	a.Equal(ts.URL, claims["aud"])
+}
+
+func Test_RefreshTokenWithIDToken_ClientSecretJWT(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	var assertion string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assertion = r.PostFormValue("client_assertion")
+		fmt.Fprint(w, `{"access_token":"new-access","id_token":"new-id"}`)
+	}))
+	defer ts.Close()
+
+	provider := tokenProvider(ts.URL)
+	provider.TokenEndpointAuthMethod = ClientSecretJWT
+
+	resp, err := provider.RefreshTokenWithIDToken("old-refresh")
+	a.NoError(err)
+	a.Equal("new-id", resp.IdToken)
+
+	jws, err := jose.Parse(assertion)
+	a.NoError(err)
+	a.Equal("HS256", jws.Header.Alg)
+	a.NoError(jws.Verify([]byte("secret")))
+}
+
+func Test_Revoke(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	var user, password, token string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, _ = r.BasicAuth()
+		token = r.PostFormValue("token")
+		if token == "bad" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"unsupported_token_type"}`)
+		}
+	}))
+	defer ts.Close()
+
+	provider := tokenProvider(ts.URL)
+	provider.OpenIDConfig.RevocationEndpoint = ts.URL
+
+	a.NoError(provider.Revoke("some-token", "refresh_token"))
+	a.Equal("client", user)
+	a.Equal("secret", password)
+	a.Equal("some-token", token)
+
+	err := provider.Revoke("bad", "")
+	a.Equal("unsupported_token_type", err.(*rmxOAuth.Error).Code)
+}
+
+func tokenProvider(tokenURL string) *Provider {
+	provider, _ := NewCustomisedURL(
+		"client",
+		"secret",
+		"http://localhost/foo",
+		"https://idp.example.com/auth",
+		tokenURL,
+		"https://idp.example.com",
+		"",
+		"",
+	)
+	return provider
+}
+
+func ecKeyPEM(t *testing.T) []byte {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
@@ -0,0 +1,53 @@
+package openidConnect
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	rmxOAuth "github.com/rapidmidiex/oauth"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ClientCredentialsTokenSource(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	issued := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.Equal("client_credentials", r.PostFormValue("grant_type"))
+		a.Equal("jam:read jam:write", r.PostFormValue("scope"))
+		a.Equal("https://audio.rapidmidiex.example", r.PostFormValue("audience"))
+		user, _, _ := r.BasicAuth()
+		a.Equal("client", user)
+
+		issued++
+		fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"Bearer","expires_in":300}`, issued)
+	}))
+	defer ts.Close()
+
+	now := time.Unix(1700000000, 0)
+	provider := tokenProvider(ts.URL)
+	provider.Clock = rmxOAuth.ClockFunc(func() time.Time { return now })
+
+	source := provider.ClientCredentialsTokenSource(context.Background(), "https://audio.rapidmidiex.example", "jam:read", "jam:write")
+
+	token, err := source.Token()
+	a.NoError(err)
+	a.Equal("token-1", token.AccessToken)
+
+	now = now.Add(4 * time.Minute)
+	token, err = source.Token()
+	a.NoError(err)
+	a.Equal("token-1", token.AccessToken)
+
+	// within ClockSkew of the expiry
+	now = now.Add(time.Minute - DefaultClockSkew/2)
+	token, err = source.Token()
+	a.NoError(err)
+	a.Equal("token-2", token.AccessToken)
+	a.Equal(2, issued)
+}
@@ -0,0 +1,51 @@
+package openidConnect
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+
+	rmxOAuth "github.com/rapidmidiex/oauth"
+	"golang.org/x/oauth2"
+)
+
+var _ rmxOAuth.DeviceFlowProvider = &Provider{}
+
+// BeginDeviceAuth starts the OAuth 2.0 Device Authorization Grant at the
+// provider's device_authorization_endpoint.
+// See https://datatracker.ietf.org/doc/html/rfc8628
+func (p *Provider) BeginDeviceAuth(ctx context.Context) (*rmxOAuth.DeviceAuth, error) {
+	if p.OpenIDConfig.DeviceAuthorizationEndpoint == "" {
+		return nil, errors.New("openidConnect: provider has no device_authorization_endpoint")
+	}
+
+	body, err := p.postForm(ctx, p.OpenIDConfig.DeviceAuthorizationEndpoint, url.Values{
+		"client_id": {p.ClientKey},
+		"scope":     {strings.Join(p.config.Scopes, " ")},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rmxOAuth.ParseDeviceAuthResponse(body, p.now())
+}
+
+// AuthorizeDevice polls the token endpoint until the user has approved the
+// device authorization and returns a Session ready for FetchUser.
+func (p *Provider) AuthorizeDevice(ctx context.Context, da *rmxOAuth.DeviceAuth) (rmxOAuth.Session, error) {
+	token, err := rmxOAuth.PollDeviceToken(ctx, p.Clock, da, func() (*oauth2.Token, error) {
+		return p.requestToken(ctx, url.Values{
+			"grant_type":  {rmxOAuth.DeviceCodeGrantType},
+			"device_code": {da.DeviceCode},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Session{}
+	if err := s.setToken(token); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
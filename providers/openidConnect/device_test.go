@@ -0,0 +1,53 @@
+package openidConnect
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	rmxOAuth "github.com/rapidmidiex/oauth"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_DeviceFlow(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	polls := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/device", func(w http.ResponseWriter, r *http.Request) {
+		a.Equal("openid", r.PostFormValue("scope"))
+		fmt.Fprint(w, `{"device_code":"dc","user_code":"WDJB-MJHT","verification_uri":"https://idp.example.com/device","expires_in":600,"interval":1}`)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		a.Equal(rmxOAuth.DeviceCodeGrantType, r.PostFormValue("grant_type"))
+		a.Equal("dc", r.PostFormValue("device_code"))
+		polls++
+		if polls == 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"authorization_pending"}`)
+			return
+		}
+		fmt.Fprint(w, `{"access_token":"at","refresh_token":"rt","expires_in":3600}`)
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	provider := tokenProvider(ts.URL + "/token")
+	provider.OpenIDConfig.DeviceAuthorizationEndpoint = ts.URL + "/device"
+
+	da, err := provider.BeginDeviceAuth(context.Background())
+	a.NoError(err)
+	a.Equal("WDJB-MJHT", da.UserCode)
+	a.Equal("https://idp.example.com/device", da.VerificationURI)
+
+	da.Interval = time.Millisecond
+	session, err := provider.AuthorizeDevice(context.Background(), da)
+	a.NoError(err)
+	a.Equal(2, polls)
+	a.Equal("at", session.(*Session).AccessToken)
+	a.Equal("rt", session.(*Session).RefreshToken)
+}
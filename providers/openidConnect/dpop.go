@@ -0,0 +1,321 @@
+package openidConnect
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	rmxOAuth "github.com/rapidmidiex/oauth"
+	"github.com/rapidmidiex/oauth/internal/jose"
+	"golang.org/x/oauth2"
+)
+
+// dpopTokenType is the token_type of access tokens bound to a DPoP key.
+const dpopTokenType = "DPoP"
+
+// ErrDPoPKeyNotFound is returned by DPoPKeyStore.Load for unknown or expired
+// keys.
+var ErrDPoPKeyNotFound = errors.New("openidConnect: DPoP key not found")
+
+// DPoPKeyStore keeps the private keys that the tokens of sessions are bound to
+// with DPoP on the server. Sessions only hold the key's ID, so the key does
+// not leak along with the tokens it protects.
+type DPoPKeyStore interface {
+	Save(ctx context.Context, keyID string, key *ecdsa.PrivateKey) error
+	// Load returns the key, or ErrDPoPKeyNotFound.
+	Load(ctx context.Context, keyID string) (*ecdsa.PrivateKey, error)
+	// Delete removes the key, such as when the user logs out.
+	Delete(ctx context.Context, keyID string) error
+}
+
+// newDPoPKey generates the key pair a session's tokens are bound to, saves it
+// in DPoPKeys and returns its ID, the JWK thumbprint.
+// See https://datatracker.ietf.org/doc/html/rfc9449
+func (p *Provider) newDPoPKey(ctx context.Context) (string, error) {
+	if p.DPoPKeys == nil {
+		return "", errors.New("openidConnect: UseDPoP requires DPoPKeys")
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	jwk, err := jose.NewJWK(&key.PublicKey, "")
+	if err != nil {
+		return "", err
+	}
+	keyID, err := jwk.Thumbprint()
+	if err != nil {
+		return "", err
+	}
+	return keyID, p.DPoPKeys.Save(ctx, keyID, key)
+}
+
+// dpopKey returns the session's DPoP private key, or nil when its tokens are
+// not DPoP bound.
+func (p *Provider) dpopKey(ctx context.Context, s *Session) (*ecdsa.PrivateKey, error) {
+	if s.DPoPKeyID == "" {
+		return nil, nil
+	}
+	if p.DPoPKeys == nil {
+		return nil, errors.New("openidConnect: the session is DPoP bound but the provider has no DPoPKeys")
+	}
+	return p.DPoPKeys.Load(ctx, s.DPoPKeyID)
+}
+
+// RefreshSession refreshes the tokens of an authorized session in place. Unlike
+// RefreshToken it proves possession of the session's DPoP key, which a
+// provider requires for refresh tokens bound to it.
+func (p *Provider) RefreshSession(ctx context.Context, s *Session) error {
+	if s.RefreshToken == "" {
+		return errors.New("openidConnect: session has no refresh token")
+	}
+	token, err := p.requestSessionToken(ctx, s, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {s.RefreshToken},
+	})
+	if err != nil {
+		return err
+	}
+
+	refreshToken := s.RefreshToken
+	if err := s.setToken(token); err != nil {
+		return err
+	}
+	// providers only return a refresh token when it is rotated
+	if s.RefreshToken == "" {
+		s.RefreshToken = refreshToken
+	}
+	return nil
+}
+
+// requestSessionToken performs a token request for the session, with a DPoP
+// proof when it has a DPoP key. If the provider did not bind the issued token
+// to the key, the key is dropped and the token used as a bearer token.
+func (p *Provider) requestSessionToken(ctx context.Context, s *Session, values url.Values) (*oauth2.Token, error) {
+	key, err := p.dpopKey(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return p.requestToken(ctx, values)
+	}
+
+	res, err := p.doDPoP(ctx, key, "", func() (*http.Request, error) {
+		header := http.Header{}
+		form := url.Values{}
+		for k, v := range values {
+			form[k] = v
+		}
+		if err := p.authenticateClient(header, form); err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpointURL(p.OpenIDConfig.TokenEndpoint), strings.NewReader(form.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header = header
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Accept", "application/json")
+		return req, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, rmxOAuth.ErrorFromResponse(res.StatusCode, body)
+	}
+
+	token, err := p.parseTokenResponse(body)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(token.TokenType, dpopTokenType) {
+		if err := p.DPoPKeys.Delete(ctx, s.DPoPKeyID); err != nil {
+			return nil, err
+		}
+		s.DPoPKeyID = ""
+	}
+	return token, nil
+}
+
+// doDPoP sends the request built by newRequest with a DPoP proof, and for an
+// access token, the DPoP authorization header. When the server rejects the
+// proof asking for a (new) nonce, the request is built and sent once more
+// with it. Nonces are remembered per host for later requests.
+func (p *Provider) doDPoP(ctx context.Context, key *ecdsa.PrivateKey, accessToken string, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+
+		var nonce string
+		if v, ok := p.dpopNonces.Load(req.URL.Host); ok {
+			nonce = v.(string)
+		}
+		proof, err := p.dpopProof(key, req.Method, req.URL, accessToken, nonce)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("DPoP", proof)
+		if accessToken != "" {
+			req.Header.Set("Authorization", dpopTokenType+" "+accessToken)
+		}
+
+		res, err := p.endpointClient().Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		newNonce := res.Header.Get("DPoP-Nonce")
+		if newNonce == "" || newNonce == nonce {
+			return res, nil
+		}
+		p.dpopNonces.Store(req.URL.Host, newNonce)
+
+		// a use_dpop_nonce error is either a 400 from the authorization
+		// server or a 401 from a resource server
+		if attempt > 0 || (res.StatusCode != http.StatusBadRequest && res.StatusCode != http.StatusUnauthorized) {
+			return res, nil
+		}
+		res.Body.Close()
+	}
+}
+
+// dpopProof creates the DPoP proof JWT for a request, as described in
+// RFC 9449 section 4.2.
+func (p *Provider) dpopProof(key *ecdsa.PrivateKey, method string, target *url.URL, accessToken, nonce string) (string, error) {
+	jwk, err := jose.NewJWK(&key.PublicKey, "")
+	if err != nil {
+		return "", err
+	}
+	jti, err := randomString(16)
+	if err != nil {
+		return "", err
+	}
+
+	htu := *target
+	htu.RawQuery, htu.Fragment = "", ""
+	claims := map[string]interface{}{
+		"jti": jti,
+		"htm": method,
+		"htu": htu.String(),
+		"iat": p.now().Unix(),
+	}
+	if accessToken != "" {
+		sum := sha256.Sum256([]byte(accessToken))
+		claims["ath"] = base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+
+	header := jose.Header{Alg: "ES256", Typ: "dpop+jwt", JWK: jwk}
+	proof, err := jose.Sign(header, claims, key)
+	if err != nil {
+		return "", fmt.Errorf("openidConnect: signing DPoP proof: %v", err)
+	}
+	return proof, nil
+}
+
+// DefaultDPoPKeyTTL is how long a MemoryDPoPKeyStore keeps keys when its TTL
+// is not set.
+const DefaultDPoPKeyTTL = 30 * 24 * time.Hour
+
+// MemoryDPoPKeyStore is a DPoPKeyStore for a single instance, which forgets
+// keys TTL after they were saved. Other instances cannot use the sessions
+// whose keys it holds. The zero value is ready to use.
+type MemoryDPoPKeyStore struct {
+	// TTL should be at least as long as the refresh tokens of the provider
+	// are valid. It defaults to DefaultDPoPKeyTTL.
+	TTL   time.Duration
+	Clock rmxOAuth.Clock
+
+	mu      sync.Mutex
+	keys    map[string]memoryDPoPKey
+	sweptAt time.Time
+}
+
+type memoryDPoPKey struct {
+	key       *ecdsa.PrivateKey
+	expiresAt time.Time
+}
+
+// NewMemoryDPoPKeyStore creates an empty MemoryDPoPKeyStore keeping keys for
+// ttl.
+func NewMemoryDPoPKeyStore(ttl time.Duration) *MemoryDPoPKeyStore {
+	return &MemoryDPoPKeyStore{TTL: ttl, keys: map[string]memoryDPoPKey{}}
+}
+
+// Save implements DPoPKeyStore. Keys that expired without being deleted are
+// dropped once per TTL.
+func (s *MemoryDPoPKeyStore) Save(_ context.Context, keyID string, key *ecdsa.PrivateKey) error {
+	now := rmxOAuth.ClockWithFallBack(s.Clock).Now()
+	ttl := s.TTL
+	if ttl <= 0 {
+		ttl = DefaultDPoPKeyTTL
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.keys == nil {
+		s.keys = map[string]memoryDPoPKey{}
+	}
+	if now.Sub(s.sweptAt) >= ttl {
+		for id, k := range s.keys {
+			if !now.Before(k.expiresAt) {
+				delete(s.keys, id)
+			}
+		}
+		s.sweptAt = now
+	}
+	s.keys[keyID] = memoryDPoPKey{key: key, expiresAt: now.Add(ttl)}
+	return nil
+}
+
+// Load implements DPoPKeyStore.
+func (s *MemoryDPoPKeyStore) Load(_ context.Context, keyID string) (*ecdsa.PrivateKey, error) {
+	now := rmxOAuth.ClockWithFallBack(s.Clock).Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k, ok := s.keys[keyID]
+	if !ok {
+		return nil, ErrDPoPKeyNotFound
+	}
+	if !now.Before(k.expiresAt) {
+		delete(s.keys, keyID)
+		return nil, ErrDPoPKeyNotFound
+	}
+	return k.key, nil
+}
+
+// Delete implements DPoPKeyStore.
+func (s *MemoryDPoPKeyStore) Delete(_ context.Context, keyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.keys, keyID)
+	return nil
+}
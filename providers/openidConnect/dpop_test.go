@@ -0,0 +1,195 @@
+package openidConnect
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	rmxOAuth "github.com/rapidmidiex/oauth"
+	"github.com/rapidmidiex/oauth/internal/jose"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_DPoP(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	provider, now := jwksProvider(t)
+	provider.UseDPoP = true
+	provider.DPoPKeys = NewMemoryDPoPKeyStore(time.Hour)
+
+	idToken := signJWT(t, map[string]interface{}{
+		"iss": "https://idp.example.com",
+		"aud": "client",
+		"sub": "user-1",
+		"exp": float64(now.Add(time.Hour).Unix()),
+	})
+
+	var thumbprints []string
+	var grants []string
+	verifyProof := func(r *http.Request, accessToken string) map[string]interface{} {
+		jws, err := jose.Parse(r.Header.Get("DPoP"))
+		if !a.NoError(err) {
+			return nil
+		}
+		a.Equal("dpop+jwt", jws.Header.Typ)
+		key, err := jws.Header.JWK.Key()
+		a.NoError(err)
+		a.NoError(jws.Verify(key))
+		thumbprint, _ := jws.Header.JWK.Thumbprint()
+		thumbprints = append(thumbprints, thumbprint)
+
+		claims, err := jws.Claims()
+		a.NoError(err)
+		a.Equal(r.Method, claims["htm"])
+		a.Equal("http://"+r.Host+r.URL.Path, claims["htu"])
+		if accessToken != "" {
+			sum := sha256.Sum256([]byte(accessToken))
+			a.Equal(base64.RawURLEncoding.EncodeToString(sum[:]), claims["ath"])
+		}
+		return claims
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/token":
+			claims := verifyProof(r, "")
+			if claims["nonce"] != "n1" {
+				w.Header().Set("DPoP-Nonce", "n1")
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error":"use_dpop_nonce"}`))
+				return
+			}
+			r.ParseForm()
+			grants = append(grants, r.PostForm.Get("grant_type"))
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"access_token":  "at-" + r.PostForm.Get("grant_type"),
+				"token_type":    "DPoP",
+				"refresh_token": "rt",
+				"expires_in":    3600,
+				"id_token":      idToken,
+			})
+		case "/userinfo":
+			a.Equal("DPoP at-authorization_code", r.Header.Get("Authorization"))
+			claims := verifyProof(r, "at-authorization_code")
+			if claims["nonce"] != "n2" {
+				w.Header().Set("DPoP-Nonce", "n2")
+				w.Header().Set("WWW-Authenticate", `DPoP error="use_dpop_nonce"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"sub":"user-1","email":"user@example.com"}`))
+		}
+	}))
+	defer ts.Close()
+
+	provider.OpenIDConfig.TokenEndpoint = ts.URL + "/token"
+	provider.OpenIDConfig.UserInfoEndpoint = ts.URL + "/userinfo"
+
+	session, err := provider.BeginAuth("test_state")
+	a.NoError(err)
+	s := session.(*Session)
+	jkt := s.DPoPKeyID
+	a.NotEmpty(jkt)
+	u, _ := url.Parse(s.AuthURL)
+	a.Equal(jkt, u.Query().Get("dpop_jkt"))
+
+	// the key stays on the server
+	data, err := s.Marshal()
+	a.NoError(err)
+	a.NotContains(data, `"d":`)
+	session, err = provider.UnmarshalSession(data)
+	a.NoError(err)
+	s = session.(*Session)
+
+	accessToken, err := s.Authorize(provider, url.Values{"code": {"abc"}, "state": {"test_state"}})
+	a.NoError(err)
+	a.Equal("at-authorization_code", accessToken)
+
+	user, err := provider.FetchUser(s)
+	a.NoError(err)
+	a.Equal("user@example.com", user.Email)
+
+	a.NoError(provider.RefreshSession(context.Background(), s))
+	a.Equal("at-refresh_token", s.AccessToken)
+	a.Equal([]string{"authorization_code", "refresh_token"}, grants)
+
+	for _, thumbprint := range thumbprints {
+		a.Equal(jkt, thumbprint)
+	}
+}
+
+func Test_DPoP_BearerFallback(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.NotEmpty(r.Header.Get("DPoP"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"at","token_type":"Bearer","expires_in":3600}`))
+	}))
+	defer ts.Close()
+
+	provider := tokenProvider(ts.URL)
+	provider.UseDPoP = true
+
+	_, err := provider.BeginAuth("test_state")
+	a.Error(err, "keys need a store")
+
+	provider.DPoPKeys = NewMemoryDPoPKeyStore(time.Hour)
+	session, err := provider.BeginAuth("test_state")
+	a.NoError(err)
+	s := session.(*Session)
+	keyID := s.DPoPKeyID
+
+	_, err = s.Authorize(provider, url.Values{"code": {"abc"}})
+	a.NoError(err)
+	a.Empty(s.DPoPKeyID)
+	_, err = provider.DPoPKeys.Load(context.Background(), keyID)
+	a.Equal(ErrDPoPKeyNotFound, err)
+}
+
+func Test_MemoryDPoPKeyStore(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	now := time.Now()
+	store := NewMemoryDPoPKeyStore(time.Hour)
+	store.Clock = rmxOAuth.ClockFunc(func() time.Time { return now })
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ctx := context.Background()
+
+	a.NoError(store.Save(ctx, "key-1", key))
+	loaded, err := store.Load(ctx, "key-1")
+	a.NoError(err)
+	a.Equal(key, loaded)
+
+	now = now.Add(time.Hour)
+	_, err = store.Load(ctx, "key-1")
+	a.Equal(ErrDPoPKeyNotFound, err)
+
+	a.NoError(store.Save(ctx, "key-2", key))
+	a.NoError(store.Delete(ctx, "key-2"))
+	_, err = store.Load(ctx, "key-2")
+	a.Equal(ErrDPoPKeyNotFound, err)
+
+	// the zero value keeps keys for DefaultDPoPKeyTTL
+	store = &MemoryDPoPKeyStore{Clock: store.Clock}
+	a.NoError(store.Save(ctx, "key-3", key))
+	now = now.Add(DefaultDPoPKeyTTL - time.Second)
+	_, err = store.Load(ctx, "key-3")
+	a.NoError(err)
+	now = now.Add(time.Second)
+	_, err = store.Load(ctx, "key-3")
+	a.Equal(ErrDPoPKeyNotFound, err)
+}
@@ -0,0 +1,48 @@
+package openidConnect
+
+import (
+	"net/http"
+
+	rmxOAuth "github.com/rapidmidiex/oauth"
+)
+
+// FrontChannelLogoutHandler serves the frontchannel_logout_uri that the OpenID
+// provider loads in an iframe when the user logs out. The iss and sid query
+// parameters are validated, the sessions for that sid are ended through
+// terminator, and the session cookie set by `rmxOAuth.SetSession` is cleared.
+// When the provider does not send a sid, the sid of the session cookie is used.
+// See https://openid.net/specs/openid-connect-frontchannel-1_0.html#RPLogout
+func (p *Provider) FrontChannelLogoutHandler(terminator SessionTerminator) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the response must not be cached, and is rendered in an iframe
+		w.Header().Set("Cache-Control", "no-cache, no-store")
+		w.Header().Set("Pragma", "no-cache")
+
+		iss := r.URL.Query().Get("iss")
+		sid := r.URL.Query().Get("sid")
+
+		if p.FrontChannelLogoutSessionRequired && (iss == "" || sid == "") {
+			http.Error(w, "iss and sid are required", http.StatusBadRequest)
+			return
+		}
+		if (iss != "" || sid != "") && iss != p.OpenIDConfig.Issuer {
+			http.Error(w, "iss does not match the provider", http.StatusBadRequest)
+			return
+		}
+
+		if sid == "" {
+			sid = p.cookieSession(r).SessionID
+		}
+		if sid != "" {
+			if err := terminator.TerminateSessions(r.Context(), "", sid); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		rmxOAuth.ClearSession(w)
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("<!DOCTYPE html><html><body></body></html>"))
+	})
+}
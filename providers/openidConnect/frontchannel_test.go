@@ -0,0 +1,66 @@
+package openidConnect
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	rmxOAuth "github.com/rapidmidiex/oauth"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_FrontChannelLogoutHandler(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	provider := logoutProvider()
+	provider.FrontChannelLogoutSessionRequired = true
+
+	var terminated []string
+	handler := provider.FrontChannelLogoutHandler(SessionTerminatorFunc(func(ctx context.Context, sub, sid string) error {
+		terminated = append(terminated, sid)
+		return nil
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/frontchannel-logout?iss=https%3A%2F%2Fidp.example.com&sid=session-1", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal("no-cache, no-store", w.Header().Get("Cache-Control"))
+	a.Empty(w.Header().Get("X-Frame-Options"))
+	a.Equal([]string{"session-1"}, terminated)
+
+	for _, query := range []string{"?sid=session-1", "?iss=https%3A%2F%2Fevil.example.com&sid=session-1"} {
+		r = httptest.NewRequest(http.MethodGet, "/frontchannel-logout"+query, nil)
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		a.Equal(http.StatusBadRequest, w.Code, query)
+	}
+	a.Len(terminated, 1)
+}
+
+func Test_FrontChannelLogoutHandler_CookieSession(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	provider := logoutProvider()
+
+	var terminated string
+	handler := provider.FrontChannelLogoutHandler(SessionTerminatorFunc(func(ctx context.Context, sub, sid string) error {
+		terminated = sid
+		return nil
+	}))
+
+	sess, _ := (&Session{SessionID: "session-2"}).Marshal()
+	r := httptest.NewRequest(http.MethodGet, "/frontchannel-logout", nil)
+	r.AddCookie(&http.Cookie{Name: rmxOAuth.SessionName, Value: base64.StdEncoding.EncodeToString([]byte(sess))})
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal("session-2", terminated)
+	a.Equal(-1, w.Result().Cookies()[0].MaxAge)
+}
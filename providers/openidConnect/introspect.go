@@ -0,0 +1,195 @@
+package openidConnect
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// introspectionCacheSize bounds the number of cached introspection results;
+// the least recently used entry is dropped once it is reached.
+const introspectionCacheSize = 10000
+
+// Introspection is the result of a token introspection request.
+// See https://datatracker.ietf.org/doc/html/rfc7662#section-2.2
+type Introspection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+	// Expiry and IssuedAt are seconds since the Unix epoch.
+	Expiry   int64 `json:"exp,omitempty"`
+	IssuedAt int64 `json:"iat,omitempty"`
+	// Confirmation holds the key a sender-constrained token is bound to.
+	Confirmation *Confirmation `json:"cnf,omitempty"`
+
+	// Claims holds every member of the response.
+	Claims map[string]interface{} `json:"-"`
+}
+
+// Confirmation is the cnf member of an introspection response.
+type Confirmation struct {
+	// X5tS256 is the thumbprint of a mutual TLS certificate.
+	X5tS256 string `json:"x5t#S256,omitempty"`
+	// JKT is the thumbprint of a DPoP key.
+	JKT string `json:"jkt,omitempty"`
+}
+
+// ExpiresAt returns the expiry of the token, or the zero time when the
+// provider did not tell.
+func (i *Introspection) ExpiresAt() time.Time {
+	if i.Expiry == 0 {
+		return time.Time{}
+	}
+	return time.Unix(i.Expiry, 0)
+}
+
+// Scopes returns the space separated Scope as a slice.
+func (i *Introspection) Scopes() []string {
+	return strings.Fields(i.Scope)
+}
+
+// clone returns a deep copy of i, so that callers cannot change cached
+// results.
+func (i *Introspection) clone() *Introspection {
+	c := *i
+	if i.Confirmation != nil {
+		cnf := *i.Confirmation
+		c.Confirmation = &cnf
+	}
+	if i.Claims != nil {
+		c.Claims = cloneJSON(i.Claims).(map[string]interface{})
+	}
+	return &c
+}
+
+// cloneJSON deep copies a value decoded from JSON.
+func cloneJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			c[k] = cloneJSON(e)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, e := range v {
+			c[i] = cloneJSON(e)
+		}
+		return c
+	}
+	return v
+}
+
+// introspectionCache remembers introspection results by token hash, in order
+// of use so that the least recently used is dropped when it is full.
+type introspectionCache struct {
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]*list.Element
+	order   list.List
+}
+
+type introspectionEntry struct {
+	key       [sha256.Size]byte
+	result    *Introspection
+	expiresAt time.Time
+}
+
+// Introspect asks the provider's introspection_endpoint whether an access
+// token is active. Results are cached for IntrospectionCacheTTL, but never past
+// the token's expiry, and inactive results for IntrospectionNegativeCacheTTL.
+// An inactive token is not an error.
+func (p *Provider) Introspect(ctx context.Context, token string) (*Introspection, error) {
+	if p.OpenIDConfig.IntrospectionEndpoint == "" {
+		return nil, errors.New("openidConnect: provider has no introspection_endpoint")
+	}
+
+	key := sha256.Sum256([]byte(token))
+	now := p.now()
+	if result := p.introspection.get(key, now); result != nil {
+		return result, nil
+	}
+
+	body, err := p.postForm(ctx, p.OpenIDConfig.IntrospectionEndpoint, url.Values{
+		"token":           {token},
+		"token_type_hint": {"access_token"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Introspection{}
+	if err := json.Unmarshal(body, result); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(body, &result.Claims); err != nil {
+		return nil, err
+	}
+
+	// do not trust an active result for a token expired by our clock
+	expiresAt := result.ExpiresAt()
+	if result.Active && !expiresAt.IsZero() && expiresAt.Add(p.ClockSkew).Before(now) {
+		result.Active = false
+	}
+
+	ttl := p.IntrospectionNegativeCacheTTL
+	if result.Active {
+		ttl = p.IntrospectionCacheTTL
+	}
+	if ttl > 0 {
+		cacheUntil := now.Add(ttl)
+		if result.Active && !expiresAt.IsZero() && expiresAt.Before(cacheUntil) {
+			cacheUntil = expiresAt
+		}
+		p.introspection.put(key, result, cacheUntil)
+	}
+	return result, nil
+}
+
+func (c *introspectionCache) get(key [sha256.Size]byte, now time.Time) *Introspection {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	entry := elem.Value.(*introspectionEntry)
+	if !now.Before(entry.expiresAt) {
+		c.remove(elem)
+		return nil
+	}
+	c.order.MoveToFront(elem)
+	return entry.result.clone()
+}
+
+func (c *introspectionCache) put(key [sha256.Size]byte, result *Introspection, expiresAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[[sha256.Size]byte]*list.Element)
+	}
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	if len(c.entries) >= introspectionCacheSize {
+		c.remove(c.order.Back())
+	}
+	c.entries[key] = c.order.PushFront(&introspectionEntry{key: key, result: result.clone(), expiresAt: expiresAt})
+}
+
+func (c *introspectionCache) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*introspectionEntry).key)
+}
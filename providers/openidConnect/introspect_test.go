@@ -0,0 +1,135 @@
+package openidConnect
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	rmxOAuth "github.com/rapidmidiex/oauth"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Introspect(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	now := time.Unix(1700000000, 0)
+	calls := map[string]int{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _, _ := r.BasicAuth()
+		a.Equal("client", user)
+		r.ParseForm()
+		token := r.PostForm.Get("token")
+		calls[token]++
+
+		w.Header().Set("Content-Type", "application/json")
+		switch token {
+		case "active":
+			fmt.Fprintf(w, `{"active":true,"scope":"openid jam:write","client_id":"web","sub":"user-1","exp":%d,"cnf":{"x5t#S256":"abc"},"room":"r1"}`, now.Add(time.Hour).Unix())
+		case "expiring":
+			fmt.Fprintf(w, `{"active":true,"exp":%d}`, now.Add(10*time.Second).Unix())
+		default:
+			w.Write([]byte(`{"active":false}`))
+		}
+	}))
+	defer ts.Close()
+
+	provider := tokenProvider("https://idp.example.com/token")
+	provider.OpenIDConfig.IntrospectionEndpoint = ts.URL
+	provider.Clock = rmxOAuth.ClockFunc(func() time.Time { return now })
+
+	result, err := provider.Introspect(context.Background(), "active")
+	a.NoError(err)
+	a.True(result.Active)
+	a.Equal([]string{"openid", "jam:write"}, result.Scopes())
+	a.Equal("web", result.ClientID)
+	a.Equal("user-1", result.Subject)
+	a.Equal(now.Add(time.Hour), result.ExpiresAt())
+	a.Equal("abc", result.Confirmation.X5tS256)
+	a.Equal("r1", result.Claims["room"])
+
+	// changing a result does not change the cached one
+	result.Active = false
+	result.Claims["room"] = "r2"
+	result.Confirmation.X5tS256 = "def"
+	result, err = provider.Introspect(context.Background(), "active")
+	a.NoError(err)
+	a.True(result.Active)
+	a.Equal("r1", result.Claims["room"])
+	a.Equal("abc", result.Confirmation.X5tS256)
+
+	result, err = provider.Introspect(context.Background(), "revoked")
+	a.NoError(err)
+	a.False(result.Active)
+
+	_, _ = provider.Introspect(context.Background(), "expiring")
+
+	// cached
+	now = now.Add(4 * time.Second)
+	for _, token := range []string{"active", "revoked", "expiring"} {
+		_, err = provider.Introspect(context.Background(), token)
+		a.NoError(err)
+	}
+	a.Equal(map[string]int{"active": 1, "revoked": 1, "expiring": 1}, calls)
+
+	// negative results expire first, active ones not past the token expiry
+	now = now.Add(8 * time.Second)
+	for _, token := range []string{"active", "revoked", "expiring"} {
+		_, err = provider.Introspect(context.Background(), token)
+		a.NoError(err)
+	}
+	a.Equal(map[string]int{"active": 1, "revoked": 2, "expiring": 2}, calls)
+
+	now = now.Add(DefaultIntrospectionCacheTTL)
+	_, err = provider.Introspect(context.Background(), "active")
+	a.NoError(err)
+	a.Equal(2, calls["active"])
+}
+
+func Test_Introspect_Errors(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	provider := tokenProvider("https://idp.example.com/token")
+	_, err := provider.Introspect(context.Background(), "token")
+	a.EqualError(err, "openidConnect: provider has no introspection_endpoint")
+
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error":"invalid_client"}`))
+	}))
+	defer ts.Close()
+
+	provider.OpenIDConfig.IntrospectionEndpoint = ts.URL
+	for i := 0; i < 2; i++ {
+		_, err = provider.Introspect(context.Background(), "token")
+		a.EqualError(err, "oauth2: invalid_client")
+	}
+	a.Equal(2, calls)
+}
+
+func Test_IntrospectionCache_Full(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	now := time.Now()
+	cache := &introspectionCache{}
+	key := func(i int) [sha256.Size]byte { return sha256.Sum256([]byte(fmt.Sprint(i))) }
+	for i := 0; i < introspectionCacheSize; i++ {
+		cache.put(key(i), &Introspection{Active: true}, now.Add(time.Hour))
+	}
+
+	// the least recently used entry makes room
+	a.NotNil(cache.get(key(0), now))
+	cache.put(key(introspectionCacheSize), &Introspection{Active: true}, now.Add(time.Hour))
+	a.NotNil(cache.get(key(0), now))
+	a.Nil(cache.get(key(1), now))
+	a.NotNil(cache.get(key(introspectionCacheSize), now))
+	a.Len(cache.entries, introspectionCacheSize)
+}
@@ -0,0 +1,95 @@
+package openidConnect
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	rmxOAuth "github.com/rapidmidiex/oauth"
+	"github.com/rapidmidiex/oauth/internal/jose"
+	"golang.org/x/oauth2"
+)
+
+// SetDecryptionKey loads the private key, RSA or EC, that encrypted ID tokens
+// and UserInfo responses are decrypted with, from PEM data. RSA keys support
+// the RSA-OAEP and RSA-OAEP-256 key management algorithms and EC keys
+// ECDH-ES, with A128GCM or A256GCM content encryption.
+func (p *Provider) SetDecryptionKey(pemData []byte) error {
+	key, err := jose.ParsePrivateKeyPEM(pemData)
+	if err != nil {
+		return err
+	}
+	p.decryptionKey = key
+	return nil
+}
+
+// decrypt returns the plaintext of a JWE, or token itself when it is not
+// encrypted. The plaintext of a nested JWT is the signed JWT.
+func (p *Provider) decrypt(token string) (string, error) {
+	if !jose.IsJWE(token) {
+		return token, nil
+	}
+	if p.decryptionKey == nil {
+		return "", errors.New("openidConnect: received an encrypted token, see SetDecryptionKey")
+	}
+
+	_, plaintext, err := jose.Decrypt(token, p.decryptionKey)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// parseTokenResponse parses a successful token response, replacing an
+// encrypted id_token with its decrypted, signed JWT.
+func (p *Provider) parseTokenResponse(body []byte) (*oauth2.Token, error) {
+	token, err := rmxOAuth.ParseTokenResponse(body, p.now())
+	if err != nil {
+		return nil, err
+	}
+
+	idToken, _ := token.Extra("id_token").(string)
+	if !jose.IsJWE(idToken) {
+		return token, nil
+	}
+	if idToken, err = p.decrypt(idToken); err != nil {
+		return nil, err
+	}
+
+	raw := make(map[string]interface{})
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, err
+	}
+	raw["id_token"] = idToken
+	return token.WithExtra(raw), nil
+}
+
+// userInfoJWT returns the claims of an application/jwt UserInfo response,
+// which is signed, encrypted, or both.
+// See https://openid.net/specs/openid-connect-core-1_0.html#UserInfoResponse
+func (p *Provider) userInfoJWT(data []byte) (map[string]interface{}, error) {
+	token := strings.TrimSpace(string(data))
+	encrypted := jose.IsJWE(token)
+
+	token, err := p.decrypt(token)
+	if err != nil {
+		return nil, err
+	}
+	if encrypted && strings.Count(token, ".") != 2 {
+		// encrypted only, the plaintext is the JSON object
+		return unMarshal([]byte(token))
+	}
+
+	_, claims, err := p.verifyJWT(token, p.OpenIDConfig.UserInfoSigningAlgValuesSupported)
+	if err != nil {
+		return nil, err
+	}
+
+	// a signed UserInfo response should carry iss and aud
+	if _, ok := claims[issuerClaim]; ok {
+		if err := p.validateIssuerAndAudience(claims); err != nil {
+			return nil, err
+		}
+	}
+	return claims, nil
+}
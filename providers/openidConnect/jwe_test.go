@@ -0,0 +1,131 @@
+package openidConnect
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/rapidmidiex/oauth/internal/jose"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_EncryptedIDToken(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	provider, now := jwksProvider(t)
+	decryptionKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	der := x509.MarshalPKCS1PrivateKey(decryptionKey)
+	a.NoError(provider.SetDecryptionKey(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: der})))
+
+	idToken := signJWT(t, map[string]interface{}{
+		"iss": "https://idp.example.com",
+		"aud": "client",
+		"sub": "user-1",
+		"sid": "session-1",
+		"exp": float64(now.Add(time.Hour).Unix()),
+	})
+	encrypted, err := jose.Encrypt(jose.Header{Alg: jose.RSAOAEP256, Enc: jose.A256GCM, Cty: "JWT"}, []byte(idToken), &decryptionKey.PublicKey)
+	a.NoError(err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "at",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     encrypted,
+		})
+	}))
+	defer ts.Close()
+	provider.OpenIDConfig.TokenEndpoint = ts.URL
+
+	session := &Session{}
+	_, err = session.Authorize(provider, url.Values{"code": {"abc"}})
+	a.NoError(err)
+	a.Equal(idToken, session.IDToken)
+	a.Equal("session-1", session.SessionID)
+
+	user, err := provider.FetchUser(session)
+	a.NoError(err)
+	a.Equal("user-1", user.UserID)
+
+	// without a key encrypted tokens are rejected
+	provider.decryptionKey = nil
+	_, err = session.Authorize(provider, url.Values{"code": {"abc"}})
+	a.EqualError(err, "openidConnect: received an encrypted token, see SetDecryptionKey")
+}
+
+func Test_UserInfoJWT(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	provider, now := jwksProvider(t)
+	decryptionPEM := ecKeyPEM(t)
+	a.NoError(provider.SetDecryptionKey(decryptionPEM))
+	decryptionKey, _ := jose.ParsePrivateKeyPEM(decryptionPEM)
+	encryptionKey := &decryptionKey.(*ecdsa.PrivateKey).PublicKey
+
+	var userInfo string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/jwt")
+		w.Write([]byte(userInfo))
+	}))
+	defer ts.Close()
+	provider.OpenIDConfig.UserInfoEndpoint = ts.URL
+
+	session := &Session{
+		AccessToken: "at",
+		IDToken: signJWT(t, map[string]interface{}{
+			"iss": "https://idp.example.com",
+			"aud": "client",
+			"sub": "user-1",
+			"exp": float64(now.Add(time.Hour).Unix()),
+		}),
+	}
+
+	signed := signJWT(t, map[string]interface{}{
+		"iss":   "https://idp.example.com",
+		"aud":   "client",
+		"sub":   "user-1",
+		"email": "signed@example.com",
+	})
+
+	userInfo = signed
+	user, err := provider.FetchUser(session)
+	a.NoError(err)
+	a.Equal("signed@example.com", user.Email)
+
+	// signed, then encrypted
+	userInfo, err = jose.Encrypt(jose.Header{Alg: jose.ECDHES, Enc: jose.A128GCM, Cty: "JWT"}, []byte(signed), encryptionKey)
+	a.NoError(err)
+	user, err = provider.FetchUser(session)
+	a.NoError(err)
+	a.Equal("signed@example.com", user.Email)
+
+	// encrypted only
+	userInfo, err = jose.Encrypt(jose.Header{Alg: jose.ECDHES, Enc: jose.A256GCM}, []byte(`{"sub":"user-1","email":"encrypted@example.com"}`), encryptionKey)
+	a.NoError(err)
+	user, err = provider.FetchUser(session)
+	a.NoError(err)
+	a.Equal("encrypted@example.com", user.Email)
+
+	// signed by someone else
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	userInfo, _ = jose.Sign(jose.Header{Alg: "RS256", Kid: "test-key"}, map[string]interface{}{
+		"iss":   "https://idp.example.com",
+		"aud":   "client",
+		"sub":   "user-1",
+		"email": "forged@example.com",
+	}, otherKey)
+	_, err = provider.FetchUser(session)
+	a.Error(err)
+}
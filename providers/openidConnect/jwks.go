@@ -0,0 +1,198 @@
+package openidConnect
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rapidmidiex/oauth/internal/jose"
+)
+
+// jwksMinRefetchInterval rate limits fetching the JWKS again when a token is
+// signed with a key we do not know yet.
+const jwksMinRefetchInterval = time.Minute
+
+// keySet caches the provider's signing keys from its jwks_uri.
+type keySet struct {
+	mu        sync.Mutex
+	keys      jose.JWKS
+	fetchedAt time.Time
+	fetching  *jwksFetch
+}
+
+// jwksFetch is a JWKS fetch in flight. The lookups waiting for it select from
+// the keys it cached once done is closed.
+type jwksFetch struct {
+	done chan struct{}
+}
+
+// defaultSigningAlgorithm is accepted for JWTs when neither the Provider nor
+// its discovery metadata list any, as the ID Token default of OpenID Connect.
+const defaultSigningAlgorithm = "RS256"
+
+// verifyJWT checks the signature of a JWT against the provider's JWKS, or the
+// client secret for HMAC algorithms, and returns its claims. The alg must be
+// one of advertised, the discovery metadata for the kind of token, unless
+// SigningAlgorithms overrides them. It does not validate any claims.
+func (p *Provider) verifyJWT(token string, advertised []string) (*jose.JWS, map[string]interface{}, error) {
+	jws, err := jose.Parse(token)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := p.checkSigningAlgorithm(jws.Header.Alg, advertised); err != nil {
+		return nil, nil, err
+	}
+
+	if strings.HasPrefix(jws.Header.Alg, "HS") {
+		err = jws.Verify([]byte(p.Secret))
+	} else {
+		var keys []jose.JWK
+		keys, err = p.signingKeys(jws.Header.Kid, jws.Header.Alg)
+		if err == nil {
+			err = jws.VerifyAny(keys)
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	claims, err := jws.Claims()
+	if err != nil {
+		return nil, nil, err
+	}
+	return jws, claims, nil
+}
+
+// checkSigningAlgorithm rejects JWTs signed with an algorithm that is not
+// accepted, and HMAC signed ones when there is no client secret to sign with:
+// anyone could sign those with the empty key.
+func (p *Provider) checkSigningAlgorithm(alg string, advertised []string) error {
+	if strings.HasPrefix(alg, "HS") && p.Secret == "" {
+		return fmt.Errorf("openidConnect: %s signed token but the client has no secret", alg)
+	}
+	if !contains(p.signingAlgorithms(advertised), alg) {
+		return fmt.Errorf("openidConnect: token signed with unexpected algorithm %q", alg)
+	}
+	return nil
+}
+
+// signingAlgorithms returns the accepted JWT signing algorithms: the
+// SigningAlgorithms of the Provider, or else advertised, or else those of ID
+// Tokens.
+func (p *Provider) signingAlgorithms(advertised []string) []string {
+	switch {
+	case len(p.SigningAlgorithms) > 0:
+		return p.SigningAlgorithms
+	case len(advertised) > 0:
+		return advertised
+	case len(p.OpenIDConfig.IDTokenSigningAlgValuesSupported) > 0:
+		return p.OpenIDConfig.IDTokenSigningAlgValuesSupported
+	}
+	return []string{defaultSigningAlgorithm}
+}
+
+// signingKeys returns the cached keys matching kid and alg, fetching the JWKS
+// when none match.
+func (p *Provider) signingKeys(kid, alg string) ([]jose.JWK, error) {
+	keys := p.providerKeys(func(set *jose.JWKS) []jose.JWK {
+		return set.Find(kid, alg)
+	})
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("openidConnect: no key found for kid %q", kid)
+	}
+	return keys, nil
+}
+
+// encryptionKeys returns the provider's keys for encrypting with alg.
+func (p *Provider) encryptionKeys(alg string) []jose.JWK {
+	return p.providerKeys(func(set *jose.JWKS) []jose.JWK {
+		return set.EncryptionKeys(alg)
+	})
+}
+
+// providerKeys returns the cached keys of the provider selected by find.
+func (p *Provider) providerKeys(find func(*jose.JWKS) []jose.JWK) []jose.JWK {
+	return p.cachedKeys(&p.jwks, p.OpenIDConfig.JWKSURI, find)
+}
+
+// claimsProviderKeys returns the cached keys of a claims provider selected by
+// find.
+func (p *Provider) claimsProviderKeys(jwksURI string, find func(*jose.JWKS) []jose.JWK) []jose.JWK {
+	set, _ := p.claimsProviderJWKS.LoadOrStore(jwksURI, &keySet{})
+	return p.cachedKeys(set.(*keySet), jwksURI, find)
+}
+
+// cachedKeys returns the keys of set selected by find. When it selects none,
+// the JWKS is fetched again from jwksURI, at most every
+// jwksMinRefetchInterval. Concurrent lookups wait for the same fetch, which
+// runs without holding the lock so that lookups of cached keys are not held
+// up by it.
+func (p *Provider) cachedKeys(set *keySet, jwksURI string, find func(*jose.JWKS) []jose.JWK) []jose.JWK {
+	set.mu.Lock()
+	if keys := find(&set.keys); len(keys) > 0 {
+		set.mu.Unlock()
+		return keys
+	}
+
+	now := p.now()
+	if jwksURI == "" || !set.fetchedAt.IsZero() && now.Sub(set.fetchedAt) < jwksMinRefetchInterval {
+		set.mu.Unlock()
+		return nil
+	}
+
+	fetch := set.fetching
+	if fetch == nil {
+		fetch = &jwksFetch{done: make(chan struct{})}
+		set.fetching = fetch
+		set.mu.Unlock()
+		p.fetchKeySet(set, fetch, jwksURI, now)
+	} else {
+		set.mu.Unlock()
+		<-fetch.done
+	}
+
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	return find(&set.keys)
+}
+
+// fetchKeySet runs fetch, caching the JWKS in set as fetched at now.
+func (p *Provider) fetchKeySet(set *keySet, fetch *jwksFetch, jwksURI string, now time.Time) {
+	keys, err := p.fetchJWKS(jwksURI)
+
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	if err == nil {
+		set.keys = *keys
+		set.fetchedAt = now
+	}
+	set.fetching = nil
+	close(fetch.done)
+}
+
+func (p *Provider) fetchJWKS(jwksURI string) (*jose.JWKS, error) {
+	res, err := p.Client().Get(jwksURI)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Non-200 response from JWKS URI: %d", res.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := &jose.JWKS{}
+	if err := json.Unmarshal(body, keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
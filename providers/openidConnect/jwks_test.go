@@ -0,0 +1,104 @@
+package openidConnect
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rapidmidiex/oauth/internal/jose"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_VerifyJWT_SigningAlgorithms(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	provider, now := jwksProvider(t)
+	claims := logoutClaims(now)
+
+	_, _, err := provider.verifyJWT(signJWT(t, claims), nil)
+	a.NoError(err)
+
+	hmacSigned, _ := jose.Sign(jose.Header{Alg: "HS256"}, claims, []byte("secret"))
+	_, _, err = provider.verifyJWT(hmacSigned, []string{"RS256", "HS256"})
+	a.NoError(err)
+	_, _, err = provider.verifyJWT(hmacSigned, nil)
+	a.Error(err, "not advertised")
+
+	provider.Secret = ""
+	forged, _ := jose.Sign(jose.Header{Alg: "HS256"}, claims, []byte(""))
+	_, _, err = provider.verifyJWT(forged, []string{"RS256", "HS256"})
+	a.Error(err, "public clients cannot verify HMAC")
+
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ecSigned, _ := jose.Sign(jose.Header{Alg: "ES256", Kid: "test-key"}, claims, ecKey)
+	_, _, err = provider.verifyJWT(ecSigned, []string{"RS256"})
+	a.Error(err)
+
+	provider.OpenIDConfig.IDTokenSigningAlgValuesSupported = []string{"ES256"}
+	_, _, err = provider.verifyJWT(signJWT(t, claims), nil)
+	a.Error(err, "falls back to the ID Token algorithms")
+
+	provider.SigningAlgorithms = []string{"RS256"}
+	_, _, err = provider.verifyJWT(signJWT(t, claims), []string{"ES256"})
+	a.NoError(err, "configured algorithms win")
+}
+
+func Test_CachedKeys_ConcurrentFetch(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	jwk, _ := jose.NewJWK(&signingKey.PublicKey, "test-key")
+	var fetches int32
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		<-release
+		json.NewEncoder(w).Encode(jose.JWKS{Keys: []jose.JWK{*jwk}})
+	}))
+	defer ts.Close()
+
+	provider, _ := jwksProvider(t)
+	provider.OpenIDConfig.JWKSURI = ts.URL
+	cached := *jwk
+	cached.Kid = "cached-key"
+	provider.jwks.keys = jose.JWKS{Keys: []jose.JWK{cached}}
+
+	var wg sync.WaitGroup
+	keys := make([][]jose.JWK, 20)
+	for i := range keys {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			keys[i], _ = provider.signingKeys("test-key", "RS256")
+		}(i)
+	}
+
+	// cached keys are found while the fetch is in flight
+	found := make(chan []jose.JWK)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		k, _ := provider.signingKeys("cached-key", "RS256")
+		found <- k
+	}()
+	select {
+	case k := <-found:
+		a.Len(k, 1)
+	case <-time.After(time.Second):
+		a.Fail("the lookup of a cached key waited for the fetch")
+	}
+
+	close(release)
+	wg.Wait()
+	for _, k := range keys {
+		a.Len(k, 1)
+	}
+	a.Equal(int32(1), atomic.LoadInt32(&fetches))
+}
@@ -0,0 +1,100 @@
+package openidConnect
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	rmxOAuth "github.com/rapidmidiex/oauth"
+)
+
+// ErrNoEndSessionEndpoint is returned when the provider does not advertise an
+// end_session_endpoint.
+var ErrNoEndSessionEndpoint = errors.New("openidConnect: provider has no end_session_endpoint")
+
+// LogoutURL builds the URL that ends the user's session at the OpenID provider,
+// as described by RP-Initiated Logout 1.0. Empty arguments are left out of the
+// request.
+// See https://openid.net/specs/openid-connect-rpinitiated-1_0.html#RPLogout
+func (p *Provider) LogoutURL(idTokenHint, postLogoutRedirectURI, state string) (string, error) {
+	if p.OpenIDConfig.EndSessionEndpoint == "" {
+		return "", ErrNoEndSessionEndpoint
+	}
+
+	u, err := url.Parse(p.OpenIDConfig.EndSessionEndpoint)
+	if err != nil {
+		return "", err
+	}
+
+	q := u.Query()
+	q.Set("client_id", p.ClientKey)
+	if idTokenHint != "" {
+		q.Set("id_token_hint", idTokenHint)
+	}
+	if postLogoutRedirectURI != "" {
+		q.Set("post_logout_redirect_uri", postLogoutRedirectURI)
+	}
+	if state != "" {
+		q.Set("state", state)
+	}
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// LogoutHandler clears the session cookie set by `rmxOAuth.SetSession` and
+// redirects the user to the provider's end_session_endpoint. The
+// post_logout_redirect_uri and state query parameters of the request are passed
+// on to the provider; the redirect URI must be one of PostLogoutRedirectURIs.
+// When the request has none, the first of PostLogoutRedirectURIs is used.
+func (p *Provider) LogoutHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirectURI := r.URL.Query().Get("post_logout_redirect_uri")
+		if redirectURI == "" && len(p.PostLogoutRedirectURIs) > 0 {
+			redirectURI = p.PostLogoutRedirectURIs[0]
+		}
+		if redirectURI != "" && !p.allowedPostLogoutRedirect(redirectURI) {
+			http.Error(w, "post_logout_redirect_uri is not allowed", http.StatusBadRequest)
+			return
+		}
+
+		idTokenHint := p.cookieSession(r).IDToken
+		rmxOAuth.ClearSession(w)
+
+		logoutURL, err := p.LogoutURL(idTokenHint, redirectURI, r.URL.Query().Get("state"))
+		if errors.Is(err, ErrNoEndSessionEndpoint) && redirectURI != "" {
+			// nothing to do at the provider, the local session is gone
+			logoutURL, err = redirectURI, nil
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, logoutURL, http.StatusFound)
+	})
+}
+
+func (p *Provider) allowedPostLogoutRedirect(redirectURI string) bool {
+	for _, allowed := range p.PostLogoutRedirectURIs {
+		if allowed == redirectURI {
+			return true
+		}
+	}
+	return false
+}
+
+// cookieSession returns the session stored in the request's session cookie,
+// or an empty Session if there is none.
+func (p *Provider) cookieSession(r *http.Request) *Session {
+	data, err := rmxOAuth.GetSession(r)
+	if err != nil {
+		return &Session{}
+	}
+
+	sess, err := p.UnmarshalSession(string(data))
+	if err != nil {
+		return &Session{}
+	}
+	return sess.(*Session)
+}
@@ -0,0 +1,89 @@
+package openidConnect
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	rmxOAuth "github.com/rapidmidiex/oauth"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_LogoutURL(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	provider := logoutProvider()
+	logoutURL, err := provider.LogoutURL("id.token.hint", "http://localhost/bye", "xyz")
+	a.NoError(err)
+
+	u, err := url.Parse(logoutURL)
+	a.NoError(err)
+	a.Equal("https://idp.example.com/logout", u.Scheme+"://"+u.Host+u.Path)
+	a.Equal("id.token.hint", u.Query().Get("id_token_hint"))
+	a.Equal("http://localhost/bye", u.Query().Get("post_logout_redirect_uri"))
+	a.Equal("xyz", u.Query().Get("state"))
+	a.Equal("client", u.Query().Get("client_id"))
+
+	provider.OpenIDConfig.EndSessionEndpoint = ""
+	_, err = provider.LogoutURL("", "", "")
+	a.Equal(ErrNoEndSessionEndpoint, err)
+}
+
+func Test_LogoutHandler(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	provider := logoutProvider()
+	sess, _ := (&Session{IDToken: "id.token.hint"}).Marshal()
+
+	r := httptest.NewRequest(http.MethodGet, "/logout?state=xyz", nil)
+	r.AddCookie(&http.Cookie{Name: rmxOAuth.SessionName, Value: base64.StdEncoding.EncodeToString([]byte(sess))})
+	w := httptest.NewRecorder()
+	provider.LogoutHandler().ServeHTTP(w, r)
+
+	a.Equal(http.StatusFound, w.Code)
+	u, err := url.Parse(w.Header().Get("Location"))
+	a.NoError(err)
+	a.Equal("id.token.hint", u.Query().Get("id_token_hint"))
+	a.Equal("http://localhost/bye", u.Query().Get("post_logout_redirect_uri"))
+	a.Equal("xyz", u.Query().Get("state"))
+
+	cookies := w.Result().Cookies()
+	a.Len(cookies, 2)
+	a.Equal(rmxOAuth.SessionName, cookies[0].Name)
+	a.Equal(rmxOAuth.FormPostSessionName, cookies[1].Name)
+	for _, cookie := range cookies {
+		a.Equal(-1, cookie.MaxAge)
+	}
+}
+
+func Test_LogoutHandler_RejectsUnknownRedirect(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	provider := logoutProvider()
+	r := httptest.NewRequest(http.MethodGet, "/logout?post_logout_redirect_uri=https%3A%2F%2Fevil.example.com", nil)
+	w := httptest.NewRecorder()
+	provider.LogoutHandler().ServeHTTP(w, r)
+
+	a.Equal(http.StatusBadRequest, w.Code)
+	a.Empty(w.Result().Cookies())
+}
+
+func logoutProvider() *Provider {
+	provider, _ := NewCustomisedURL(
+		"client",
+		"secret",
+		"http://localhost/foo",
+		"https://idp.example.com/auth",
+		"https://idp.example.com/token",
+		"https://idp.example.com",
+		"https://idp.example.com/userinfo",
+		"https://idp.example.com/logout",
+	)
+	provider.PostLogoutRedirectURIs = []string{"http://localhost/bye"}
+	return provider
+}
@@ -0,0 +1,217 @@
+package openidConnect
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// Mutual TLS client authentication methods.
+// See https://datatracker.ietf.org/doc/html/rfc8705#section-2
+const (
+	TLSClientAuth           = "tls_client_auth"
+	SelfSignedTLSClientAuth = "self_signed_tls_client_auth"
+)
+
+// MTLSEndpointAliases are the endpoints a provider serves with mutual TLS, in
+// place of the ones of the discovery metadata.
+// See https://datatracker.ietf.org/doc/html/rfc8705#section-5
+type MTLSEndpointAliases struct {
+	TokenEndpoint                      string `json:"token_endpoint,omitempty"`
+	RevocationEndpoint                 string `json:"revocation_endpoint,omitempty"`
+	IntrospectionEndpoint              string `json:"introspection_endpoint,omitempty"`
+	UserInfoEndpoint                   string `json:"userinfo_endpoint,omitempty"`
+	DeviceAuthorizationEndpoint        string `json:"device_authorization_endpoint,omitempty"`
+	PushedAuthorizationRequestEndpoint string `json:"pushed_authorization_request_endpoint,omitempty"`
+}
+
+// SetClientCertificate loads the client certificate and its private key from
+// PEM data. The certificate is presented to the provider's endpoints, which
+// then use their mtls_endpoint_aliases, authenticating the client with
+// tls_client_auth or self_signed_tls_client_auth and binding the issued
+// access tokens to the certificate.
+func (p *Provider) SetClientCertificate(certPEM, keyPEM []byte) error {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return err
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return err
+		}
+	}
+
+	if _, err := withClientCertificate(p.Client().Transport, &cert); err != nil {
+		return err
+	}
+
+	p.clientCertificate = &cert
+	p.mtlsTransport.reset()
+	return nil
+}
+
+// mtlsTransport caches the transport presenting the client certificate, a
+// clone of the transport of the provider's HTTPClient. It is cloned again when
+// HTTPClient changes.
+type mtlsTransport struct {
+	mu        sync.Mutex
+	base      *http.Transport
+	transport *http.Transport
+}
+
+func (t *mtlsTransport) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.base, t.transport = nil, nil
+}
+
+// roundTripper returns the transport presenting cert cloned from base.
+func (t *mtlsTransport) roundTripper(base http.RoundTripper, cert *tls.Certificate) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	baseTransport, ok := base.(*http.Transport)
+	if !ok {
+		_, err := withClientCertificate(base, cert)
+		return errorRoundTripper{err}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.transport == nil || t.base != baseTransport {
+		t.transport, _ = withClientCertificate(baseTransport, cert)
+		t.base = baseTransport
+	}
+	return t.transport
+}
+
+// withClientCertificate returns a clone of base presenting cert. Only an
+// *http.Transport, or nil for http.DefaultTransport, can present it.
+func withClientCertificate(base http.RoundTripper, cert *tls.Certificate) (*http.Transport, error) {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	transport, ok := base.(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("openidConnect: a client certificate needs an HTTPClient with an *http.Transport, not %T", base)
+	}
+	transport = transport.Clone()
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	transport.TLSClientConfig.Certificates = []tls.Certificate{*cert}
+	return transport, nil
+}
+
+type errorRoundTripper struct {
+	err error
+}
+
+func (rt errorRoundTripper) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, rt.err
+}
+
+// CertificateThumbprint returns the base64url encoded SHA-256 thumbprint of a
+// certificate, as used in the x5t#S256 confirmation of certificate bound
+// access tokens.
+func CertificateThumbprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// ValidateCertificateBoundToken checks that a JWT access token was issued by
+// the provider, has not expired, and is bound to the client certificate set
+// with SetClientCertificate through its cnf.x5t#S256 claim. The token must be
+// meant for one of audience, the resource servers it is used with, or when
+// none are given for the client itself. Opaque access tokens cannot be checked
+// this way.
+func (p *Provider) ValidateCertificateBoundToken(accessToken string, audience ...string) error {
+	if p.clientCertificate == nil {
+		return errors.New("openidConnect: no client certificate, see SetClientCertificate")
+	}
+
+	_, claims, err := p.verifyJWT(accessToken, nil)
+	if err != nil {
+		return err
+	}
+	if len(audience) == 0 {
+		if err := p.validateIssuerAndAudience(claims); err != nil {
+			return err
+		}
+	} else {
+		if getClaimValue(claims, []string{issuerClaim}) != p.OpenIDConfig.Issuer {
+			return errors.New("issuer in token does not match issuer in OpenIDConfig discovery")
+		}
+		matches := false
+		for _, aud := range getClaimValues(claims, []string{audienceClaim}) {
+			matches = matches || contains(audience, aud)
+		}
+		if !matches {
+			return errors.New("audience in token does not match")
+		}
+	}
+	if _, err := p.validateLifetime(claims); err != nil {
+		return err
+	}
+	return validateCertificateBinding(claims, p.clientCertificate.Leaf)
+}
+
+// validateCertificateBinding checks the cnf.x5t#S256 confirmation of token
+// claims against cert.
+func validateCertificateBinding(claims map[string]interface{}, cert *x509.Certificate) error {
+	cnf, _ := claims["cnf"].(map[string]interface{})
+	thumbprint, _ := cnf["x5t#S256"].(string)
+	if thumbprint == "" {
+		return errors.New("openidConnect: token is not bound to a certificate")
+	}
+	if thumbprint != CertificateThumbprint(cert) {
+		return errors.New("openidConnect: token is bound to another certificate")
+	}
+	return nil
+}
+
+// endpointClient returns the HTTP client for calls to the provider's
+// endpoints, presenting the client certificate when one is set.
+func (p *Provider) endpointClient() *http.Client {
+	client := p.Client()
+	if p.clientCertificate == nil {
+		return client
+	}
+	mtls := *client
+	mtls.Transport = p.mtlsTransport.roundTripper(client.Transport, p.clientCertificate)
+	return &mtls
+}
+
+// endpointURL returns the mutual TLS alias of one of the provider's endpoints
+// when a client certificate is set and the provider has one.
+func (p *Provider) endpointURL(endpoint string) string {
+	aliases := p.OpenIDConfig.MTLSEndpointAliases
+	if p.clientCertificate == nil || aliases == nil {
+		return endpoint
+	}
+
+	var alias string
+	switch endpoint {
+	case p.OpenIDConfig.TokenEndpoint:
+		alias = aliases.TokenEndpoint
+	case p.OpenIDConfig.RevocationEndpoint:
+		alias = aliases.RevocationEndpoint
+	case p.OpenIDConfig.IntrospectionEndpoint:
+		alias = aliases.IntrospectionEndpoint
+	case p.OpenIDConfig.UserInfoEndpoint:
+		alias = aliases.UserInfoEndpoint
+	case p.OpenIDConfig.DeviceAuthorizationEndpoint:
+		alias = aliases.DeviceAuthorizationEndpoint
+	case p.OpenIDConfig.PushedAuthorizationRequestEndpoint:
+		alias = aliases.PushedAuthorizationRequestEndpoint
+	}
+	if alias == "" {
+		return endpoint
+	}
+	return alias
+}
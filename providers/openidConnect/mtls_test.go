@@ -0,0 +1,146 @@
+package openidConnect
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_MutualTLS(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	certPEM, keyPEM, cert := clientCertificate(t)
+
+	var thumbprint, clientID, authorization string
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) > 0 {
+			thumbprint = CertificateThumbprint(r.TLS.PeerCertificates[0])
+		}
+		r.ParseForm()
+		clientID = r.PostForm.Get("client_id")
+		authorization = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"at","token_type":"Bearer","expires_in":3600}`))
+	}))
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	ts.StartTLS()
+	defer ts.Close()
+
+	provider := tokenProvider("https://idp.example.com/token")
+	provider.HTTPClient = ts.Client()
+	provider.OpenIDConfig.TokenEndpointAuthMethodsSupported = []string{ClientSecretBasic, SelfSignedTLSClientAuth}
+	provider.OpenIDConfig.MTLSEndpointAliases = &MTLSEndpointAliases{TokenEndpoint: ts.URL + "/token"}
+	a.NoError(provider.SetClientCertificate(certPEM, keyPEM))
+	a.Equal(SelfSignedTLSClientAuth, provider.tokenEndpointAuthMethod())
+
+	token, err := provider.RefreshToken("rt")
+	a.NoError(err)
+	a.Equal("at", token.AccessToken)
+	a.Equal(CertificateThumbprint(cert), thumbprint)
+	a.Equal("client", clientID)
+	a.Empty(authorization)
+}
+
+func Test_ValidateCertificateBoundToken(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	certPEM, keyPEM, cert := clientCertificate(t)
+	provider, now := jwksProvider(t)
+
+	bound := map[string]interface{}{"x5t#S256": CertificateThumbprint(cert)}
+	accessToken := func(cnf map[string]interface{}, mutate ...func(map[string]interface{})) string {
+		claims := map[string]interface{}{
+			"iss": "https://idp.example.com",
+			"aud": "client",
+			"sub": "user-1",
+			"exp": float64(now.Add(time.Hour).Unix()),
+			"cnf": cnf,
+		}
+		for _, m := range mutate {
+			m(claims)
+		}
+		return signJWT(t, claims)
+	}
+
+	a.Error(provider.ValidateCertificateBoundToken(accessToken(nil)))
+
+	a.NoError(provider.SetClientCertificate(certPEM, keyPEM))
+	a.NoError(provider.ValidateCertificateBoundToken(accessToken(bound)))
+	a.EqualError(provider.ValidateCertificateBoundToken(accessToken(map[string]interface{}{"x5t#S256": "bm90IHRoaXMgb25l"})), "openidConnect: token is bound to another certificate")
+	a.EqualError(provider.ValidateCertificateBoundToken(accessToken(nil)), "openidConnect: token is not bound to a certificate")
+
+	api := func(c map[string]interface{}) { c["aud"] = "https://api.example.com" }
+	a.Error(provider.ValidateCertificateBoundToken(accessToken(bound, api)))
+	a.NoError(provider.ValidateCertificateBoundToken(accessToken(bound, api), "https://api.example.com"))
+	a.Error(provider.ValidateCertificateBoundToken(accessToken(bound), "https://api.example.com"))
+	a.Error(provider.ValidateCertificateBoundToken(accessToken(bound, func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" })))
+	a.Error(provider.ValidateCertificateBoundToken(accessToken(bound, func(c map[string]interface{}) { c["exp"] = float64(now.Add(-time.Hour).Unix()) })))
+}
+
+func Test_SetClientCertificate_KeepsTransport(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	certPEM, keyPEM, _ := clientCertificate(t)
+	provider := tokenProvider("https://idp.example.com/token")
+
+	proxy, _ := url.Parse("http://proxy.example.com:3128")
+	provider.HTTPClient = &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxy)}}
+	a.NoError(provider.SetClientCertificate(certPEM, keyPEM))
+
+	transport := provider.endpointClient().Transport.(*http.Transport)
+	a.Len(transport.TLSClientConfig.Certificates, 1)
+	a.NotNil(transport.Proxy)
+	a.Same(transport, provider.endpointClient().Transport, "the clone is reused")
+
+	// later changes to HTTPClient are picked up
+	provider.HTTPClient = &http.Client{Transport: &http.Transport{}, Timeout: time.Second}
+	client := provider.endpointClient()
+	a.Equal(time.Second, client.Timeout)
+	a.Nil(client.Transport.(*http.Transport).Proxy)
+	a.Len(client.Transport.(*http.Transport).TLSClientConfig.Certificates, 1)
+
+	// other round trippers cannot present the certificate
+	provider.HTTPClient = &http.Client{Transport: errorRoundTripper{}}
+	a.Error(provider.SetClientCertificate(certPEM, keyPEM))
+	_, err := provider.RefreshToken("rt")
+	a.Error(err)
+}
+
+func clientCertificate(t *testing.T) ([]byte, []byte, *x509.Certificate) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}),
+		cert
+}
@@ -3,6 +3,8 @@ package openidConnect
 import (
 	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -11,6 +13,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	rmxOAuth "github.com/rapidmidiex/oauth"
@@ -20,10 +23,12 @@ import (
 const (
 	// Standard Claims http://openid.net/specs/openid-connect-core-1_0.html#StandardClaims
 	// fixed, cannot be changed
-	subjectClaim  = "sub"
-	expiryClaim   = "exp"
-	audienceClaim = "aud"
-	issuerClaim   = "iss"
+	subjectClaim   = "sub"
+	expiryClaim    = "exp"
+	audienceClaim  = "aud"
+	issuerClaim    = "iss"
+	issuedAtClaim  = "iat"
+	notBeforeClaim = "nbf"
 
 	PreferredUsernameClaim = "preferred_username"
 	EmailClaim             = "email"
@@ -33,21 +38,39 @@ const (
 	GivenNameClaim         = "given_name"
 	FamilyNameClaim        = "family_name"
 	AddressClaim           = "address"
+	RolesClaim             = "roles"
+	GroupsClaim            = "groups"
+	EmailVerifiedClaim     = "email_verified"
+	LocaleClaim            = "locale"
+	ProfileClaim           = "profile"
+
+	// RealmRolesClaim is where Keycloak puts the user's realm roles
+	RealmRolesClaim = "realm_access.roles"
 
 	// Unused but available to set in Provider claims
 	MiddleNameClaim          = "middle_name"
-	ProfileClaim             = "profile"
 	WebsiteClaim             = "website"
-	EmailVerifiedClaim       = "email_verified"
 	GenderClaim              = "gender"
 	BirthdateClaim           = "birthdate"
 	ZoneinfoClaim            = "zoneinfo"
-	LocaleClaim              = "locale"
 	PhoneNumberClaim         = "phone_number"
 	PhoneNumberVerifiedClaim = "phone_number_verified"
 	UpdatedAtClaim           = "updated_at"
 
-	clockSkew = 10 * time.Second
+	// DefaultClockSkew is the tolerance applied to time based checks when
+	// the Provider is created through one of the constructors.
+	DefaultClockSkew = 10 * time.Second
+
+	// DefaultStateTTL is how long an authorization request started by
+	// BeginAuth stays valid when the Provider is created through one of the
+	// constructors.
+	DefaultStateTTL = 10 * time.Minute
+
+	// DefaultIntrospectionCacheTTL and DefaultIntrospectionNegativeCacheTTL
+	// are how long Introspect caches active and inactive results when the
+	// Provider is created through one of the constructors.
+	DefaultIntrospectionCacheTTL         = 30 * time.Second
+	DefaultIntrospectionNegativeCacheTTL = 5 * time.Second
 )
 
 // Provider is the implementation of `goth.Provider` for accessing OpenID Connect provider
@@ -68,14 +91,119 @@ type Provider struct {
 	FirstNameClaims []string
 	LastNameClaims  []string
 	LocationClaims  []string
+	// RolesClaims and GroupsClaims map the user's roles and groups. Like
+	// the other claim mappings they accept dotted paths and JSON pointers.
+	RolesClaims  []string
+	GroupsClaims []string
+	// EmailVerifiedClaims map whether the email is verified. The claim is
+	// true when it is the boolean true or the string "true".
+	EmailVerifiedClaims []string
+	UsernameClaims      []string
+	LocaleClaims        []string
+	ProfileURLClaims    []string
 
 	SkipUserInfoRequest bool
+
+	// SigningAlgorithms restricts the algorithms accepted for the JWTs the
+	// provider signs. When empty, those of the discovery metadata for the
+	// kind of token are accepted, or RS256 when it lists none. HMAC
+	// algorithms are only accepted from clients with a Secret.
+	SigningAlgorithms []string
+
+	// PostLogoutRedirectURIs lists the URIs the LogoutHandler may send the
+	// user back to after logging out at the provider.
+	PostLogoutRedirectURIs []string
+	// FrontChannelLogoutSessionRequired mirrors the client registration
+	// parameter of the same name: front-channel logout requests must then
+	// carry the iss and sid query parameters.
+	FrontChannelLogoutSessionRequired bool
+
+	// Clock is used for every expiry check. It defaults to the system clock.
+	Clock rmxOAuth.Clock
+	// ClockSkew is the tolerance allowed between our clock and the
+	// provider's when validating tokens, state and refresh deadlines.
+	ClockSkew time.Duration
+	// StateTTL limits how long after BeginAuth the callback may be
+	// authorized. Zero disables the check.
+	StateTTL time.Duration
+
+	// TokenEndpointAuthMethod is one of ClientSecretBasic, ClientSecretPost,
+	// ClientSecretJWT, PrivateKeyJWT, TLSClientAuth or
+	// SelfSignedTLSClientAuth. When empty it is picked from the
+	// provider's discovery metadata.
+	TokenEndpointAuthMethod string
+
+	// UsePushedAuthorizationRequests sends the authorization request
+	// parameters to the pushed_authorization_request_endpoint instead of
+	// putting them in the auth URL. It is implied when the provider's
+	// discovery metadata sets require_pushed_authorization_requests.
+	UsePushedAuthorizationRequests bool
+
+	// ResponseMode is sent as the response_mode of the authorization request
+	// when set. The JWT modes require the response to be a signed JWT.
+	ResponseMode string
+
+	// ClaimsProviderJWKS maps the issuers of aggregated and distributed
+	// claims, other than the provider itself, to their jwks_uri. Claims from
+	// other issuers are rejected.
+	ClaimsProviderJWKS map[string]string
+
+	// IntrospectionCacheTTL and IntrospectionNegativeCacheTTL are how long
+	// Introspect caches active and inactive results. Zero disables caching.
+	IntrospectionCacheTTL         time.Duration
+	IntrospectionNegativeCacheTTL time.Duration
+
+	// UseDPoP binds the tokens of every session to a key pair generated in
+	// BeginAuth, as described in RFC 9449. The private keys are kept in
+	// DPoPKeys, and the Session only holds the ID of its key.
+	UseDPoP  bool
+	DPoPKeys DPoPKeyStore
+
+	// ClaimsRequest is sent as the claims parameter of the authorization
+	// request when set.
+	ClaimsRequest *ClaimsRequest
+	// EncryptRequestObjects encrypts the request objects signed with the
+	// key set through SetRequestObjectKey to one of the provider's keys.
+	EncryptRequestObjects bool
+
+	jwks                 keySet
+	claimsProviderJWKS   sync.Map
+	clientAssertionKey   interface{}
+	clientAssertionKeyID string
+	requestObjectKey     interface{}
+	requestObjectKeyID   string
+	dpopNonces           sync.Map
+	clientCertificate    *tls.Certificate
+	mtlsTransport        mtlsTransport
+	introspection        introspectionCache
+	decryptionKey        interface{}
 }
 
 type OpenIDConfig struct {
 	AuthEndpoint     string `json:"authorization_endpoint"`
 	TokenEndpoint    string `json:"token_endpoint"`
 	UserInfoEndpoint string `json:"userinfo_endpoint"`
+	JWKSURI          string `json:"jwks_uri,omitempty"`
+
+	RevocationEndpoint                string   `json:"revocation_endpoint,omitempty"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint,omitempty"`
+	DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint,omitempty"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported,omitempty"`
+
+	PushedAuthorizationRequestEndpoint string `json:"pushed_authorization_request_endpoint,omitempty"`
+	RequirePushedAuthorizationRequests bool   `json:"require_pushed_authorization_requests,omitempty"`
+
+	ResponseModesSupported []string `json:"response_modes_supported,omitempty"`
+
+	MTLSEndpointAliases                   *MTLSEndpointAliases `json:"mtls_endpoint_aliases,omitempty"`
+	TLSClientCertificateBoundAccessTokens bool                 `json:"tls_client_certificate_bound_access_tokens,omitempty"`
+
+	RequestObjectEncryptionAlgValuesSupported []string `json:"request_object_encryption_alg_values_supported,omitempty"`
+	RequestObjectEncryptionEncValuesSupported []string `json:"request_object_encryption_enc_values_supported,omitempty"`
+
+	IDTokenSigningAlgValuesSupported       []string `json:"id_token_signing_alg_values_supported,omitempty"`
+	UserInfoSigningAlgValuesSupported      []string `json:"userinfo_signing_alg_values_supported,omitempty"`
+	AuthorizationSigningAlgValuesSupported []string `json:"authorization_signing_alg_values_supported,omitempty"`
 
 	// If OpenID discovery is enabled, the end_session_endpoint field can optionally be provided
 	// in the discovery endpoint response according to OpenID spec. See:
@@ -105,8 +233,8 @@ type RefreshTokenResponse struct {
 // one manually.
 // New returns an implementation of an OpenID Connect Authorization Code Flow
 // See http://openid.net/specs/openid-connect-core-1_0.html#CodeFlowAuth
-// ID Token decryption is not (yet) supported
-// UserInfo decryption is not (yet) supported
+// Encrypted ID Tokens and UserInfo responses are decrypted with the key set
+// through SetDecryptionKey.
 func New(clientKey, secret, callbackURL, openIDAutoDiscoveryURL string, scopes ...string) (*Provider, error) {
 	return NewNamed("", clientKey, secret, callbackURL, openIDAutoDiscoveryURL, scopes...)
 }
@@ -133,6 +261,19 @@ func NewNamed(name, clientKey, secret, callbackURL, openIDAutoDiscoveryURL strin
 		FirstNameClaims: []string{GivenNameClaim},
 		LastNameClaims:  []string{FamilyNameClaim},
 		LocationClaims:  []string{AddressClaim},
+		RolesClaims:     []string{RolesClaim, RealmRolesClaim},
+		GroupsClaims:    []string{GroupsClaim},
+
+		EmailVerifiedClaims: []string{EmailVerifiedClaim},
+		UsernameClaims:      []string{PreferredUsernameClaim},
+		LocaleClaims:        []string{LocaleClaim},
+		ProfileURLClaims:    []string{ProfileClaim},
+
+		ClockSkew: DefaultClockSkew,
+		StateTTL:  DefaultStateTTL,
+
+		IntrospectionCacheTTL:         DefaultIntrospectionCacheTTL,
+		IntrospectionNegativeCacheTTL: DefaultIntrospectionNegativeCacheTTL,
 
 		providerName: name,
 	}
@@ -169,6 +310,19 @@ func NewCustomisedURL(clientKey, secret, callbackURL, authURL, tokenURL, issuerU
 		FirstNameClaims: []string{GivenNameClaim},
 		LastNameClaims:  []string{FamilyNameClaim},
 		LocationClaims:  []string{AddressClaim},
+		RolesClaims:     []string{RolesClaim, RealmRolesClaim},
+		GroupsClaims:    []string{GroupsClaim},
+
+		EmailVerifiedClaims: []string{EmailVerifiedClaim},
+		UsernameClaims:      []string{PreferredUsernameClaim},
+		LocaleClaims:        []string{LocaleClaim},
+		ProfileURLClaims:    []string{ProfileClaim},
+
+		ClockSkew: DefaultClockSkew,
+		StateTTL:  DefaultStateTTL,
+
+		IntrospectionCacheTTL:         DefaultIntrospectionCacheTTL,
+		IntrospectionNegativeCacheTTL: DefaultIntrospectionNegativeCacheTTL,
 
 		providerName: "openid-connect",
 	}
@@ -191,14 +345,54 @@ func (p *Provider) Client() *http.Client {
 	return rmxOAuth.HTTPClientWithFallBack(p.HTTPClient)
 }
 
+// now returns the current time according to the provider's Clock.
+func (p *Provider) now() time.Time {
+	return rmxOAuth.ClockWithFallBack(p.Clock).Now()
+}
+
 // Debug is a no-op for the openidConnect package.
 func (p *Provider) Debug(debug bool) {}
 
 // BeginAuth asks the OpenID Connect provider for an authentication end-point.
 func (p *Provider) BeginAuth(state string) (rmxOAuth.Session, error) {
-	url := p.config.AuthCodeURL(state)
-	session := &Session{
-		AuthURL: url,
+	return p.BeginAuthWithOptions(state)
+}
+
+// BeginAuthWithOptions is like BeginAuth, adding opts to the authorization
+// request.
+func (p *Provider) BeginAuthWithOptions(state string, opts ...oauth2.AuthCodeOption) (rmxOAuth.Session, error) {
+	if p.ResponseMode != "" {
+		opts = append(opts, oauth2.SetAuthURLParam("response_mode", p.ResponseMode))
+	}
+	if p.ClaimsRequest != nil {
+		claims, err := json.Marshal(p.ClaimsRequest)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, oauth2.SetAuthURLParam("claims", string(claims)))
+	}
+
+	session := &Session{ResponseMode: p.ResponseMode}
+	if p.UseDPoP {
+		jkt, err := p.newDPoPKey(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		session.DPoPKeyID = jkt
+		opts = append(opts, oauth2.SetAuthURLParam("dpop_jkt", jkt))
+	}
+
+	url, expiresAt, err := p.authorizationURL(context.Background(), p.config.AuthCodeURL(state, opts...))
+	if err != nil {
+		return nil, err
+	}
+	session.AuthURL = url
+	if p.StateTTL > 0 {
+		session.StateExpiresAt = p.now().Add(p.StateTTL)
+	}
+	// the provider rejects a pushed request once its request_uri expired
+	if !expiresAt.IsZero() && (session.StateExpiresAt.IsZero() || expiresAt.Before(session.StateExpiresAt)) {
+		session.StateExpiresAt = expiresAt
 	}
 	return session, nil
 }
@@ -213,8 +407,13 @@ func (p *Provider) FetchUser(session rmxOAuth.Session) (rmxOAuth.User, error) {
 		return rmxOAuth.User{}, fmt.Errorf("%s cannot get user information without id_token", p.providerName)
 	}
 
+	idToken, err := p.decrypt(sess.IDToken)
+	if err != nil {
+		return rmxOAuth.User{}, err
+	}
+
 	// decode returned id token to get expiry
-	claims, err := decodeJWT(sess.IDToken)
+	claims, err := decodeJWT(idToken)
 
 	if err != nil {
 		return rmxOAuth.User{}, fmt.Errorf("oauth2: error decoding JWT token: %v", err)
@@ -229,7 +428,11 @@ func (p *Provider) FetchUser(session rmxOAuth.Session) (rmxOAuth.User, error) {
 		expiresAt = expiry
 	}
 
-	if err := p.getUserInfo(sess.AccessToken, claims); err != nil {
+	if err := p.getUserInfo(sess, claims); err != nil {
+		return rmxOAuth.User{}, err
+	}
+
+	if err := p.resolveClaimSources(context.Background(), claims); err != nil {
 		return rmxOAuth.User{}, err
 	}
 
@@ -240,6 +443,7 @@ func (p *Provider) FetchUser(session rmxOAuth.Session) (rmxOAuth.User, error) {
 		ExpiresAt:    expiresAt,
 		RawData:      claims,
 		IDToken:      sess.IDToken,
+		SessionID:    sess.SessionID,
 	}
 
 	p.userFromClaims(claims, &user)
@@ -251,63 +455,111 @@ func (p *Provider) RefreshTokenAvailable() bool {
 	return true
 }
 
+// NeedsRefresh reports whether a token expiring at expiresAt should be
+// refreshed now. Tokens are considered expired ClockSkew before their expiry
+// so they are not rejected by a provider whose clock runs ahead of ours. A zero
+// expiresAt means the token does not expire.
+func (p *Provider) NeedsRefresh(expiresAt time.Time) bool {
+	if expiresAt.IsZero() {
+		return false
+	}
+	return !p.now().Before(expiresAt.Add(-p.ClockSkew))
+}
+
 // RefreshToken get new access token based on the refresh token
 func (p *Provider) RefreshToken(refreshToken string) (*oauth2.Token, error) {
-	token := &oauth2.Token{RefreshToken: refreshToken}
-	ts := p.config.TokenSource(context.Background(), token)
-	newToken, err := ts.Token()
-	if err != nil {
-		return nil, err
-	}
-	return newToken, err
+	return p.requestToken(context.Background(), url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+	})
 }
 
 // The ID token is a fundamental part of the OpenID connect refresh token flow but is not part of the OAuth flow.
-// The existing RefreshToken function leverages the OAuth library's refresh token mechanism, ignoring the refreshed
-// ID token. As a result, a new function needs to be exposed (rather than changing the existing function, for backwards
-// compatibility purposes) that also returns the id_token in the OpenID refresh token flow API response
+// RefreshToken returns an *oauth2.Token, on which a refreshed ID token is only reachable through Extra.
+// RefreshTokenWithIDToken returns the id_token of the OpenID refresh token flow API response directly.
 // Learn more about ID tokens: https://openid.net/specs/openid-connect-core-1_0.html#IDToken
 func (p *Provider) RefreshTokenWithIDToken(refreshToken string) (*RefreshTokenResponse, error) {
-	urlValues := url.Values{
+	body, err := p.postForm(context.Background(), p.OpenIDConfig.TokenEndpoint, url.Values{
 		"grant_type":    {"refresh_token"},
 		"refresh_token": {refreshToken},
-		"client_id":     {p.ClientKey},
-		"client_secret": {p.Secret},
-	}
-	req, err := http.NewRequest("POST", p.OpenIDConfig.TokenEndpoint, strings.NewReader(urlValues.Encode()))
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	refreshTokenResponse := &RefreshTokenResponse{}
 
-	resp, err := p.Client().Do(req)
+	err = json.Unmarshal(body, refreshTokenResponse)
 	if err != nil {
 		return nil, err
 	}
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("Non-200 response from RefreshToken: %d, WWW-Authenticate=%s", resp.StatusCode, resp.Header.Get("WWW-Authenticate"))
-	}
 
-	body, err := ioutil.ReadAll(resp.Body)
+	refreshTokenResponse.IdToken, err = p.decrypt(refreshTokenResponse.IdToken)
 	if err != nil {
 		return nil, err
 	}
-	resp.Body.Close()
 
-	refreshTokenResponse := &RefreshTokenResponse{}
+	return refreshTokenResponse, nil
+}
 
-	err = json.Unmarshal(body, refreshTokenResponse)
-	if err != nil {
-		return nil, err
+// Revoke asks the provider to revoke an access or refresh token, as described
+// in RFC 7009. tokenTypeHint may be "access_token", "refresh_token" or empty.
+func (p *Provider) Revoke(token, tokenTypeHint string) error {
+	if p.OpenIDConfig.RevocationEndpoint == "" {
+		return errors.New("openidConnect: provider has no revocation_endpoint")
 	}
 
-	return refreshTokenResponse, nil
+	values := url.Values{"token": {token}}
+	if tokenTypeHint != "" {
+		values.Set("token_type_hint", tokenTypeHint)
+	}
+	_, err := p.postForm(context.Background(), p.OpenIDConfig.RevocationEndpoint, values)
+	return err
 }
 
 // validate according to standard, returns expiry
 // http://openid.net/specs/openid-connect-core-1_0.html#IDTokenValidation
 func (p *Provider) validateClaims(claims map[string]interface{}) (time.Time, error) {
+	if err := p.validateIssuerAndAudience(claims); err != nil {
+		return time.Time{}, err
+	}
+	return p.validateLifetime(claims)
+}
+
+// validateLifetime checks the exp, nbf and iat claims of a JWT, returning its
+// expiry.
+func (p *Provider) validateLifetime(claims map[string]interface{}) (time.Time, error) {
+	now := p.now()
+
+	// expiry is required for JWT, not for UserInfoResponse
+	// is actually a int64, so force it in to that type
+	exp, ok := claims[expiryClaim].(float64)
+	if !ok {
+		return time.Time{}, errors.New("JWT token does not contain an expiry")
+	}
+	expiry := time.Unix(int64(exp), 0)
+	if expiry.Add(p.ClockSkew).Before(now) {
+		return time.Time{}, errors.New("JWT token is expired")
+	}
+
+	// nbf and iat are optional, but when present the token must not be
+	// from the future
+	if nbf, ok := claims[notBeforeClaim].(float64); ok {
+		if time.Unix(int64(nbf), 0).Add(-p.ClockSkew).After(now) {
+			return time.Time{}, errors.New("JWT token is not valid yet")
+		}
+	}
+	if iat, ok := claims[issuedAtClaim].(float64); ok {
+		if time.Unix(int64(iat), 0).Add(-p.ClockSkew).After(now) {
+			return time.Time{}, errors.New("JWT token was issued in the future")
+		}
+	}
+	return expiry, nil
+}
+
+// validateIssuerAndAudience checks that a JWT was issued by the provider for
+// this client.
+func (p *Provider) validateIssuerAndAudience(claims map[string]interface{}) error {
 	audience := getClaimValue(claims, []string{audienceClaim})
 	if audience != p.ClientKey {
 		found := false
@@ -319,23 +571,15 @@ func (p *Provider) validateClaims(claims map[string]interface{}) (time.Time, err
 			}
 		}
 		if !found {
-			return time.Time{}, errors.New("audience in token does not match client key")
+			return errors.New("audience in token does not match client key")
 		}
 	}
 
 	issuer := getClaimValue(claims, []string{issuerClaim})
 	if issuer != p.OpenIDConfig.Issuer {
-		return time.Time{}, errors.New("issuer in token does not match issuer in OpenIDConfig discovery")
-	}
-
-	// expiry is required for JWT, not for UserInfoResponse
-	// is actually a int64, so force it in to that type
-	expiryClaim := int64(claims[expiryClaim].(float64))
-	expiry := time.Unix(expiryClaim, 0)
-	if expiry.Add(clockSkew).Before(time.Now()) {
-		return time.Time{}, errors.New("user info JWT token is expired")
+		return errors.New("issuer in token does not match issuer in OpenIDConfig discovery")
 	}
-	return expiry, nil
+	return nil
 }
 
 func (p *Provider) userFromClaims(claims map[string]interface{}, user *rmxOAuth.User) {
@@ -349,15 +593,28 @@ func (p *Provider) userFromClaims(claims map[string]interface{}, user *rmxOAuth.
 	user.FirstName = getClaimValue(claims, p.FirstNameClaims)
 	user.LastName = getClaimValue(claims, p.LastNameClaims)
 	user.Location = getClaimValue(claims, p.LocationClaims)
+	user.Roles = getClaimValues(claims, p.RolesClaims)
+	user.Groups = getClaimValues(claims, p.GroupsClaims)
+	user.EmailVerified = getClaimValue(claims, p.EmailVerifiedClaims) == "true"
+	user.Username = getClaimValue(claims, p.UsernameClaims)
+	user.Locale = getClaimValue(claims, p.LocaleClaims)
+	user.ProfileURL = getClaimValue(claims, p.ProfileURLClaims)
+	if sid := getClaimValue(claims, []string{sessionIDClaim}); sid != "" {
+		user.SessionID = sid
+	}
 }
 
-func (p *Provider) getUserInfo(accessToken string, claims map[string]interface{}) error {
+func (p *Provider) getUserInfo(sess *Session, claims map[string]interface{}) error {
 	// skip if there is no UserInfoEndpoint or is explicitly disabled
 	if p.OpenIDConfig.UserInfoEndpoint == "" || p.SkipUserInfoRequest {
 		return nil
 	}
 
-	userInfoClaims, err := p.fetchUserInfo(p.OpenIDConfig.UserInfoEndpoint, accessToken)
+	dpopKey, err := p.dpopKey(context.Background(), sess)
+	if err != nil {
+		return err
+	}
+	userInfoClaims, err := p.fetchUserInfo(p.endpointURL(p.OpenIDConfig.UserInfoEndpoint), sess.AccessToken, dpopKey)
 	if err != nil {
 		return err
 	}
@@ -385,19 +642,27 @@ func (p *Provider) getUserInfo(accessToken string, claims map[string]interface{}
 	return nil
 }
 
-// fetch and decode JSON from the given UserInfo URL
-func (p *Provider) fetchUserInfo(url, accessToken string) (map[string]interface{}, error) {
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
-
-	resp, err := p.Client().Do(req)
+// fetch and decode JSON from the given UserInfo URL, presenting a DPoP bound
+// access token when dpopKey is set
+func (p *Provider) fetchUserInfo(url, accessToken string, dpopKey *ecdsa.PrivateKey) (map[string]interface{}, error) {
+	var resp *http.Response
+	var err error
+	if dpopKey != nil {
+		resp, err = p.doDPoP(context.Background(), dpopKey, accessToken, func() (*http.Request, error) {
+			return http.NewRequest("GET", url, nil)
+		})
+	} else {
+		req, _ := http.NewRequest("GET", url, nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+		resp, err = p.endpointClient().Do(req)
+	}
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("Non-200 response from UserInfo: %d, WWW-Authenticate=%s", resp.StatusCode, resp.Header.Get("WWW-Authenticate"))
+		return nil, &rmxOAuth.StatusError{StatusCode: resp.StatusCode, Message: fmt.Sprintf("Non-200 response from UserInfo: %d, WWW-Authenticate=%s", resp.StatusCode, resp.Header.Get("WWW-Authenticate"))}
 	}
 
 	// The UserInfo Claims MUST be returned as the members of a JSON object
@@ -407,6 +672,10 @@ func (p *Provider) fetchUserInfo(url, accessToken string) (map[string]interface{
 		return nil, err
 	}
 
+	// or as a signed and/or encrypted JWT
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/jwt") {
+		return p.userInfoJWT(data)
+	}
 	return unMarshal(data)
 }
 
@@ -467,10 +736,12 @@ func newConfig(provider *Provider, scopes []string, openIDConfig *OpenIDConfig)
 	return c
 }
 
+// getClaimValue returns the first non-empty value of the claims, which may be
+// paths as described for lookupClaim, converted to a string.
 func getClaimValue(data map[string]interface{}, claims []string) string {
 	for _, claim := range claims {
-		if value, ok := data[claim]; ok {
-			if stringValue, ok := value.(string); ok && len(stringValue) > 0 {
+		if value, ok := lookupClaim(data, claim); ok {
+			if stringValue := claimString(value); len(stringValue) > 0 {
 				return stringValue
 			}
 		}
@@ -479,16 +750,18 @@ func getClaimValue(data map[string]interface{}, claims []string) string {
 	return ""
 }
 
+// getClaimValues returns the values of every claim, single or multi valued,
+// without duplicates.
 func getClaimValues(data map[string]interface{}, claims []string) []string {
 	var result []string
+	seen := map[string]bool{}
 
 	for _, claim := range claims {
-		if value, ok := data[claim]; ok {
-			if stringValues, ok := value.([]interface{}); ok {
-				for _, stringValue := range stringValues {
-					if s, ok := stringValue.(string); ok && len(s) > 0 {
-						result = append(result, s)
-					}
+		if value, ok := lookupClaim(data, claim); ok {
+			for _, s := range claimStrings(value) {
+				if !seen[s] {
+					seen[s] = true
+					result = append(result, s)
 				}
 			}
 		}
@@ -6,9 +6,11 @@ import (
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	rmxOAuth "github.com/rapidmidiex/oauth"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
 )
 
 var (
@@ -35,6 +37,7 @@ func Test_New(t *testing.T) {
 	a.Equal("https://accounts.google.com/o/oauth2/v2/auth", provider.OpenIDConfig.AuthEndpoint)
 	a.Equal("https://www.googleapis.com/oauth2/v4/token", provider.OpenIDConfig.TokenEndpoint)
 	a.Equal("https://www.googleapis.com/oauth2/v3/userinfo", provider.OpenIDConfig.UserInfoEndpoint)
+	a.Equal("https://www.googleapis.com/oauth2/v3/certs", provider.OpenIDConfig.JWKSURI)
 }
 
 func Test_NewCustomisedURL(t *testing.T) {
@@ -78,6 +81,18 @@ func Test_BeginAuth(t *testing.T) {
 	a.Contains(s.AuthURL, "scope=openid")
 }
 
+func Test_BeginAuthWithOptions(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	provider := openidConnectProvider()
+	session, err := provider.BeginAuthWithOptions("test_state", oauth2.SetAuthURLParam("redirect_uri", "http://127.0.0.1:1234/callback"))
+	s := session.(*Session)
+	a.NoError(err)
+	a.Contains(s.AuthURL, "redirect_uri=http%3A%2F%2F127.0.0.1%3A1234%2Fcallback")
+	a.Implements((*rmxOAuth.AuthOptionsProvider)(nil), provider)
+}
+
 func Test_Implements_Provider(t *testing.T) {
 	t.Parallel()
 	a := assert.New(t)
@@ -99,6 +114,96 @@ func Test_SessionFromJSON(t *testing.T) {
 	a.Equal("abc", session.IDToken)
 }
 
+func Test_ValidateClaims(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	now := time.Unix(1700000000, 0)
+	provider := openidConnectProvider()
+	provider.ClientKey = "client"
+	provider.Clock = rmxOAuth.ClockFunc(func() time.Time { return now })
+	provider.ClockSkew = 30 * time.Second
+
+	claims := func(exp, iat int64) map[string]interface{} {
+		return map[string]interface{}{
+			"aud": "client",
+			"iss": "https://accounts.google.com",
+			"exp": float64(exp),
+			"iat": float64(iat),
+		}
+	}
+
+	expiry, err := provider.validateClaims(claims(now.Unix()+60, now.Unix()))
+	a.NoError(err)
+	a.Equal(time.Unix(now.Unix()+60, 0), expiry)
+
+	// expired, but within the allowed skew
+	_, err = provider.validateClaims(claims(now.Unix()-20, now.Unix()-80))
+	a.NoError(err)
+
+	_, err = provider.validateClaims(claims(now.Unix()-40, now.Unix()-100))
+	a.EqualError(err, "JWT token is expired")
+
+	_, err = provider.validateClaims(claims(now.Unix()+600, now.Unix()+60))
+	a.EqualError(err, "JWT token was issued in the future")
+
+	_, err = provider.validateClaims(map[string]interface{}{"aud": "client", "iss": "https://accounts.google.com"})
+	a.EqualError(err, "JWT token does not contain an expiry")
+}
+
+func Test_NeedsRefresh(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	now := time.Unix(1700000000, 0)
+	provider := openidConnectProvider()
+	provider.Clock = rmxOAuth.ClockFunc(func() time.Time { return now })
+
+	a.False(provider.NeedsRefresh(time.Time{}))
+	a.False(provider.NeedsRefresh(now.Add(time.Minute)))
+	a.True(provider.NeedsRefresh(now.Add(DefaultClockSkew / 2)))
+	a.True(provider.NeedsRefresh(now.Add(-time.Minute)))
+}
+
+func Test_UserFromClaims_SessionID(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	provider := openidConnectProvider()
+	user := rmxOAuth.User{}
+	provider.userFromClaims(map[string]interface{}{"sub": "user-1", "sid": "session-1"}, &user)
+	a.Equal("user-1", user.UserID)
+	a.Equal("session-1", user.SessionID)
+}
+
+func Test_UserFromClaims_Profile(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	provider := openidConnectProvider()
+	user := rmxOAuth.User{}
+	provider.userFromClaims(map[string]interface{}{
+		"sub":                "user-1",
+		"email":              "drummer@example.com",
+		"email_verified":     true,
+		"preferred_username": "drummer",
+		"locale":             "de-DE",
+		"profile":            "https://idp.example.com/users/drummer",
+	}, &user)
+	a.True(user.EmailVerified)
+	a.Equal("drummer", user.Username)
+	a.Equal("de-DE", user.Locale)
+	a.Equal("https://idp.example.com/users/drummer", user.ProfileURL)
+
+	// some providers send the claim as a string
+	user = rmxOAuth.User{}
+	provider.userFromClaims(map[string]interface{}{"sub": "user-1", "email_verified": "true"}, &user)
+	a.True(user.EmailVerified)
+	user = rmxOAuth.User{}
+	provider.userFromClaims(map[string]interface{}{"sub": "user-1", "email_verified": false}, &user)
+	a.False(user.EmailVerified)
+}
+
 func openidConnectProvider() *Provider {
 	provider, _ := New(os.Getenv("OPENID_CONNECT_KEY"), os.Getenv("OPENID_CONNECT_SECRET"), "http://localhost/foo", server.URL)
 	return provider
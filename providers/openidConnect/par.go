@@ -0,0 +1,49 @@
+package openidConnect
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"time"
+)
+
+// usePushedAuthorizationRequests reports whether authorization requests are
+// pushed to the provider first.
+func (p *Provider) usePushedAuthorizationRequests() bool {
+	return p.UsePushedAuthorizationRequests || p.OpenIDConfig.RequirePushedAuthorizationRequests
+}
+
+// pushAuthorizationRequest posts the authorization request parameters to the
+// provider's pushed_authorization_request_endpoint and returns the
+// request_uri referencing them, along with when it expires. The session's
+// StateExpiresAt is capped at that time, so that a callback arriving later
+// is rejected.
+// See https://datatracker.ietf.org/doc/html/rfc9126
+func (p *Provider) pushAuthorizationRequest(ctx context.Context, params url.Values) (string, time.Time, error) {
+	if p.OpenIDConfig.PushedAuthorizationRequestEndpoint == "" {
+		return "", time.Time{}, errors.New("openidConnect: provider has no pushed_authorization_request_endpoint")
+	}
+
+	pushedAt := p.now()
+	body, err := p.postForm(ctx, p.OpenIDConfig.PushedAuthorizationRequestEndpoint, params)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	var par struct {
+		RequestURI string `json:"request_uri"`
+		ExpiresIn  int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &par); err != nil {
+		return "", time.Time{}, err
+	}
+	if par.RequestURI == "" {
+		return "", time.Time{}, errors.New("openidConnect: pushed authorization response missing request_uri")
+	}
+	expiresAt := pushedAt.Add(time.Duration(par.ExpiresIn) * time.Second)
+	if !p.now().Before(expiresAt) {
+		return "", time.Time{}, errors.New("openidConnect: pushed authorization request_uri expired")
+	}
+	return par.RequestURI, expiresAt, nil
+}
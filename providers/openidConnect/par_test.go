@@ -0,0 +1,114 @@
+package openidConnect
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	rmxOAuth "github.com/rapidmidiex/oauth"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_BeginAuth_PushedAuthorizationRequest(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	var pushed url.Values
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		pushed = r.PostForm
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"request_uri":"urn:ietf:params:oauth:request_uri:6esc_11ACC5bwc014ltc14eY22c","expires_in":60}`))
+	}))
+	defer ts.Close()
+
+	provider := tokenProvider("https://idp.example.com/token")
+	provider.OpenIDConfig.PushedAuthorizationRequestEndpoint = ts.URL
+	provider.OpenIDConfig.RequirePushedAuthorizationRequests = true
+
+	session, err := provider.BeginAuth("test_state")
+	a.NoError(err)
+
+	a.Equal("client", pushed.Get("client_id"))
+	a.Equal("code", pushed.Get("response_type"))
+	a.Equal("http://localhost/foo", pushed.Get("redirect_uri"))
+	a.Equal("openid", pushed.Get("scope"))
+	a.Equal("test_state", pushed.Get("state"))
+
+	u, err := url.Parse(session.(*Session).AuthURL)
+	a.NoError(err)
+	a.Equal("https://idp.example.com/auth", u.Scheme+"://"+u.Host+u.Path)
+	a.Equal(url.Values{
+		"client_id":   {"client"},
+		"request_uri": {"urn:ietf:params:oauth:request_uri:6esc_11ACC5bwc014ltc14eY22c"},
+		"state":       {"test_state"},
+	}, u.Query())
+}
+
+func Test_BeginAuth_PushedAuthorizationRequestError(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_request","error_description":"redirect_uri not registered"}`))
+	}))
+	defer ts.Close()
+
+	provider := tokenProvider("https://idp.example.com/token")
+	provider.OpenIDConfig.PushedAuthorizationRequestEndpoint = ts.URL
+	provider.UsePushedAuthorizationRequests = true
+
+	_, err := provider.BeginAuth("test_state")
+	a.EqualError(err, "oauth2: invalid_request: redirect_uri not registered")
+}
+
+func Test_BeginAuth_PushedAuthorizationRequestExpired(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"request_uri":"urn:ietf:params:oauth:request_uri:6esc_11ACC5bwc014ltc14eY22c","expires_in":0}`))
+	}))
+	defer ts.Close()
+
+	provider := tokenProvider("https://idp.example.com/token")
+	provider.OpenIDConfig.PushedAuthorizationRequestEndpoint = ts.URL
+	provider.UsePushedAuthorizationRequests = true
+
+	_, err := provider.BeginAuth("test_state")
+	a.EqualError(err, "openidConnect: pushed authorization request_uri expired")
+}
+
+func Test_BeginAuth_PushedAuthorizationRequestExpiresState(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"request_uri":"urn:ietf:params:oauth:request_uri:6esc_11ACC5bwc014ltc14eY22c","expires_in":60}`))
+	}))
+	defer ts.Close()
+
+	now := time.Now()
+	provider := tokenProvider("https://idp.example.com/token")
+	provider.Clock = rmxOAuth.ClockFunc(func() time.Time { return now })
+	provider.OpenIDConfig.PushedAuthorizationRequestEndpoint = ts.URL
+	provider.UsePushedAuthorizationRequests = true
+	provider.StateTTL = DefaultStateTTL
+
+	// the request_uri expires before StateTTL
+	session, err := provider.BeginAuth("test_state")
+	a.NoError(err)
+	a.Equal(now.Add(time.Minute), session.(*Session).StateExpiresAt)
+
+	now = now.Add(time.Minute + provider.ClockSkew + time.Second)
+	_, err = session.Authorize(provider, url.Values{"code": {"abc"}, "state": {"test_state"}})
+	a.EqualError(err, "authorization request has expired")
+}
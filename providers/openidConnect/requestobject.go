@@ -0,0 +1,176 @@
+package openidConnect
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/rapidmidiex/oauth/internal/jose"
+)
+
+// requestObjectTTL is how long a signed authorization request is valid for.
+const requestObjectTTL = 5 * time.Minute
+
+// ClaimsRequest is the claims authorization request parameter, asking for
+// individual claims to be returned from the UserInfo endpoint or in the ID
+// token. A nil *ClaimRequest requests the claim in the default manner.
+// See https://openid.net/specs/openid-connect-core-1_0.html#ClaimsParameter
+type ClaimsRequest struct {
+	UserInfo map[string]*ClaimRequest `json:"userinfo,omitempty"`
+	IDToken  map[string]*ClaimRequest `json:"id_token,omitempty"`
+}
+
+// ClaimRequest holds the options for a single claim of a ClaimsRequest.
+type ClaimRequest struct {
+	Essential bool          `json:"essential,omitempty"`
+	Value     interface{}   `json:"value,omitempty"`
+	Values    []interface{} `json:"values,omitempty"`
+}
+
+// SetRequestObjectKey loads the private key used to sign authorization
+// requests as JWTs from PEM data. Once set, BeginAuth sends the request
+// parameters in a request object, pushed to the provider when pushed
+// authorization requests are enabled. keyID is sent as the kid of the JWT and
+// may be empty.
+// See https://datatracker.ietf.org/doc/html/rfc9101
+func (p *Provider) SetRequestObjectKey(pemData []byte, keyID string) error {
+	key, err := jose.ParsePrivateKeyPEM(pemData)
+	if err != nil {
+		return err
+	}
+	p.requestObjectKey = key
+	p.requestObjectKeyID = keyID
+	return nil
+}
+
+// authorizationURL turns the plain authorization URL into the one the user is
+// sent to, moving its parameters into a request object and/or pushing them to
+// the provider first when configured. Pushed requests expire, and when they
+// do is returned as well; otherwise the time is zero.
+func (p *Provider) authorizationURL(ctx context.Context, authURL string) (string, time.Time, error) {
+	usePAR := p.usePushedAuthorizationRequests()
+	if !usePAR && p.requestObjectKey == nil {
+		return authURL, time.Time{}, nil
+	}
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	params := u.Query()
+
+	// The provider only uses the parameters of the request object or the
+	// pushed request. state is repeated so that rmxOAuth.ValidateState can
+	// still check it.
+	q := url.Values{"client_id": {p.ClientKey}}
+	if state := params.Get("state"); state != "" {
+		q.Set("state", state)
+	}
+
+	if p.requestObjectKey != nil {
+		request, err := p.requestObject(params)
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		if !usePAR {
+			// OpenID Connect requires these outside the request object too
+			q.Set("response_type", params.Get("response_type"))
+			q.Set("scope", params.Get("scope"))
+		}
+		params = url.Values{
+			"client_id": {p.ClientKey},
+			"request":   {request},
+		}
+	}
+
+	var expiresAt time.Time
+	if usePAR {
+		var requestURI string
+		requestURI, expiresAt, err = p.pushAuthorizationRequest(ctx, params)
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		q.Set("request_uri", requestURI)
+	} else {
+		q.Set("request", params.Get("request"))
+	}
+
+	u.RawQuery = q.Encode()
+	return u.String(), expiresAt, nil
+}
+
+// requestObject signs the authorization request parameters as a JWT and
+// encrypts it for the provider when EncryptRequestObjects is set.
+func (p *Provider) requestObject(params url.Values) (string, error) {
+	alg, err := jose.SigningAlgorithm(p.requestObjectKey)
+	if err != nil {
+		return "", err
+	}
+
+	jti, err := randomString(16)
+	if err != nil {
+		return "", err
+	}
+
+	claims := map[string]interface{}{}
+	for name := range params {
+		value := params.Get(name)
+		switch name {
+		case "claims":
+			claims[name] = json.RawMessage(value)
+		case "max_age":
+			if maxAge, err := strconv.ParseInt(value, 10, 64); err == nil {
+				claims[name] = maxAge
+				continue
+			}
+			claims[name] = value
+		default:
+			claims[name] = value
+		}
+	}
+
+	now := p.now()
+	claims["iss"] = p.ClientKey
+	claims["aud"] = p.OpenIDConfig.Issuer
+	claims["jti"] = jti
+	claims["iat"] = now.Unix()
+	claims["nbf"] = now.Unix()
+	claims["exp"] = now.Add(requestObjectTTL).Unix()
+
+	header := jose.Header{Alg: alg, Typ: "oauth-authz-req+jwt"}
+	if alg != "HS256" {
+		header.Kid = p.requestObjectKeyID
+	}
+	request, err := jose.Sign(header, claims, p.requestObjectKey)
+	if err != nil || !p.EncryptRequestObjects {
+		return request, err
+	}
+	return p.encryptRequestObject(request)
+}
+
+// encryptRequestObject encrypts a signed request object to the first of the
+// provider's keys usable with an algorithm both sides support.
+func (p *Provider) encryptRequestObject(request string) (string, error) {
+	enc := jose.A256GCM
+	if encs := p.OpenIDConfig.RequestObjectEncryptionEncValuesSupported; len(encs) > 0 && !contains(encs, enc) {
+		enc = jose.A128GCM
+	}
+
+	for _, alg := range []string{jose.RSAOAEP256, jose.RSAOAEP, jose.ECDHES} {
+		if algs := p.OpenIDConfig.RequestObjectEncryptionAlgValuesSupported; len(algs) > 0 && !contains(algs, alg) {
+			continue
+		}
+		for _, jwk := range p.encryptionKeys(alg) {
+			key, err := jwk.Key()
+			if err != nil {
+				continue
+			}
+			header := jose.Header{Alg: alg, Enc: enc, Cty: "JWT", Kid: jwk.Kid}
+			return jose.Encrypt(header, []byte(request), key)
+		}
+	}
+	return "", fmt.Errorf("openidConnect: no key found to encrypt the request object for %s", p.providerName)
+}
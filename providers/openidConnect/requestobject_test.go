@@ -0,0 +1,182 @@
+package openidConnect
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	rmxOAuth "github.com/rapidmidiex/oauth"
+	"github.com/rapidmidiex/oauth/internal/jose"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_BeginAuth_RequestObject(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	keyPEM := ecKeyPEM(t)
+	now := time.Unix(1700000000, 0)
+	provider := tokenProvider("https://idp.example.com/token")
+	provider.Clock = rmxOAuth.ClockFunc(func() time.Time { return now })
+	provider.ClaimsRequest = &ClaimsRequest{
+		IDToken: map[string]*ClaimRequest{
+			"email": {Essential: true},
+			"acr":   {Values: []interface{}{"urn:mace:incommon:iap:silver"}},
+		},
+		UserInfo: map[string]*ClaimRequest{"picture": nil},
+	}
+	a.NoError(provider.SetRequestObjectKey(keyPEM, "request-key"))
+
+	session, err := provider.BeginAuth("test_state")
+	a.NoError(err)
+
+	u, err := url.Parse(session.(*Session).AuthURL)
+	a.NoError(err)
+	q := u.Query()
+	a.Equal("client", q.Get("client_id"))
+	a.Equal("code", q.Get("response_type"))
+	a.Equal("openid", q.Get("scope"))
+	a.Equal("test_state", q.Get("state"))
+	a.Empty(q.Get("redirect_uri"))
+	a.Empty(q.Get("claims"))
+
+	jws, err := jose.Parse(q.Get("request"))
+	a.NoError(err)
+	a.Equal("ES256", jws.Header.Alg)
+	a.Equal("request-key", jws.Header.Kid)
+	a.Equal("oauth-authz-req+jwt", jws.Header.Typ)
+
+	key, _ := jose.ParsePrivateKeyPEM(keyPEM)
+	a.NoError(jws.Verify(&key.(*ecdsa.PrivateKey).PublicKey))
+
+	claims, err := jws.Claims()
+	a.NoError(err)
+	a.Equal("client", claims["iss"])
+	a.Equal("https://idp.example.com", claims["aud"])
+	a.Equal("http://localhost/foo", claims["redirect_uri"])
+	a.Equal("test_state", claims["state"])
+	a.Equal(float64(now.Add(requestObjectTTL).Unix()), claims["exp"])
+	a.NotEmpty(claims["jti"])
+	a.Equal(map[string]interface{}{
+		"id_token": map[string]interface{}{
+			"email": map[string]interface{}{"essential": true},
+			"acr":   map[string]interface{}{"values": []interface{}{"urn:mace:incommon:iap:silver"}},
+		},
+		"userinfo": map[string]interface{}{"picture": nil},
+	}, claims["claims"])
+}
+
+func Test_BeginAuth_ClaimsRequest(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	provider := tokenProvider("https://idp.example.com/token")
+	provider.ClaimsRequest = &ClaimsRequest{UserInfo: map[string]*ClaimRequest{"email": {Essential: true}}}
+
+	session, err := provider.BeginAuth("test_state")
+	a.NoError(err)
+
+	u, err := url.Parse(session.(*Session).AuthURL)
+	a.NoError(err)
+	a.JSONEq(`{"userinfo":{"email":{"essential":true}}}`, u.Query().Get("claims"))
+}
+
+func Test_BeginAuth_PushedRequestObject(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	var pushed url.Values
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		pushed = r.PostForm
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"request_uri":"urn:ietf:params:oauth:request_uri:abc","expires_in":60}`))
+	}))
+	defer ts.Close()
+
+	provider := tokenProvider("https://idp.example.com/token")
+	provider.OpenIDConfig.PushedAuthorizationRequestEndpoint = ts.URL
+	provider.UsePushedAuthorizationRequests = true
+	a.NoError(provider.SetRequestObjectKey(ecKeyPEM(t), ""))
+
+	session, err := provider.BeginAuth("test_state")
+	a.NoError(err)
+
+	a.Equal("client", pushed.Get("client_id"))
+	a.NotEmpty(pushed.Get("request"))
+	a.Empty(pushed.Get("redirect_uri"))
+
+	u, err := url.Parse(session.(*Session).AuthURL)
+	a.NoError(err)
+	a.Equal(url.Values{
+		"client_id":   {"client"},
+		"request_uri": {"urn:ietf:params:oauth:request_uri:abc"},
+		"state":       {"test_state"},
+	}, u.Query())
+}
+
+func Test_BeginAuth_EncryptedRequestObject(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	encKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	jwk, _ := jose.NewJWK(&encKey.PublicKey, "enc-key")
+	jwk.Use = "enc"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jose.JWKS{Keys: []jose.JWK{*jwk}})
+	}))
+	defer ts.Close()
+
+	provider := tokenProvider("https://idp.example.com/token")
+	provider.OpenIDConfig.JWKSURI = ts.URL
+	provider.OpenIDConfig.RequestObjectEncryptionAlgValuesSupported = []string{"RSA-OAEP"}
+	provider.EncryptRequestObjects = true
+	der := x509.MarshalPKCS1PrivateKey(signingKey)
+	a.NoError(provider.SetRequestObjectKey(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: der}), "test-key"))
+
+	session, err := provider.BeginAuth("test_state")
+	a.NoError(err)
+
+	u, err := url.Parse(session.(*Session).AuthURL)
+	a.NoError(err)
+	request := u.Query().Get("request")
+	a.True(jose.IsJWE(request))
+
+	header, plaintext, err := jose.Decrypt(request, encKey)
+	a.NoError(err)
+	a.Equal("RSA-OAEP", header.Alg)
+	a.Equal("A256GCM", header.Enc)
+	a.Equal("enc-key", header.Kid)
+	a.Equal("JWT", header.Cty)
+
+	jws, err := jose.Parse(string(plaintext))
+	a.NoError(err)
+	a.NoError(jws.Verify(&signingKey.PublicKey))
+}
+
+func Test_BeginAuth_EncryptedRequestObjectWithoutKey(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"keys":[]}`))
+	}))
+	defer ts.Close()
+
+	provider := tokenProvider("https://idp.example.com/token")
+	provider.OpenIDConfig.JWKSURI = ts.URL
+	provider.EncryptRequestObjects = true
+	a.NoError(provider.SetRequestObjectKey(ecKeyPEM(t), ""))
+
+	_, err := provider.BeginAuth("test_state")
+	a.Error(err)
+}
@@ -0,0 +1,93 @@
+package openidConnect
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	rmxOAuth "github.com/rapidmidiex/oauth"
+)
+
+// Response modes for the authorization response. With the form_post modes
+// rmxOAuth.SetSession stores the session in a cookie that is sent on the
+// cross-site POST of the callback as well, see rmxOAuth.FormPostSession, and
+// the callback parameters are read with rmxOAuth.CallbackParams.
+// See https://openid.net/specs/oauth-v2-form-post-response-mode-1_0.html and
+// https://openid.net/specs/oauth-v2-jarm.html
+const (
+	ResponseModeQuery       = "query"
+	ResponseModeFormPost    = "form_post"
+	ResponseModeJWT         = "jwt"
+	ResponseModeQueryJWT    = "query.jwt"
+	ResponseModeFormPostJWT = "form_post.jwt"
+)
+
+// jwtResponseMode reports whether the authorization response is a JWT (JARM).
+func (p *Provider) jwtResponseMode() bool {
+	return strings.HasSuffix(p.ResponseMode, ResponseModeJWT)
+}
+
+// authorizationResponse returns the parameters of the authorization response
+// received in params. A JWT secured response is verified and its claims
+// returned in place of params. An error response is returned as an
+// *rmxOAuth.Error.
+func (p *Provider) authorizationResponse(s *Session, params rmxOAuth.Params) (rmxOAuth.Params, error) {
+	response := params.Get("response")
+	if response == "" {
+		if p.jwtResponseMode() {
+			return nil, errors.New("openidConnect: authorization response is not JWT secured")
+		}
+		return params, authorizationError(params)
+	}
+
+	_, claims, err := p.verifyJWT(response, p.OpenIDConfig.AuthorizationSigningAlgValuesSupported)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.validateIssuerAndAudience(claims); err != nil {
+		return nil, err
+	}
+	exp, ok := claims[expiryClaim].(float64)
+	if !ok {
+		return nil, errors.New("openidConnect: authorization response does not contain an expiry")
+	}
+	if time.Unix(int64(exp), 0).Add(p.ClockSkew).Before(p.now()) {
+		return nil, errors.New("openidConnect: authorization response is expired")
+	}
+
+	values := url.Values{}
+	for name, value := range claims {
+		if v, ok := value.(string); ok {
+			values.Set(name, v)
+		}
+	}
+
+	// the state sent outside the JWT was not verified, check the one inside
+	if authURL, err := url.Parse(s.AuthURL); err == nil {
+		if state := authURL.Query().Get("state"); state != "" && state != values.Get("state") {
+			return nil, errors.New("state token mismatch")
+		}
+	}
+
+	// parameters added by the application, not the provider
+	for _, name := range []string{"redirect_uri", "code_verifier"} {
+		if v := params.Get(name); v != "" {
+			values.Set(name, v)
+		}
+	}
+	return values, authorizationError(values)
+}
+
+// authorizationError returns the error of an authorization error response.
+func authorizationError(params rmxOAuth.Params) error {
+	code := params.Get("error")
+	if code == "" {
+		return nil
+	}
+	return &rmxOAuth.Error{
+		Code:        code,
+		Description: params.Get("error_description"),
+		URI:         params.Get("error_uri"),
+	}
+}
@@ -0,0 +1,107 @@
+package openidConnect
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	rmxOAuth "github.com/rapidmidiex/oauth"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_BeginAuth_ResponseMode(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	provider := tokenProvider("https://idp.example.com/token")
+	provider.ResponseMode = ResponseModeFormPost
+
+	session, err := provider.BeginAuth("test_state")
+	a.NoError(err)
+
+	u, err := url.Parse(session.(*Session).AuthURL)
+	a.NoError(err)
+	a.Equal("form_post", u.Query().Get("response_mode"))
+
+	s := session.(*Session)
+	a.True(s.AwaitsFormPost())
+	s.AccessToken = "at"
+	a.False(s.AwaitsFormPost())
+}
+
+func Test_Authorize_JWTResponse(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	var code string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		code = r.PostForm.Get("code")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"at","token_type":"Bearer","expires_in":3600}`))
+	}))
+	defer ts.Close()
+
+	provider, now := jwksProvider(t)
+	provider.OpenIDConfig.TokenEndpoint = ts.URL
+	provider.ResponseMode = ResponseModeFormPostJWT
+
+	session, err := provider.BeginAuth("test_state")
+	a.NoError(err)
+	s := session.(*Session)
+
+	response := func(mutate func(map[string]interface{})) url.Values {
+		claims := map[string]interface{}{
+			"iss":   "https://idp.example.com",
+			"aud":   "client",
+			"exp":   float64(now.Add(time.Minute).Unix()),
+			"code":  "abc",
+			"state": "test_state",
+		}
+		mutate(claims)
+		return url.Values{"response": {signJWT(t, claims)}}
+	}
+
+	accessToken, err := s.Authorize(provider, response(func(map[string]interface{}) {}))
+	a.NoError(err)
+	a.Equal("at", accessToken)
+	a.Equal("abc", code)
+
+	_, err = s.Authorize(provider, url.Values{"code": {"abc"}, "state": {"test_state"}})
+	a.EqualError(err, "openidConnect: authorization response is not JWT secured")
+
+	_, err = s.Authorize(provider, response(func(c map[string]interface{}) { c["state"] = "other" }))
+	a.EqualError(err, "state token mismatch")
+
+	_, err = s.Authorize(provider, response(func(c map[string]interface{}) { c["aud"] = "someone-else" }))
+	a.Error(err)
+
+	_, err = s.Authorize(provider, response(func(c map[string]interface{}) { c["exp"] = float64(now.Add(-time.Hour).Unix()) }))
+	a.EqualError(err, "openidConnect: authorization response is expired")
+
+	_, err = s.Authorize(provider, response(func(c map[string]interface{}) {
+		delete(c, "code")
+		c["error"] = "access_denied"
+		c["error_description"] = "user declined"
+	}))
+	a.Equal(&rmxOAuth.Error{Code: "access_denied", Description: "user declined"}, err)
+
+	forged := response(func(map[string]interface{}) {})
+	forged.Set("response", forged.Get("response")[:len(forged.Get("response"))-4]+"AAAA")
+	_, err = s.Authorize(provider, forged)
+	a.Error(err)
+}
+
+func Test_Authorize_ErrorResponse(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	provider := tokenProvider("https://idp.example.com/token")
+	session, err := provider.BeginAuth("test_state")
+	a.NoError(err)
+
+	_, err = session.Authorize(provider, url.Values{"error": {"access_denied"}, "state": {"test_state"}})
+	a.Equal(&rmxOAuth.Error{Code: "access_denied"}, err)
+}
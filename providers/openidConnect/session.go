@@ -1,8 +1,10 @@
 package openidConnect
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"net/url"
 	"strings"
 	"time"
 
@@ -17,6 +19,25 @@ type Session struct {
 	RefreshToken string
 	ExpiresAt    time.Time
 	IDToken      string
+	// SessionID is the "sid" claim of the ID token, identifying the user's
+	// session at the OpenID provider.
+	SessionID string
+
+	// StateExpiresAt is when the authorization request started by BeginAuth
+	// stops being accepted. It is zero when the provider has no StateTTL.
+	StateExpiresAt time.Time
+
+	// DPoPKeyID identifies the key in the provider's DPoPKeys that the
+	// session's tokens are bound to when the provider has UseDPoP set.
+	DPoPKeyID string
+
+	// ResponseMode is the response_mode of the authorization request.
+	ResponseMode string
+}
+
+// AwaitsFormPost implements rmxOAuth.FormPostSession.
+func (s Session) AwaitsFormPost() bool {
+	return strings.HasPrefix(s.ResponseMode, ResponseModeFormPost) && s.AccessToken == ""
 }
 
 // GetAuthURL will return the URL set by calling the `BeginAuth` function on the OpenID Connect provider.
@@ -31,34 +52,63 @@ func (s Session) GetAuthURL() (string, error) {
 func (s *Session) Authorize(provider rmxOAuth.Provider, params rmxOAuth.Params) (string, error) {
 	p := provider.(*Provider)
 
-	var authParams []oauth2.AuthCodeOption
+	if !s.StateExpiresAt.IsZero() && p.now().After(s.StateExpiresAt.Add(p.ClockSkew)) {
+		return "", errors.New("authorization request has expired")
+	}
+
+	params, err := p.authorizationResponse(s, params)
+	if err != nil {
+		return "", err
+	}
+
+	values := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {params.Get("code")},
+		"redirect_uri": {p.CallbackURL},
+	}
 
 	// override redirect_uri if passed as param
 	redirectURL := params.Get("redirect_uri")
 	if redirectURL != "" {
-		authParams = append(authParams, oauth2.SetAuthURLParam("redirect_uri", redirectURL))
+		values.Set("redirect_uri", redirectURL)
 	}
 
 	// set code_verifier if passed as param
 	codeVerifier := params.Get("code_verifier")
 	if codeVerifier != "" {
-		authParams = append(authParams, oauth2.SetAuthURLParam("code_verifier", codeVerifier))
+		values.Set("code_verifier", codeVerifier)
 	}
 
-	token, err := p.config.Exchange(rmxOAuth.ContextForClient(p.Client()), params.Get("code"), authParams...)
+	token, err := p.requestSessionToken(context.Background(), s, values)
 	if err != nil {
 		return "", err
 	}
 
-	if !token.Valid() {
-		return "", errors.New("Invalid token received from provider")
+	if err := s.setToken(token); err != nil {
+		return "", err
+	}
+	return token.AccessToken, err
+}
+
+// setToken stores the tokens of a token response in the session. Expiry is
+// not checked here as it was computed from the provider's Clock.
+func (s *Session) setToken(token *oauth2.Token) error {
+	if token.AccessToken == "" {
+		return errors.New("Invalid token received from provider")
 	}
 
 	s.AccessToken = token.AccessToken
 	s.RefreshToken = token.RefreshToken
 	s.ExpiresAt = token.Expiry
-	s.IDToken = token.Extra("id_token").(string)
-	return token.AccessToken, err
+	s.IDToken, _ = token.Extra("id_token").(string)
+	if s.IDToken != "" {
+		claims, err := decodeJWT(s.IDToken)
+		if err != nil {
+			return err
+		}
+		s.SessionID = getClaimValue(claims, []string{sessionIDClaim})
+	}
+	return nil
 }
 
 // Marshal the session into a string
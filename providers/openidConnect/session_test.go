@@ -1,7 +1,9 @@
 package openidConnect
 
 import (
+	"net/url"
 	"testing"
+	"time"
 
 	rmxOAuth "github.com/rapidmidiex/oauth"
 	"github.com/stretchr/testify/assert"
@@ -35,5 +37,23 @@ func Test_ToJSON(t *testing.T) {
 	s := &Session{}
 
 	data, _ := s.Marshal()
-	a.Equal(data, `{"AuthURL":"","AccessToken":"","RefreshToken":"","ExpiresAt":"0001-01-01T00:00:00Z","IDToken":""}`)
+	a.Equal(data, `{"AuthURL":"","AccessToken":"","RefreshToken":"","ExpiresAt":"0001-01-01T00:00:00Z","IDToken":"","SessionID":"","StateExpiresAt":"0001-01-01T00:00:00Z","DPoPKeyID":"","ResponseMode":""}`)
+}
+
+func Test_Authorize_StateExpired(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	now := time.Unix(1700000000, 0)
+	provider := openidConnectProvider()
+	provider.Clock = rmxOAuth.ClockFunc(func() time.Time { return now })
+
+	session, err := provider.BeginAuth("test_state")
+	a.NoError(err)
+	s := session.(*Session)
+	a.Equal(now.Add(DefaultStateTTL), s.StateExpiresAt)
+
+	now = now.Add(DefaultStateTTL + provider.ClockSkew + time.Second)
+	_, err = s.Authorize(provider, url.Values{"code": {"abc"}})
+	a.EqualError(err, "authorization request has expired")
 }
@@ -0,0 +1,102 @@
+package openidConnect
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	rmxOAuth "github.com/rapidmidiex/oauth"
+)
+
+// Token type identifiers for token exchange.
+// See https://datatracker.ietf.org/doc/html/rfc8693#section-3
+const (
+	TokenTypeAccessToken  = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeRefreshToken = "urn:ietf:params:oauth:token-type:refresh_token"
+	TokenTypeIDToken      = "urn:ietf:params:oauth:token-type:id_token"
+	TokenTypeJWT          = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+const tokenExchangeGrantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+// TokenExchangeRequest holds the parameters of a token exchange request.
+// SubjectToken and SubjectTokenType are required, ActorTokenType is required
+// when ActorToken is set.
+type TokenExchangeRequest struct {
+	SubjectToken       string
+	SubjectTokenType   string
+	ActorToken         string
+	ActorTokenType     string
+	RequestedTokenType string
+	Audience           []string
+	Resource           []string
+	Scopes             []string
+}
+
+// TokenExchangeResponse is the successful response to a token exchange.
+type TokenExchangeResponse struct {
+	AccessToken     string `json:"access_token"`
+	IssuedTokenType string `json:"issued_token_type"`
+	TokenType       string `json:"token_type"`
+	ExpiresIn       int64  `json:"expires_in,omitempty"`
+	Scope           string `json:"scope,omitempty"`
+	RefreshToken    string `json:"refresh_token,omitempty"`
+
+	// ExpiresAt is computed from ExpiresIn when the response is received.
+	ExpiresAt time.Time `json:"-"`
+}
+
+// ExchangeToken trades a token for another one at the provider's token
+// endpoint, for example a user's access token for a downscoped token for a
+// backend service. Error responses are returned as *rmxOAuth.Error.
+// See https://datatracker.ietf.org/doc/html/rfc8693
+func (p *Provider) ExchangeToken(ctx context.Context, req *TokenExchangeRequest) (*TokenExchangeResponse, error) {
+	if req.SubjectToken == "" || req.SubjectTokenType == "" {
+		return nil, &rmxOAuth.Error{Code: rmxOAuth.ErrorCodeInvalidRequest, Description: "subject_token and subject_token_type are required"}
+	}
+	if req.ActorToken != "" && req.ActorTokenType == "" {
+		return nil, &rmxOAuth.Error{Code: rmxOAuth.ErrorCodeInvalidRequest, Description: "actor_token_type is required with actor_token"}
+	}
+
+	values := url.Values{
+		"grant_type":         {tokenExchangeGrantType},
+		"subject_token":      {req.SubjectToken},
+		"subject_token_type": {req.SubjectTokenType},
+	}
+	if req.ActorToken != "" {
+		values.Set("actor_token", req.ActorToken)
+		values.Set("actor_token_type", req.ActorTokenType)
+	}
+	if req.RequestedTokenType != "" {
+		values.Set("requested_token_type", req.RequestedTokenType)
+	}
+	if len(req.Audience) > 0 {
+		values["audience"] = req.Audience
+	}
+	if len(req.Resource) > 0 {
+		values["resource"] = req.Resource
+	}
+	if len(req.Scopes) > 0 {
+		values.Set("scope", strings.Join(req.Scopes, " "))
+	}
+
+	body, err := p.postForm(ctx, p.OpenIDConfig.TokenEndpoint, values)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &TokenExchangeResponse{}
+	if err := json.Unmarshal(body, resp); err != nil {
+		return nil, err
+	}
+	if resp.AccessToken == "" || resp.IssuedTokenType == "" {
+		return nil, errors.New("oauth2: token exchange response missing access_token or issued_token_type")
+	}
+	if resp.ExpiresIn > 0 {
+		resp.ExpiresAt = p.now().Add(time.Duration(resp.ExpiresIn) * time.Second)
+	}
+	return resp, nil
+}
@@ -0,0 +1,54 @@
+package openidConnect
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	rmxOAuth "github.com/rapidmidiex/oauth"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ExchangeToken(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		a.Equal(tokenExchangeGrantType, r.PostForm.Get("grant_type"))
+		a.Equal(TokenTypeAccessToken, r.PostForm.Get("subject_token_type"))
+		a.Equal([]string{"https://audio.example", "https://mix.example"}, r.PostForm["audience"])
+		a.Equal("render", r.PostForm.Get("scope"))
+
+		if r.PostForm.Get("subject_token") == "revoked" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"invalid_grant","error_description":"subject token is not active"}`)
+			return
+		}
+		fmt.Fprint(w, `{"access_token":"downscoped","issued_token_type":"urn:ietf:params:oauth:token-type:access_token","token_type":"Bearer","expires_in":60}`)
+	}))
+	defer ts.Close()
+
+	provider := tokenProvider(ts.URL)
+	req := &TokenExchangeRequest{
+		SubjectToken:     "user-token",
+		SubjectTokenType: TokenTypeAccessToken,
+		Audience:         []string{"https://audio.example", "https://mix.example"},
+		Scopes:           []string{"render"},
+	}
+
+	resp, err := provider.ExchangeToken(context.Background(), req)
+	a.NoError(err)
+	a.Equal("downscoped", resp.AccessToken)
+	a.Equal(TokenTypeAccessToken, resp.IssuedTokenType)
+	a.False(resp.ExpiresAt.IsZero())
+
+	req.SubjectToken = "revoked"
+	_, err = provider.ExchangeToken(context.Background(), req)
+	a.Equal(&rmxOAuth.Error{StatusCode: http.StatusBadRequest, Code: rmxOAuth.ErrorCodeInvalidGrant, Description: "subject token is not active"}, err)
+
+	_, err = provider.ExchangeToken(context.Background(), &TokenExchangeRequest{SubjectToken: "user-token"})
+	a.Equal(rmxOAuth.ErrorCodeInvalidRequest, err.(*rmxOAuth.Error).Code)
+}
@@ -101,7 +101,7 @@ func (p *Provider) FetchUser(session rmxOAuth.Session) (rmxOAuth.User, error) {
 	defer response.Body.Close()
 
 	if response.StatusCode != http.StatusOK {
-		return user, fmt.Errorf("%s responded with a %d trying to fetch user information", p.providerName, response.StatusCode)
+		return user, &rmxOAuth.StatusError{StatusCode: response.StatusCode, Message: fmt.Sprintf("%s responded with a %d trying to fetch user information", p.providerName, response.StatusCode)}
 	}
 
 	bits, err := ioutil.ReadAll(response.Body)
@@ -118,7 +118,7 @@ func (p *Provider) FetchUser(session rmxOAuth.Session) (rmxOAuth.User, error) {
 
 	if p.hasScope(ScopeUserRead) {
 		// Get user profile info
-		req, _ := http.NewRequest("GET", endpointProfile+"?user="+user.UserID, nil)
+		req, _ := http.NewRequest("GET", endpointProfile+"?include_locale=true&user="+user.UserID, nil)
 		req.Header.Add("Authorization", "Bearer "+sess.AccessToken)
 		response, err = p.Client().Do(req)
 		if err != nil {
@@ -127,7 +127,7 @@ func (p *Provider) FetchUser(session rmxOAuth.Session) (rmxOAuth.User, error) {
 		defer response.Body.Close()
 
 		if response.StatusCode != http.StatusOK {
-			return user, fmt.Errorf("%s responded with a %d trying to fetch user information", p.providerName, response.StatusCode)
+			return user, &rmxOAuth.StatusError{StatusCode: response.StatusCode, Message: fmt.Sprintf("%s responded with a %d trying to fetch user information", p.providerName, response.StatusCode)}
 		}
 
 		bits, err = ioutil.ReadAll(response.Body)
@@ -185,6 +185,7 @@ func simpleUserFromReader(r io.Reader, user *rmxOAuth.User) error {
 	u := struct {
 		UserID string `json:"user_id"`
 		Name   string `json:"user"`
+		URL    string `json:"url"`
 	}{}
 
 	err := json.NewDecoder(r).Decode(&u)
@@ -194,6 +195,10 @@ func simpleUserFromReader(r io.Reader, user *rmxOAuth.User) error {
 
 	user.UserID = u.UserID
 	user.NickName = u.Name
+	user.Username = u.Name
+	if u.URL != "" {
+		user.ProfileURL = u.URL + "team/" + u.UserID
+	}
 
 	return nil
 }
@@ -201,9 +206,11 @@ func simpleUserFromReader(r io.Reader, user *rmxOAuth.User) error {
 func userFromReader(r io.Reader, user *rmxOAuth.User) error {
 	u := struct {
 		User struct {
-			NickName string `json:"name"`
-			ID       string `json:"id"`
-			Profile  struct {
+			NickName         string `json:"name"`
+			ID               string `json:"id"`
+			Locale           string `json:"locale"`
+			IsEmailConfirmed bool   `json:"is_email_confirmed"`
+			Profile          struct {
 				Email     string `json:"email"`
 				Name      string `json:"real_name"`
 				AvatarURL string `json:"image_32"`
@@ -217,8 +224,11 @@ func userFromReader(r io.Reader, user *rmxOAuth.User) error {
 		return err
 	}
 	user.Email = u.User.Profile.Email
+	user.EmailVerified = u.User.Profile.Email != "" && u.User.IsEmailConfirmed
 	user.Name = u.User.Profile.Name
 	user.NickName = u.User.NickName
+	user.Username = u.User.NickName
+	user.Locale = u.User.Locale
 	user.UserID = u.User.ID
 	user.AvatarURL = u.User.Profile.AvatarURL
 	user.FirstName = u.User.Profile.FirstName
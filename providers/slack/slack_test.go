@@ -23,8 +23,9 @@ var (
 
 	testUserInfoResponseData = map[string]interface{}{
 		"user": map[string]interface{}{
-			"id":   testAuthTestResponseData["user_id"],
-			"name": testAuthTestResponseData["user"],
+			"id":                 testAuthTestResponseData["user_id"],
+			"name":               testAuthTestResponseData["user"],
+			"is_email_confirmed": true,
 			"profile": map[string]interface{}{
 				"real_name":  "Test User",
 				"first_name": "Test",
@@ -92,14 +93,15 @@ func Test_FetchUser(t *testing.T) {
 				},
 			),
 			expectedUser: rmxOAuth.User{
-				UserID:      "user1234",
-				NickName:    "testuser",
-				Name:        "Test User",
-				FirstName:   "Test",
-				LastName:    "User",
-				AvatarURL:   "http://example.org/avatar.png",
-				Email:       "test@example.org",
-				AccessToken: "TOKEN",
+				UserID:        "user1234",
+				NickName:      "testuser",
+				Name:          "Test User",
+				FirstName:     "Test",
+				LastName:      "User",
+				AvatarURL:     "http://example.org/avatar.png",
+				Email:         "test@example.org",
+				EmailVerified: true,
+				AccessToken:   "TOKEN",
 			},
 			expectErr: false,
 		},
@@ -192,6 +194,7 @@ func Test_FetchUser(t *testing.T) {
 				a.Equal(testData.expectedUser.LastName, user.LastName)
 				a.Equal(testData.expectedUser.AvatarURL, user.AvatarURL)
 				a.Equal(testData.expectedUser.Email, user.Email)
+				a.Equal(testData.expectedUser.EmailVerified, user.EmailVerified)
 				a.Equal(testData.expectedUser.AccessToken, user.AccessToken)
 			})
 		})
@@ -0,0 +1,437 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+var (
+	// ErrRefreshTokenNotFound is returned by RefreshFamilyStore.Rotate for
+	// unknown refresh tokens.
+	ErrRefreshTokenNotFound = errors.New("oauth: refresh token not found")
+	// ErrRefreshTokenReused is returned by RefreshFamilyStore.Rotate for
+	// refresh tokens that were rotated already, or whose family is revoked.
+	ErrRefreshTokenReused = errors.New("oauth: refresh token reused")
+)
+
+// RefreshFamily is the chain of refresh tokens descending from one login. Each
+// refresh replaces the current token of the family by a new one. Presenting a
+// token that was replaced already means it leaked, so the whole family is
+// revoked and the user has to log in again.
+type RefreshFamily struct {
+	ID string
+	// Claims about the user, copied into the access tokens of an Issuer.
+	Claims AccessClaims
+	// Provider and ProviderRefreshToken are the refresh token a
+	// ProviderRefresher stands in for.
+	Provider             string
+	ProviderRefreshToken string
+	ExpiresAt            time.Time
+	Revoked              bool
+}
+
+// RefreshFamilyStore keeps refresh token families, and which family each
+// refresh token, current or rotated, belongs to. Tokens are identified by a
+// hash, so the store holds no usable refresh tokens.
+type RefreshFamilyStore interface {
+	// Create stores a new family whose current token is tokenID.
+	Create(ctx context.Context, tokenID string, family RefreshFamily) error
+	// Rotate replaces tokenID, the current token of its family, by nextID
+	// and returns the family. It returns ErrRefreshTokenNotFound for unknown
+	// tokens and ErrRefreshTokenReused, after revoking the family, for
+	// tokens that are not current. Of concurrent calls for the same token
+	// only one may succeed.
+	Rotate(ctx context.Context, tokenID, nextID string) (RefreshFamily, error)
+	// Unrotate undoes the Rotate of tokenID to nextID, making tokenID the
+	// current token again, unless nextID was rotated in the meantime.
+	Unrotate(ctx context.Context, tokenID, nextID string) error
+	// SetProviderRefreshToken replaces the provider refresh token of a
+	// family after the provider rotated it.
+	SetProviderRefreshToken(ctx context.Context, familyID, refreshToken string) error
+	// Revoke revokes the family, such as when the user logs out.
+	Revoke(ctx context.Context, familyID string) error
+}
+
+// hashToken is the key of a refresh token or ticket in its store.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newRefreshFamily starts a family, returning its first refresh token. The
+// family ID defaults to a random one.
+func newRefreshFamily(ctx context.Context, store RefreshFamilyStore, family RefreshFamily) (string, error) {
+	if family.ID == "" {
+		var err error
+		if family.ID, err = randomString(16); err != nil {
+			return "", err
+		}
+	}
+	refreshToken, err := randomString(32)
+	if err != nil {
+		return "", err
+	}
+	return refreshToken, store.Create(ctx, hashToken(refreshToken), family)
+}
+
+// rotateRefreshToken replaces a refresh token by a new one, returning the new
+// token and its family. Failures are invalid_grant *Errors.
+func rotateRefreshToken(ctx context.Context, store RefreshFamilyStore, now time.Time, refreshToken string) (string, RefreshFamily, error) {
+	next, err := randomString(32)
+	if err != nil {
+		return "", RefreshFamily{}, err
+	}
+
+	family, err := store.Rotate(ctx, hashToken(refreshToken), hashToken(next))
+	switch {
+	case err == ErrRefreshTokenNotFound:
+		return "", family, &Error{StatusCode: http.StatusBadRequest, Code: ErrorCodeInvalidGrant, Description: "invalid refresh token"}
+	case err == ErrRefreshTokenReused:
+		family.Revoked = true
+		return "", family, &Error{StatusCode: http.StatusBadRequest, Code: ErrorCodeInvalidGrant, Description: "refresh token reused"}
+	case err != nil:
+		return "", family, err
+	case !now.Before(family.ExpiresAt):
+		return "", family, &Error{StatusCode: http.StatusBadRequest, Code: ErrorCodeInvalidGrant, Description: "refresh token expired"}
+	}
+	return next, family, nil
+}
+
+// refreshResults shares the outcome of refreshing a refresh token with the
+// requests presenting the same token while the refresh is in flight, and
+// during a grace period afterwards.
+type refreshResults struct {
+	mu      sync.Mutex
+	results map[string]*refreshResult
+	sweptAt time.Time
+}
+
+// refreshResult is the outcome of refreshing a refresh token of a family. Its
+// expiresAt is zero while the refresh is in flight.
+type refreshResult struct {
+	done      chan struct{}
+	familyID  string
+	token     *oauth2.Token
+	err       error
+	expiresAt time.Time
+}
+
+// do refreshes refreshToken with refresh, unless it was refreshed less than
+// grace ago or is being refreshed, in which case that outcome is returned.
+// Without a grace period every call refreshes. Results of a family found
+// revoked are forgotten.
+func (g *refreshResults) do(ctx context.Context, refreshToken string, now time.Time, grace time.Duration, refresh func() (*oauth2.Token, RefreshFamily, error)) (*oauth2.Token, error) {
+	if grace <= 0 {
+		token, _, err := refresh()
+		return token, err
+	}
+
+	key := hashToken(refreshToken)
+	g.mu.Lock()
+	result, ok := g.results[key]
+	if ok && !result.expiresAt.IsZero() && !now.Before(result.expiresAt) {
+		delete(g.results, key)
+		ok = false
+	}
+	if !ok {
+		result = &refreshResult{done: make(chan struct{})}
+		g.start(key, result, now, grace)
+	}
+	g.mu.Unlock()
+
+	if !ok {
+		var family RefreshFamily
+		result.token, family, result.err = refresh()
+
+		g.mu.Lock()
+		result.familyID = family.ID
+		if result.err != nil {
+			delete(g.results, key)
+			if family.Revoked {
+				g.forgetLocked(family.ID)
+			}
+		} else {
+			result.expiresAt = now.Add(grace)
+		}
+		g.mu.Unlock()
+		close(result.done)
+	}
+
+	select {
+	case <-result.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if result.err != nil {
+		return nil, result.err
+	}
+	token := *result.token
+	return &token, nil
+}
+
+// start records the refresh of key in flight. Results past their grace period
+// are dropped at most once per grace period.
+func (g *refreshResults) start(key string, result *refreshResult, now time.Time, grace time.Duration) {
+	if g.results == nil {
+		g.results = map[string]*refreshResult{}
+	}
+	if now.Sub(g.sweptAt) >= grace {
+		for k, r := range g.results {
+			if !r.expiresAt.IsZero() && !now.Before(r.expiresAt) {
+				delete(g.results, k)
+			}
+		}
+		g.sweptAt = now
+	}
+	g.results[key] = result
+}
+
+// forget drops the results of a family, so that its refresh tokens are not
+// served from the grace period once it is revoked.
+func (g *refreshResults) forget(familyID string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.forgetLocked(familyID)
+}
+
+func (g *refreshResults) forgetLocked(familyID string) {
+	for k, r := range g.results {
+		if r.familyID == familyID && !r.expiresAt.IsZero() {
+			delete(g.results, k)
+		}
+	}
+}
+
+// ProviderRefresher gives rotating refresh tokens the semantics of an
+// Issuer's to providers, whether or not they rotate refresh tokens themselves.
+// Clients get a refresh token standing in for the provider's, which stays on
+// the server, and is replaced on each use; reusing a replaced one revokes the
+// family.
+//
+//	refreshToken, err := refresher.Wrap(r.Context(), user)
+//	...
+//	token, err := refresher.Refresh(r.Context(), provider, refreshToken)
+type ProviderRefresher struct {
+	Store RefreshFamilyStore
+	// TTL is the lifetime of a family, after which the user logs in again.
+	TTL time.Duration
+	// GracePeriod is the Issuer's RefreshGracePeriod for wrapped tokens:
+	// presenting a wrapped token again this soon after its refresh returns
+	// the same tokens, without asking the provider again.
+	GracePeriod time.Duration
+	Clock       Clock
+
+	refreshes refreshResults
+}
+
+// NewProviderRefresher creates a ProviderRefresher keeping its families in
+// memory for DefaultRefreshTokenTTL, with a DefaultRefreshGracePeriod.
+func NewProviderRefresher() *ProviderRefresher {
+	return &ProviderRefresher{
+		Store:       NewMemoryRefreshFamilyStore(),
+		TTL:         DefaultRefreshTokenTTL,
+		GracePeriod: DefaultRefreshGracePeriod,
+	}
+}
+
+// Wrap returns a refresh token standing in for the refresh token of the user
+// at their provider.
+func (r *ProviderRefresher) Wrap(ctx context.Context, user User) (string, error) {
+	if user.RefreshToken == "" {
+		return "", errors.New("oauth: the user has no refresh token")
+	}
+	return newRefreshFamily(ctx, r.Store, RefreshFamily{
+		Provider:             user.Provider,
+		ProviderRefreshToken: user.RefreshToken,
+		ExpiresAt:            ClockWithFallBack(r.Clock).Now().Add(r.TTL),
+	})
+}
+
+// Refresh gets a new access token from the provider with the refresh token the
+// wrapped one stands in for. The returned token's RefreshToken replaces the
+// wrapped one, which can not be used again after GracePeriod. When the
+// provider fails, the wrapped one stays current so that the client can retry.
+// Of the provider's response only the access token, its type and expiry, and
+// the id_token and scope extras are returned.
+func (r *ProviderRefresher) Refresh(ctx context.Context, provider Provider, refreshToken string) (*oauth2.Token, error) {
+	now := ClockWithFallBack(r.Clock).Now()
+	return r.refreshes.do(ctx, refreshToken, now, r.GracePeriod, func() (*oauth2.Token, RefreshFamily, error) {
+		next, family, err := rotateRefreshToken(ctx, r.Store, now, refreshToken)
+		if err != nil {
+			return nil, family, err
+		}
+
+		token, err := r.refresh(ctx, provider, family)
+		if err != nil {
+			if undoErr := r.Store.Unrotate(ctx, hashToken(refreshToken), hashToken(next)); undoErr != nil {
+				return nil, family, undoErr
+			}
+			return nil, family, err
+		}
+		return wrappedToken(token, next), family, nil
+	})
+}
+
+// wrappedToken returns the provider's token with refreshToken in place of the
+// provider's refresh token, which must not reach the client, not even through
+// the raw response.
+func wrappedToken(token *oauth2.Token, refreshToken string) *oauth2.Token {
+	wrapped := &oauth2.Token{
+		AccessToken:  token.AccessToken,
+		TokenType:    token.TokenType,
+		RefreshToken: refreshToken,
+		Expiry:       token.Expiry,
+	}
+	extra := map[string]interface{}{}
+	for _, name := range []string{"id_token", "scope"} {
+		if value := token.Extra(name); value != nil {
+			extra[name] = value
+		}
+	}
+	return wrapped.WithExtra(extra)
+}
+
+// refresh refreshes the provider refresh token of family, and stores the
+// provider's new one if it rotated it.
+func (r *ProviderRefresher) refresh(ctx context.Context, provider Provider, family RefreshFamily) (*oauth2.Token, error) {
+	if family.Provider != provider.Name() {
+		return nil, &Error{StatusCode: http.StatusBadRequest, Code: ErrorCodeInvalidGrant, Description: "refresh token issued for another provider"}
+	}
+
+	token, err := provider.RefreshToken(family.ProviderRefreshToken)
+	if err != nil {
+		return nil, err
+	}
+	if token.RefreshToken != "" && token.RefreshToken != family.ProviderRefreshToken {
+		if err := r.Store.SetProviderRefreshToken(ctx, family.ID, token.RefreshToken); err != nil {
+			return nil, err
+		}
+	}
+	return token, nil
+}
+
+// refreshFamilySweepInterval is how often a MemoryRefreshFamilyStore drops the
+// expired families that were not presented again.
+const refreshFamilySweepInterval = time.Hour
+
+// MemoryRefreshFamilyStore is a RefreshFamilyStore holding the families in
+// maps: they are lost on restart, and each instance of a service has its own.
+// A family is dropped once it expires by Clock, and its tokens become unknown.
+type MemoryRefreshFamilyStore struct {
+	Clock Clock
+
+	mu       sync.Mutex
+	families map[string]*memoryRefreshFamily
+	tokens   map[string]*memoryRefreshFamily
+	sweptAt  time.Time
+}
+
+type memoryRefreshFamily struct {
+	RefreshFamily
+	current string
+	tokens  []string
+}
+
+// NewMemoryRefreshFamilyStore creates an empty MemoryRefreshFamilyStore.
+func NewMemoryRefreshFamilyStore() *MemoryRefreshFamilyStore {
+	return &MemoryRefreshFamilyStore{
+		families: map[string]*memoryRefreshFamily{},
+		tokens:   map[string]*memoryRefreshFamily{},
+	}
+}
+
+// Create implements RefreshFamilyStore.
+func (s *MemoryRefreshFamilyStore) Create(_ context.Context, tokenID string, family RefreshFamily) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now := ClockWithFallBack(s.Clock).Now(); now.Sub(s.sweptAt) >= refreshFamilySweepInterval {
+		for _, f := range s.families {
+			if !now.Before(f.ExpiresAt) {
+				s.drop(f)
+			}
+		}
+		s.sweptAt = now
+	}
+
+	f := &memoryRefreshFamily{RefreshFamily: family, current: tokenID, tokens: []string{tokenID}}
+	s.families[family.ID] = f
+	s.tokens[tokenID] = f
+	return nil
+}
+
+// Rotate implements RefreshFamilyStore.
+func (s *MemoryRefreshFamilyStore) Rotate(_ context.Context, tokenID, nextID string) (RefreshFamily, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, ok := s.tokens[tokenID]
+	if !ok {
+		return RefreshFamily{}, ErrRefreshTokenNotFound
+	}
+	if !ClockWithFallBack(s.Clock).Now().Before(f.ExpiresAt) {
+		s.drop(f)
+		return RefreshFamily{}, ErrRefreshTokenNotFound
+	}
+	if f.Revoked || f.current != tokenID {
+		f.Revoked = true
+		return f.RefreshFamily, ErrRefreshTokenReused
+	}
+
+	f.current = nextID
+	f.tokens = append(f.tokens, nextID)
+	s.tokens[nextID] = f
+	return f.RefreshFamily, nil
+}
+
+// Unrotate implements RefreshFamilyStore.
+func (s *MemoryRefreshFamilyStore) Unrotate(_ context.Context, tokenID, nextID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, ok := s.tokens[nextID]
+	if !ok || f.current != nextID || len(f.tokens) < 2 || f.tokens[len(f.tokens)-2] != tokenID {
+		return nil
+	}
+	f.current = tokenID
+	f.tokens = f.tokens[:len(f.tokens)-1]
+	delete(s.tokens, nextID)
+	return nil
+}
+
+// SetProviderRefreshToken implements RefreshFamilyStore.
+func (s *MemoryRefreshFamilyStore) SetProviderRefreshToken(_ context.Context, familyID, refreshToken string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if f, ok := s.families[familyID]; ok {
+		f.ProviderRefreshToken = refreshToken
+	}
+	return nil
+}
+
+// Revoke implements RefreshFamilyStore.
+func (s *MemoryRefreshFamilyStore) Revoke(_ context.Context, familyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if f, ok := s.families[familyID]; ok {
+		f.Revoked = true
+	}
+	return nil
+}
+
+// drop removes a family and its tokens.
+func (s *MemoryRefreshFamilyStore) drop(f *memoryRefreshFamily) {
+	for _, t := range f.tokens {
+		delete(s.tokens, t)
+	}
+	delete(s.families, f.ID)
+}
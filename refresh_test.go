@@ -0,0 +1,292 @@
+package oauth_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rapidmidiex/oauth"
+	"github.com/rapidmidiex/oauth/providers/faux"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func Test_Issuer_RefreshReuse(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	issuer := testIssuer(t)
+	issuer.Clock = oauth.ClockFunc(func() time.Time { return now })
+	token, _ := issuer.Issue(ctx, "account-1", oauth.User{})
+	other, _ := issuer.Issue(ctx, "account-1", oauth.User{})
+
+	refreshed, err := issuer.Refresh(ctx, token.RefreshToken)
+	a.NoError(err)
+
+	// reusing the rotated token after the grace period revokes its descendants
+	now = now.Add(oauth.DefaultRefreshGracePeriod)
+	_, err = issuer.Refresh(ctx, token.RefreshToken)
+	a.EqualError(err, "oauth2: invalid_grant: refresh token reused")
+	_, err = issuer.Refresh(ctx, refreshed.RefreshToken)
+	a.EqualError(err, "oauth2: invalid_grant: refresh token reused")
+
+	// other logins are not affected
+	_, err = issuer.Refresh(ctx, other.RefreshToken)
+	a.NoError(err)
+}
+
+func Test_Issuer_RevokeSession(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+	ctx := context.Background()
+
+	issuer := testIssuer(t)
+	token, _ := issuer.Issue(ctx, "account-1", oauth.User{})
+	claims, _ := issuer.Verifier().Verify(ctx, token.AccessToken)
+
+	a.NoError(issuer.RevokeSession(ctx, claims.SessionID))
+	_, err := issuer.Refresh(ctx, token.RefreshToken)
+	a.EqualError(err, "oauth2: invalid_grant: refresh token reused")
+}
+
+func Test_Issuer_RefreshConcurrent(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+	ctx := context.Background()
+
+	issuer := testIssuer(t)
+	token, _ := issuer.Issue(ctx, "account-1", oauth.User{})
+
+	var wg sync.WaitGroup
+	results := make([]*oauth2.Token, 20)
+	errs := make([]error, len(results))
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = issuer.Refresh(ctx, token.RefreshToken)
+		}(i)
+	}
+	wg.Wait()
+
+	// all requests get the same successor, which stays usable
+	for i, err := range errs {
+		a.NoError(err)
+		a.Equal(results[0].RefreshToken, results[i].RefreshToken)
+	}
+	_, err := issuer.Refresh(ctx, results[0].RefreshToken)
+	a.NoError(err)
+}
+
+func Test_Issuer_RefreshGracePeriod(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	issuer := testIssuer(t)
+	issuer.Clock = oauth.ClockFunc(func() time.Time { return now })
+	token, _ := issuer.Issue(ctx, "account-1", oauth.User{})
+
+	refreshed, err := issuer.Refresh(ctx, token.RefreshToken)
+	a.NoError(err)
+
+	// a retry within the grace period gets the same successor
+	now = now.Add(oauth.DefaultRefreshGracePeriod - time.Second)
+	retried, err := issuer.Refresh(ctx, token.RefreshToken)
+	a.NoError(err)
+	a.Equal(refreshed.RefreshToken, retried.RefreshToken)
+	a.Equal(refreshed.AccessToken, retried.AccessToken)
+
+	// afterwards it is reuse
+	now = now.Add(time.Second)
+	_, err = issuer.Refresh(ctx, token.RefreshToken)
+	a.EqualError(err, "oauth2: invalid_grant: refresh token reused")
+	_, err = issuer.Refresh(ctx, refreshed.RefreshToken)
+	a.EqualError(err, "oauth2: invalid_grant: refresh token reused")
+
+	// logging out ends the grace period
+	token, _ = issuer.Issue(ctx, "account-1", oauth.User{})
+	refreshed, err = issuer.Refresh(ctx, token.RefreshToken)
+	a.NoError(err)
+	claims, _ := issuer.Verifier().Verify(ctx, refreshed.AccessToken)
+	a.NoError(issuer.RevokeSession(ctx, claims.SessionID))
+	_, err = issuer.Refresh(ctx, token.RefreshToken)
+	a.EqualError(err, "oauth2: invalid_grant: refresh token reused")
+
+	// without a grace period reuse is detected right away
+	issuer.RefreshGracePeriod = 0
+	token, _ = issuer.Issue(ctx, "account-1", oauth.User{})
+	_, err = issuer.Refresh(ctx, token.RefreshToken)
+	a.NoError(err)
+	_, err = issuer.Refresh(ctx, token.RefreshToken)
+	a.EqualError(err, "oauth2: invalid_grant: refresh token reused")
+}
+
+// refreshingProvider is a provider rotating its refresh tokens.
+type refreshingProvider struct {
+	faux.Provider
+	mu      sync.Mutex
+	current string
+	calls   int
+}
+
+func (p *refreshingProvider) RefreshToken(refreshToken string) (*oauth2.Token, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.calls++
+	if refreshToken != p.current {
+		return nil, errors.New("invalid refresh token")
+	}
+	p.current = refreshToken + "+"
+	token := &oauth2.Token{AccessToken: "access", RefreshToken: p.current}
+	return token.WithExtra(map[string]interface{}{"refresh_token": p.current, "id_token": "id"}), nil
+}
+
+func Test_ProviderRefresher(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	provider := &refreshingProvider{current: "provider-refresh"}
+	refresher := oauth.NewProviderRefresher()
+	refresher.Clock = oauth.ClockFunc(func() time.Time { return now })
+
+	wrapped, err := refresher.Wrap(ctx, oauth.User{Provider: "faux", RefreshToken: "provider-refresh"})
+	a.NoError(err)
+	a.NotEqual("provider-refresh", wrapped)
+
+	token, err := refresher.Refresh(ctx, provider, wrapped)
+	a.NoError(err)
+	a.Equal("access", token.AccessToken)
+	a.NotEqual(wrapped, token.RefreshToken)
+	// the provider's refresh token stays on the server
+	a.Nil(token.Extra("refresh_token"))
+	a.Equal("id", token.Extra("id_token"))
+
+	// the provider's rotated token is used next time
+	token, err = refresher.Refresh(ctx, provider, token.RefreshToken)
+	a.NoError(err)
+	a.Equal("provider-refresh++", provider.current)
+
+	now = now.Add(oauth.DefaultRefreshGracePeriod)
+	_, err = refresher.Refresh(ctx, provider, wrapped)
+	a.EqualError(err, "oauth2: invalid_grant: refresh token reused")
+	_, err = refresher.Refresh(ctx, provider, token.RefreshToken)
+	a.EqualError(err, "oauth2: invalid_grant: refresh token reused")
+	a.Equal(2, provider.calls)
+
+	_, err = refresher.Wrap(ctx, oauth.User{Provider: "faux"})
+	a.Error(err)
+}
+
+func Test_ProviderRefresher_ProviderFails(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+	ctx := context.Background()
+
+	provider := &refreshingProvider{current: "unavailable"}
+	refresher := oauth.NewProviderRefresher()
+	wrapped, _ := refresher.Wrap(ctx, oauth.User{Provider: "faux", RefreshToken: "provider-refresh"})
+
+	_, err := refresher.Refresh(ctx, provider, wrapped)
+	a.EqualError(err, "invalid refresh token")
+
+	// the wrapped token is still current
+	provider.current = "provider-refresh"
+	token, err := refresher.Refresh(ctx, provider, wrapped)
+	a.NoError(err)
+	_, err = refresher.Refresh(ctx, provider, token.RefreshToken)
+	a.NoError(err)
+}
+
+func Test_ProviderRefresher_Concurrent(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+	ctx := context.Background()
+
+	provider := &refreshingProvider{current: "provider-refresh"}
+	refresher := oauth.NewProviderRefresher()
+	wrapped, _ := refresher.Wrap(ctx, oauth.User{Provider: "faux", RefreshToken: "provider-refresh"})
+
+	var wg sync.WaitGroup
+	results := make([]*oauth2.Token, 20)
+	errs := make([]error, len(results))
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = refresher.Refresh(ctx, provider, wrapped)
+		}(i)
+	}
+	wg.Wait()
+
+	// all requests get the same successor, and only one reached the provider
+	for i, err := range errs {
+		a.NoError(err)
+		a.Equal(results[0].RefreshToken, results[i].RefreshToken)
+	}
+	a.Equal(1, provider.calls)
+
+	_, err := refresher.Refresh(ctx, provider, results[0].RefreshToken)
+	a.NoError(err)
+	a.Equal("provider-refresh++", provider.current)
+}
+
+func Test_ProviderRefresher_OtherProvider(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+	ctx := context.Background()
+
+	refresher := oauth.NewProviderRefresher()
+	wrapped, _ := refresher.Wrap(ctx, oauth.User{Provider: "github", RefreshToken: "provider-refresh"})
+
+	_, err := refresher.Refresh(ctx, &refreshingProvider{current: "provider-refresh"}, wrapped)
+	a.EqualError(err, "oauth2: invalid_grant: refresh token issued for another provider")
+
+	// the wrapped token still works with its own provider
+	_, err = refresher.Refresh(ctx, githubProvider{&refreshingProvider{current: "provider-refresh"}}, wrapped)
+	a.NoError(err)
+}
+
+type githubProvider struct {
+	*refreshingProvider
+}
+
+func (githubProvider) Name() string {
+	return "github"
+}
+
+func Test_MemoryRefreshFamilyStore_Expiry(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	store := oauth.NewMemoryRefreshFamilyStore()
+	store.Clock = oauth.ClockFunc(func() time.Time { return now })
+
+	a.NoError(store.Create(ctx, "token-1", oauth.RefreshFamily{ID: "family-1", ExpiresAt: now.Add(time.Hour)}))
+	a.NoError(store.Create(ctx, "token-2", oauth.RefreshFamily{ID: "family-2", ExpiresAt: now.Add(time.Hour)}))
+	family, err := store.Rotate(ctx, "token-1", "token-1b")
+	a.NoError(err)
+	a.Equal("family-1", family.ID)
+
+	now = now.Add(time.Hour)
+	_, err = store.Rotate(ctx, "token-1b", "token-1c")
+	a.Equal(oauth.ErrRefreshTokenNotFound, err)
+	_, err = store.Rotate(ctx, "token-1", "token-1c")
+	a.Equal(oauth.ErrRefreshTokenNotFound, err, "the family's rotated tokens are dropped with it")
+
+	// families that are never presented again are swept
+	a.NoError(store.Create(ctx, "token-3", oauth.RefreshFamily{ID: "family-3", ExpiresAt: now.Add(time.Hour)}))
+	now = now.Add(-time.Hour)
+	_, err = store.Rotate(ctx, "token-2", "token-2b")
+	a.Equal(oauth.ErrRefreshTokenNotFound, err)
+}
@@ -19,3 +19,11 @@ type Session interface {
 	// that can be stored for later access to the provider.
 	Authorize(Provider, Params) (string, error)
 }
+
+// FormPostSession is implemented by sessions whose provider may post the
+// authorization response back, with response_mode=form_post. SetSession also
+// stores them in a SameSite=None cookie while they await it.
+type FormPostSession interface {
+	Session
+	AwaitsFormPost() bool
+}
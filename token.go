@@ -0,0 +1,85 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// ParseTokenResponse decodes a successful access token response as described
+// in RFC 6749 section 5.1. The expiry is computed from expires_in relative to
+// now, and every member of the response is available through Token.Extra.
+// Some providers report errors with a 200 status; those are returned as an
+// *Error.
+func ParseTokenResponse(body []byte, now time.Time) (*oauth2.Token, error) {
+	var tr struct {
+		AccessToken  string      `json:"access_token"`
+		TokenType    string      `json:"token_type"`
+		RefreshToken string      `json:"refresh_token"`
+		ExpiresIn    json.Number `json:"expires_in"`
+		Error        string      `json:"error"`
+	}
+	if err := json.Unmarshal(body, &tr); err != nil {
+		return nil, err
+	}
+	if tr.Error != "" {
+		return nil, ErrorFromResponse(http.StatusOK, body)
+	}
+	if tr.AccessToken == "" {
+		return nil, errors.New("oauth2: server response missing access_token")
+	}
+
+	token := &oauth2.Token{
+		AccessToken:  tr.AccessToken,
+		TokenType:    tr.TokenType,
+		RefreshToken: tr.RefreshToken,
+	}
+	if expiresIn, err := tr.ExpiresIn.Int64(); err == nil && expiresIn > 0 {
+		token.Expiry = now.Add(time.Duration(expiresIn) * time.Second)
+	}
+
+	raw := make(map[string]interface{})
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, err
+	}
+	return token.WithExtra(raw), nil
+}
+
+// PostForm POSTs values to endpoint and returns the body of a successful (2xx)
+// response. Any other response is returned as an *Error. header may carry client
+// authentication and may be nil.
+func PostForm(ctx context.Context, client *http.Client, endpoint string, header http.Header, values url.Values) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(values.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := HTTPClientWithFallBack(client).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, ErrorFromResponse(resp.StatusCode, body)
+	}
+	return body, nil
+}
@@ -0,0 +1,36 @@
+package oauth_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/rapidmidiex/oauth"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseTokenResponse(t *testing.T) {
+	a := assert.New(t)
+
+	now := time.Unix(1700000000, 0)
+	token, err := oauth.ParseTokenResponse([]byte(`{"access_token":"at","token_type":"Bearer","refresh_token":"rt","expires_in":3600,"id_token":"idt"}`), now)
+	a.NoError(err)
+	a.Equal("at", token.AccessToken)
+	a.Equal("rt", token.RefreshToken)
+	a.Equal(now.Add(time.Hour), token.Expiry)
+	a.Equal("idt", token.Extra("id_token"))
+
+	_, err = oauth.ParseTokenResponse([]byte(`{"error":"authorization_pending"}`), now)
+	a.Equal(&oauth.Error{StatusCode: http.StatusOK, Code: "authorization_pending"}, err)
+}
+
+func Test_ErrorFromResponse(t *testing.T) {
+	a := assert.New(t)
+
+	err := oauth.ErrorFromResponse(http.StatusBadRequest, []byte(`{"error":"invalid_grant","error_description":"code expired"}`))
+	a.Equal("invalid_grant", err.Code)
+	a.Equal("oauth2: invalid_grant: code expired", err.Error())
+
+	err = oauth.ErrorFromResponse(http.StatusBadGateway, []byte(`<html>`))
+	a.Equal("oauth2: server responded with 502", err.Error())
+}
@@ -28,4 +28,22 @@ type User struct {
 	RefreshToken      string
 	ExpiresAt         time.Time
 	IDToken           string
+	// SessionID is the provider's session identifier (the OpenID Connect
+	// "sid" claim), used to match provider initiated logouts.
+	SessionID string
+	// Roles and Groups the user has at the provider, when it tells.
+	Roles  []string
+	Groups []string
+	// EmailVerified tells whether the provider verified that the user owns
+	// Email. Never link accounts by an unverified email. It stays false for
+	// providers that do not tell, such as Facebook, so LinkVerifiedEmailFrom
+	// never links their users by email.
+	EmailVerified bool
+	// Username is the user's handle at the provider, such as a GitHub login.
+	// It is empty for providers without one, such as Facebook.
+	Username string
+	// Locale is the user's language, typically a BCP 47 tag such as "en-US".
+	Locale string
+	// ProfileURL is the user's public profile page at the provider.
+	ProfileURL string
 }
@@ -0,0 +1,178 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrAccountNotFound is returned when no account is linked to an identity.
+	ErrAccountNotFound = errors.New("oauth: no account is linked to the identity")
+	// ErrIdentityLinked is returned when linking an identity that is linked to
+	// another account already.
+	ErrIdentityLinked = errors.New("oauth: identity is linked to another account")
+	// ErrIdentityNotLinked is returned when unlinking an identity that is not
+	// linked to the account.
+	ErrIdentityNotLinked = errors.New("oauth: identity is not linked to the account")
+)
+
+// LinkedUser is a provider identity together with the account it is linked to.
+type LinkedUser struct {
+	AccountID string
+	User      User
+}
+
+// UserStore keeps the accounts of an application and the provider identities,
+// keyed by (User.Provider, User.UserID), linked to each of them.
+type UserStore interface {
+	// Find returns the ID of the account the identity is linked to, or
+	// ErrAccountNotFound.
+	Find(ctx context.Context, provider, userID string) (accountID string, err error)
+	// FindByEmail returns the identities whose email matches,
+	// case-insensitively.
+	FindByEmail(ctx context.Context, email string) ([]LinkedUser, error)
+	// Users returns the identities linked to the account.
+	Users(ctx context.Context, accountID string) ([]User, error)
+	// Create creates an account with the identity linked to it.
+	Create(ctx context.Context, user User) (accountID string, err error)
+	// Link links the identity to the account, or updates it when it is
+	// linked to the account already. It returns ErrIdentityLinked when the
+	// identity is linked to another account.
+	Link(ctx context.Context, accountID string, user User) error
+	// Unlink removes the identity from the account, or returns
+	// ErrIdentityNotLinked. It returns ErrLastIdentity instead when the
+	// identity is the only one left, checked atomically with the removal so
+	// that concurrent calls cannot leave the account without identities.
+	Unlink(ctx context.Context, accountID, provider, userID string) error
+}
+
+type identityKey struct {
+	provider, userID string
+}
+
+// MemoryUserStore is a UserStore holding the accounts in maps. Accounts do
+// not survive a restart, so it suits tests and prototypes; applications keep
+// their accounts in their own database.
+type MemoryUserStore struct {
+	mu         sync.RWMutex
+	identities map[identityKey]LinkedUser
+	accounts   map[string][]identityKey
+}
+
+// NewMemoryUserStore creates an empty MemoryUserStore.
+func NewMemoryUserStore() *MemoryUserStore {
+	return &MemoryUserStore{
+		identities: map[identityKey]LinkedUser{},
+		accounts:   map[string][]identityKey{},
+	}
+}
+
+// Find implements UserStore.
+func (s *MemoryUserStore) Find(_ context.Context, provider, userID string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	linked, ok := s.identities[identityKey{provider, userID}]
+	if !ok {
+		return "", ErrAccountNotFound
+	}
+	return linked.AccountID, nil
+}
+
+// FindByEmail implements UserStore.
+func (s *MemoryUserStore) FindByEmail(_ context.Context, email string) ([]LinkedUser, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var users []LinkedUser
+	for _, linked := range s.identities {
+		if email != "" && strings.EqualFold(linked.User.Email, email) {
+			users = append(users, linked)
+		}
+	}
+	return users, nil
+}
+
+// Users implements UserStore.
+func (s *MemoryUserStore) Users(_ context.Context, accountID string) ([]User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys, ok := s.accounts[accountID]
+	if !ok {
+		return nil, ErrAccountNotFound
+	}
+	users := make([]User, 0, len(keys))
+	for _, key := range keys {
+		users = append(users, s.identities[key].User)
+	}
+	return users, nil
+}
+
+// Create implements UserStore.
+func (s *MemoryUserStore) Create(_ context.Context, user User) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	accountID := hex.EncodeToString(b)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := identityKey{user.Provider, user.UserID}
+	if _, ok := s.identities[key]; ok {
+		return "", ErrIdentityLinked
+	}
+	s.identities[key] = LinkedUser{AccountID: accountID, User: user}
+	s.accounts[accountID] = []identityKey{key}
+	return accountID, nil
+}
+
+// Link implements UserStore.
+func (s *MemoryUserStore) Link(_ context.Context, accountID string, user User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.accounts[accountID]; !ok {
+		return ErrAccountNotFound
+	}
+	key := identityKey{user.Provider, user.UserID}
+	if linked, ok := s.identities[key]; ok {
+		if linked.AccountID != accountID {
+			return ErrIdentityLinked
+		}
+	} else {
+		s.accounts[accountID] = append(s.accounts[accountID], key)
+	}
+	s.identities[key] = LinkedUser{AccountID: accountID, User: user}
+	return nil
+}
+
+// Unlink implements UserStore.
+func (s *MemoryUserStore) Unlink(_ context.Context, accountID, provider, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := identityKey{provider, userID}
+	if linked, ok := s.identities[key]; !ok || linked.AccountID != accountID {
+		return ErrIdentityNotLinked
+	}
+	keys := s.accounts[accountID]
+	if len(keys) < 2 {
+		return ErrLastIdentity
+	}
+	delete(s.identities, key)
+
+	for i, k := range keys {
+		if k == key {
+			s.accounts[accountID] = append(keys[:i:i], keys[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package oauth_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rapidmidiex/oauth"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_MemoryUserStore(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+	ctx := context.Background()
+
+	store := oauth.NewMemoryUserStore()
+	github := oauth.User{Provider: "github", UserID: "1", Email: "Drummer@example.com"}
+	google := oauth.User{Provider: "google", UserID: "1", Email: "drummer@example.com"}
+
+	_, err := store.Find(ctx, "github", "1")
+	a.Equal(oauth.ErrAccountNotFound, err)
+
+	accountID, err := store.Create(ctx, github)
+	a.NoError(err)
+	a.NotEmpty(accountID)
+	_, err = store.Create(ctx, github)
+	a.Equal(oauth.ErrIdentityLinked, err)
+
+	found, err := store.Find(ctx, "github", "1")
+	a.NoError(err)
+	a.Equal(accountID, found)
+
+	a.NoError(store.Link(ctx, accountID, google))
+	users, err := store.Users(ctx, accountID)
+	a.NoError(err)
+	a.Equal([]oauth.User{github, google}, users)
+
+	linked, err := store.FindByEmail(ctx, "DRUMMER@example.com")
+	a.NoError(err)
+	a.Len(linked, 2)
+
+	otherID, err := store.Create(ctx, oauth.User{Provider: "discord", UserID: "1"})
+	a.NoError(err)
+	a.Equal(oauth.ErrIdentityLinked, store.Link(ctx, otherID, google))
+	a.Equal(oauth.ErrAccountNotFound, store.Link(ctx, "missing", google))
+
+	// linking again updates the profile
+	google.Name = "Drummer"
+	a.NoError(store.Link(ctx, accountID, google))
+	users, _ = store.Users(ctx, accountID)
+	a.Equal("Drummer", users[1].Name)
+
+	a.Equal(oauth.ErrIdentityNotLinked, store.Unlink(ctx, otherID, "google", "1"))
+	a.NoError(store.Unlink(ctx, accountID, "google", "1"))
+	users, _ = store.Users(ctx, accountID)
+	a.Equal([]oauth.User{github}, users)
+
+	a.Equal(oauth.ErrLastIdentity, store.Unlink(ctx, accountID, "github", "1"))
+	users, _ = store.Users(ctx, accountID)
+	a.Equal([]oauth.User{github}, users)
+}
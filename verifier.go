@@ -0,0 +1,224 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rapidmidiex/oauth/internal/jose"
+)
+
+const (
+	// DefaultClockSkew is the tolerance applied to the expiry of tokens by a
+	// Verifier created with NewVerifier.
+	DefaultClockSkew = 10 * time.Second
+
+	// jwksMinRefetchInterval limits how often a Verifier fetches the JWKS
+	// again for a token signed by an unknown key.
+	jwksMinRefetchInterval = time.Minute
+
+	// jwksFetchTimeout bounds a JWKS fetch, which is not canceled with the
+	// request that started it as other requests may be waiting for it.
+	jwksFetchTimeout = 30 * time.Second
+)
+
+// ErrInvalidToken is returned by Verifier.Verify for access tokens that are
+// malformed, not signed by the issuer, expired, issued in the future or meant
+// for another audience.
+var ErrInvalidToken = errors.New("oauth: invalid access token")
+
+// Verifier verifies the access tokens minted by an Issuer, in the services
+// accepting them:
+//
+//	verifier := oauth.NewVerifier("https://auth.rapidmidiex.com", "https://auth.rapidmidiex.com/jwks", "rapidmidiex")
+//	http.Handle("/api/", verifier.Middleware(api))
+type Verifier struct {
+	Issuer string
+	// Audience must be one of the aud claim values, when set.
+	Audience   string
+	JWKSURL    string
+	HTTPClient *http.Client
+	Clock      Clock
+	ClockSkew  time.Duration
+
+	// keys returns the issuer's keys, fetched again when refetch is set. It
+	// defaults to fetchedKeys.
+	keys func(ctx context.Context, refetch bool) (*jose.JWKS, error)
+
+	mu        sync.Mutex
+	jwks      *jose.JWKS
+	fetchedAt time.Time
+	fetching  *jwksFetch
+}
+
+// jwksFetch is a JWKS fetch in flight, whose outcome is shared by the requests
+// waiting for it.
+type jwksFetch struct {
+	done chan struct{}
+	set  *jose.JWKS
+	err  error
+}
+
+// NewVerifier creates a Verifier of the tokens of issuer, whose keys are
+// fetched from jwksURL, the Issuer's JWKSHandler.
+func NewVerifier(issuer, jwksURL, audience string) *Verifier {
+	return &Verifier{
+		Issuer:    issuer,
+		Audience:  audience,
+		JWKSURL:   jwksURL,
+		ClockSkew: DefaultClockSkew,
+	}
+}
+
+// Verify checks the signature and claims of an access token.
+func (v *Verifier) Verify(ctx context.Context, accessToken string) (*AccessClaims, error) {
+	jws, err := jose.Parse(accessToken)
+	if err != nil || jws.Header.Typ != accessTokenType || strings.HasPrefix(jws.Header.Alg, "HS") {
+		return nil, ErrInvalidToken
+	}
+
+	issuerKeys := v.keys
+	if issuerKeys == nil {
+		issuerKeys = v.fetchedKeys
+	}
+	set, err := issuerKeys(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	keys := set.Find(jws.Header.Kid, jws.Header.Alg)
+	if len(keys) == 0 {
+		if set, err = issuerKeys(ctx, true); err != nil {
+			return nil, err
+		}
+		keys = set.Find(jws.Header.Kid, jws.Header.Alg)
+	}
+	if jws.VerifyAny(keys) != nil {
+		return nil, ErrInvalidToken
+	}
+
+	claims := &AccessClaims{}
+	if err := json.Unmarshal(jws.Payload, claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if claims.Issuer != v.Issuer || v.Audience != "" && !containsAny(claims.Audience, []string{v.Audience}) {
+		return nil, ErrInvalidToken
+	}
+	now := ClockWithFallBack(v.Clock).Now()
+	if !now.Before(time.Unix(claims.ExpiresAt, 0).Add(v.ClockSkew)) {
+		return nil, ErrInvalidToken
+	}
+	if time.Unix(claims.IssuedAt, 0).After(now.Add(v.ClockSkew)) {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// Middleware only lets requests with a valid bearer access token through to
+// next, which finds the token's claims with AccessClaimsFromContext. Other
+// requests are answered with a 401 as described in RFC 6750 section 3.
+func (v *Verifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accessToken := bearerToken(r)
+		if accessToken == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		claims, err := v.Verify(r.Context(), accessToken)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			writeError(w, &Error{StatusCode: http.StatusUnauthorized, Code: "invalid_token"})
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), accessClaimsKey{}, claims)))
+	})
+}
+
+type accessClaimsKey struct{}
+
+// AccessClaimsFromContext returns the claims of the access token verified by
+// Verifier.Middleware.
+func AccessClaimsFromContext(ctx context.Context) (*AccessClaims, bool) {
+	claims, ok := ctx.Value(accessClaimsKey{}).(*AccessClaims)
+	return claims, ok
+}
+
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
+
+// fetchedKeys returns the cached JWKS, fetching it the first time and when
+// refetch is set, at most every jwksMinRefetchInterval. Concurrent calls wait
+// for the same fetch, which runs without holding the lock; each gives up when
+// its own ctx is done.
+func (v *Verifier) fetchedKeys(ctx context.Context, refetch bool) (*jose.JWKS, error) {
+	v.mu.Lock()
+	now := ClockWithFallBack(v.Clock).Now()
+	if v.jwks != nil && (!refetch || now.Sub(v.fetchedAt) < jwksMinRefetchInterval) {
+		set := v.jwks
+		v.mu.Unlock()
+		return set, nil
+	}
+
+	fetch := v.fetching
+	if fetch == nil {
+		fetch = &jwksFetch{done: make(chan struct{})}
+		v.fetching = fetch
+		go v.fetch(fetch, now)
+	}
+	v.mu.Unlock()
+
+	select {
+	case <-fetch.done:
+		return fetch.set, fetch.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// fetch runs fetch, caching its JWKS as fetched at now.
+func (v *Verifier) fetch(fetch *jwksFetch, now time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), jwksFetchTimeout)
+	defer cancel()
+	fetch.set, fetch.err = v.fetchKeys(ctx)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if fetch.err == nil {
+		v.jwks, v.fetchedAt = fetch.set, now
+	}
+	v.fetching = nil
+	close(fetch.done)
+}
+
+// fetchKeys fetches the JWKS from JWKSURL.
+func (v *Verifier) fetchKeys(ctx context.Context) (*jose.JWKS, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", v.JWKSURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := HTTPClientWithFallBack(v.HTTPClient).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oauth: JWKS endpoint responded with a %d", resp.StatusCode)
+	}
+	set := &jose.JWKS{}
+	if err := json.NewDecoder(resp.Body).Decode(set); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
@@ -0,0 +1,147 @@
+package oauth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rapidmidiex/oauth"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Verifier(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+	ctx := context.Background()
+
+	issuer := testIssuer(t)
+	var fetches int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		issuer.JWKSHandler().ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	now := time.Now()
+	verifier := oauth.NewVerifier("https://auth.example.com", ts.URL, "jam")
+	verifier.Clock = oauth.ClockFunc(func() time.Time { return now })
+
+	token, _ := issuer.Issue(ctx, "account-1", oauth.User{})
+	claims, err := verifier.Verify(ctx, token.AccessToken)
+	a.NoError(err)
+	a.Equal("account-1", claims.Subject)
+	_, err = verifier.Verify(ctx, token.AccessToken)
+	a.NoError(err)
+	a.Equal(int32(1), atomic.LoadInt32(&fetches))
+
+	// rotated keys are fetched again
+	a.NoError(issuer.AddSigningKey(signingKeyPEM(t), "key-2"))
+	now = now.Add(2 * time.Minute)
+	rotated, _ := issuer.Issue(ctx, "account-1", oauth.User{})
+	_, err = verifier.Verify(ctx, rotated.AccessToken)
+	a.NoError(err)
+	a.Equal(int32(2), atomic.LoadInt32(&fetches))
+
+	now = now.Add(oauth.DefaultAccessTokenTTL)
+	_, err = verifier.Verify(ctx, token.AccessToken)
+	a.Equal(oauth.ErrInvalidToken, err)
+
+	// tokens issued in the future are rejected, beyond the clock skew
+	now = time.Now().Add(-oauth.DefaultClockSkew + time.Second)
+	fresh, _ := issuer.Issue(ctx, "account-1", oauth.User{})
+	_, err = verifier.Verify(ctx, fresh.AccessToken)
+	a.NoError(err)
+	now = now.Add(-2 * time.Second)
+	_, err = verifier.Verify(ctx, fresh.AccessToken)
+	a.Equal(oauth.ErrInvalidToken, err)
+
+	other := oauth.NewVerifier("https://auth.example.com", ts.URL, "mixer")
+	_, err = other.Verify(ctx, rotated.AccessToken)
+	a.Equal(oauth.ErrInvalidToken, err)
+
+	_, err = verifier.Verify(ctx, "not-a-token")
+	a.Equal(oauth.ErrInvalidToken, err)
+}
+
+func Test_Verifier_ConcurrentFetch(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+	ctx := context.Background()
+
+	issuer := testIssuer(t)
+	var fetches int32
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		<-release
+		issuer.JWKSHandler().ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	verifier := oauth.NewVerifier("https://auth.example.com", ts.URL, "jam")
+	token, _ := issuer.Issue(ctx, "account-1", oauth.User{})
+
+	// the request starting the fetch gives up, without failing it for others
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err := verifier.Verify(canceled, token.AccessToken)
+	a.Equal(context.Canceled, err)
+	for atomic.LoadInt32(&fetches) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 10)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = verifier.Verify(ctx, token.AccessToken)
+		}(i)
+	}
+
+	close(release)
+	wg.Wait()
+	for _, err := range errs {
+		a.NoError(err)
+	}
+	a.Equal(int32(1), atomic.LoadInt32(&fetches))
+}
+
+func Test_Verifier_Middleware(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	issuer := testIssuer(t)
+	token, _ := issuer.Issue(context.Background(), "account-1", oauth.User{Roles: []string{"drummer"}})
+
+	handler := issuer.Verifier().Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := oauth.AccessClaimsFromContext(r.Context())
+		a.True(ok)
+		a.Equal("account-1", claims.Subject)
+		a.Equal([]string{"drummer"}, claims.Roles)
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/api/jams", nil)
+	r.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	a.Equal(http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/jams", nil))
+	a.Equal(http.StatusUnauthorized, w.Code)
+	a.Equal("Bearer", w.Header().Get("WWW-Authenticate"))
+
+	r = httptest.NewRequest(http.MethodGet, "/api/jams", nil)
+	r.Header.Set("Authorization", "Bearer "+token.AccessToken+"x")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	a.Equal(http.StatusUnauthorized, w.Code)
+	a.Equal(`Bearer error="invalid_token"`, w.Header().Get("WWW-Authenticate"))
+	a.JSONEq(`{"error":"invalid_token"}`, w.Body.String())
+}
@@ -0,0 +1,231 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTicketTTL is how long the tickets of a WebSocketAuth created with
+// NewWebSocketAuth can be used.
+const DefaultTicketTTL = 30 * time.Second
+
+// ErrTicketNotFound is returned by TicketStore.Take for unknown tickets.
+var ErrTicketNotFound = errors.New("oauth: ticket not found")
+
+// Ticket is what a WebSocket ticket stands for.
+type Ticket struct {
+	User      User
+	ExpiresAt time.Time
+}
+
+// TicketStore keeps the tickets of a WebSocketAuth, keyed by a hash of the
+// ticket.
+type TicketStore interface {
+	Save(ctx context.Context, id string, ticket Ticket) error
+	// Take removes the ticket and returns it, or ErrTicketNotFound. Of
+	// concurrent calls for the same ticket only one may succeed.
+	Take(ctx context.Context, id string) (Ticket, error)
+}
+
+// WebSocketAuth authenticates WebSocket handshakes, which browsers send
+// without an Authorization header. The user is taken from a ticket query
+// parameter, obtained beforehand from IssueTicket or TicketHandler, or else
+// from the session cookie set by SetSession:
+//
+//	wsAuth := oauth.NewWebSocketAuth(provider)
+//	http.Handle("/ws/ticket", wsAuth.TicketHandler())
+//	http.Handle("/ws/jam", wsAuth.Middleware(jamHandler))
+//
+// and in the browser:
+//
+//	new WebSocket("wss://jam.rapidmidiex.com/ws/jam?ticket=" + ticket)
+type WebSocketAuth struct {
+	// Sessions resolves the user of the session cookie. Share the Sessions of
+	// a SessionAuth to share its cache.
+	Sessions  *SessionUsers
+	Tickets   TicketStore
+	TicketTTL time.Duration
+	// AllowedOrigins are the origins, besides the request's own host, that
+	// may open WebSockets authenticated by the session cookie. Tickets are
+	// accepted from any origin.
+	AllowedOrigins []string
+	Clock          Clock
+}
+
+// NewWebSocketAuth creates a WebSocketAuth keeping tickets in memory for
+// DefaultTicketTTL.
+func NewWebSocketAuth(provider Provider) *WebSocketAuth {
+	return &WebSocketAuth{
+		Sessions:  NewSessionUsers(provider),
+		Tickets:   NewMemoryTicketStore(),
+		TicketTTL: DefaultTicketTTL,
+	}
+}
+
+// IssueTicket returns a ticket authenticating one WebSocket handshake as user
+// within TicketTTL.
+func (a *WebSocketAuth) IssueTicket(ctx context.Context, user User) (string, error) {
+	ticket, err := randomString(32)
+	if err != nil {
+		return "", err
+	}
+	err = a.Tickets.Save(ctx, hashToken(ticket), Ticket{
+		User:      user,
+		ExpiresAt: ClockWithFallBack(a.Clock).Now().Add(a.TicketTTL),
+	})
+	return ticket, err
+}
+
+// TicketHandler answers requests authenticated by the session cookie, or by a
+// middleware that put the user in the context, with a ticket:
+//
+//	{"ticket": "..."}
+func (a *WebSocketAuth) TicketHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			var err error
+			if user, err = a.Sessions.User(w, r); err != nil {
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+		}
+
+		ticket, err := a.IssueTicket(r.Context(), user)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(map[string]string{"ticket": ticket})
+	})
+}
+
+// Middleware lets authenticated WebSocket handshakes through to next, which
+// finds the user with UserFromContext. Requests that are not WebSocket
+// handshakes are answered with a 400, unauthenticated ones with a 401 and
+// cookie authenticated ones from foreign origins with a 403. A session cookie
+// refreshed by Sessions is set on w, so the WebSocket upgrade should send the
+// headers of w along.
+func (a *WebSocketAuth) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isWebSocketHandshake(r) {
+			http.Error(w, "websocket handshake expected", http.StatusBadRequest)
+			return
+		}
+
+		if ticket := r.URL.Query().Get("ticket"); ticket != "" {
+			t, err := a.Tickets.Take(r.Context(), hashToken(ticket))
+			if err != nil || !ClockWithFallBack(a.Clock).Now().Before(t.ExpiresAt) {
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), t.User)))
+			return
+		}
+
+		if !a.allowedOrigin(r) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		user, err := a.Sessions.User(w, r)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), user)))
+	})
+}
+
+// allowedOrigin protects cookie authenticated handshakes against cross-site
+// WebSocket hijacking, see RFC 6455 section 10.2.
+func (a *WebSocketAuth) allowedOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		// not sent by a browser
+		return true
+	}
+	for _, allowed := range a.AllowedOrigins {
+		if strings.EqualFold(origin, allowed) {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+func isWebSocketHandshake(r *http.Request) bool {
+	return headerContainsToken(r.Header, "Connection", "upgrade") &&
+		headerContainsToken(r.Header, "Upgrade", "websocket")
+}
+
+func headerContainsToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ticketSweepInterval is how often a MemoryTicketStore drops the expired
+// tickets that were never taken.
+const ticketSweepInterval = time.Minute
+
+// MemoryTicketStore is a TicketStore holding the tickets in a map, so a ticket
+// only opens WebSockets on the instance that issued it. Take ignores tickets
+// that expired by Clock.
+type MemoryTicketStore struct {
+	Clock Clock
+
+	mu      sync.Mutex
+	tickets map[string]Ticket
+	sweptAt time.Time
+}
+
+// NewMemoryTicketStore creates an empty MemoryTicketStore.
+func NewMemoryTicketStore() *MemoryTicketStore {
+	return &MemoryTicketStore{tickets: map[string]Ticket{}}
+}
+
+// Save implements TicketStore.
+func (s *MemoryTicketStore) Save(_ context.Context, id string, ticket Ticket) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now := ClockWithFallBack(s.Clock).Now(); now.Sub(s.sweptAt) >= ticketSweepInterval {
+		for k, t := range s.tickets {
+			if !now.Before(t.ExpiresAt) {
+				delete(s.tickets, k)
+			}
+		}
+		s.sweptAt = now
+	}
+	s.tickets[id] = ticket
+	return nil
+}
+
+// Take implements TicketStore.
+func (s *MemoryTicketStore) Take(_ context.Context, id string) (Ticket, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ticket, ok := s.tickets[id]
+	if !ok {
+		return Ticket{}, ErrTicketNotFound
+	}
+	delete(s.tickets, id)
+	if !ClockWithFallBack(s.Clock).Now().Before(ticket.ExpiresAt) {
+		return Ticket{}, ErrTicketNotFound
+	}
+	return ticket, nil
+}
@@ -0,0 +1,178 @@
+package oauth_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rapidmidiex/oauth"
+	"github.com/rapidmidiex/oauth/providers/faux"
+	"github.com/stretchr/testify/assert"
+)
+
+// sessionCookie returns the cookie SetSession sets for sess.
+func sessionCookie(t *testing.T, sess oauth.Session) *http.Cookie {
+	w := httptest.NewRecorder()
+	if err := oauth.SetSession(w, sess, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	return w.Result().Cookies()[0]
+}
+
+func handshake(target string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	r.Header.Set("Connection", "keep-alive, Upgrade")
+	r.Header.Set("Upgrade", "websocket")
+	return r
+}
+
+func Test_WebSocketAuth_Cookie(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	wsAuth := oauth.NewWebSocketAuth(&faux.Provider{})
+	wsAuth.AllowedOrigins = []string{"https://rapidmidiex.com"}
+	handler := wsAuth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := oauth.UserFromContext(r.Context())
+		a.True(ok)
+		a.Equal("drummer", user.UserID)
+	}))
+	cookie := sessionCookie(t, &faux.Session{ID: "drummer", AccessToken: "access"})
+
+	for origin, status := range map[string]int{
+		"":                         http.StatusOK,
+		"http://example.com":       http.StatusOK,
+		"https://rapidmidiex.com":  http.StatusOK,
+		"https://attacker.example": http.StatusForbidden,
+	} {
+		r := handshake("/ws/jam")
+		r.AddCookie(cookie)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		a.Equal(status, w.Code, origin)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, handshake("/ws/jam"))
+	a.Equal(http.StatusUnauthorized, w.Code)
+
+	// not a handshake
+	r := httptest.NewRequest(http.MethodGet, "/ws/jam", nil)
+	r.AddCookie(cookie)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	a.Equal(http.StatusBadRequest, w.Code)
+}
+
+func Test_WebSocketAuth_RefreshExpired(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	now := time.Now()
+	provider := &expiringProvider{now: now}
+	wsAuth := oauth.NewWebSocketAuth(provider)
+	wsAuth.Sessions.Clock = oauth.ClockFunc(func() time.Time { return now })
+	wsAuth.Sessions.RefreshExpired = true
+
+	var accessToken string
+	handler := wsAuth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := oauth.UserFromContext(r.Context())
+		accessToken = user.AccessToken
+	}))
+
+	r := handshake("/ws/jam")
+	r.AddCookie(sessionCookie(t, &expiringSession{AccessToken: "access", RefreshToken: "refresh", ExpiresAt: now.Add(-time.Minute)}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal("refreshed", accessToken)
+	a.Equal(1, provider.refreshes)
+	a.Len(w.Result().Cookies(), 1)
+}
+
+func Test_WebSocketAuth_Ticket(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	now := time.Now()
+	wsAuth := oauth.NewWebSocketAuth(&faux.Provider{})
+	wsAuth.Clock = oauth.ClockFunc(func() time.Time { return now })
+	handler := wsAuth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := oauth.UserFromContext(r.Context())
+		a.Equal("drummer", user.UserID)
+	}))
+
+	// tickets are issued to the session user
+	r := httptest.NewRequest(http.MethodPost, "/ws/ticket", nil)
+	r.AddCookie(sessionCookie(t, &faux.Session{ID: "drummer", AccessToken: "access"}))
+	w := httptest.NewRecorder()
+	wsAuth.TicketHandler().ServeHTTP(w, r)
+	a.Equal(http.StatusOK, w.Code)
+	var body struct {
+		Ticket string `json:"ticket"`
+	}
+	a.NoError(json.Unmarshal(w.Body.Bytes(), &body))
+	a.NotEmpty(body.Ticket)
+
+	r = handshake("/ws/jam?ticket=" + body.Ticket)
+	r.Header.Set("Origin", "https://elsewhere.example")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	a.Equal(http.StatusOK, w.Code)
+
+	// tickets are used once
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, handshake("/ws/jam?ticket="+body.Ticket))
+	a.Equal(http.StatusUnauthorized, w.Code)
+
+	ticket, err := wsAuth.IssueTicket(context.Background(), oauth.User{UserID: "drummer"})
+	a.NoError(err)
+	now = now.Add(oauth.DefaultTicketTTL)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, handshake("/ws/jam?ticket="+ticket))
+	a.Equal(http.StatusUnauthorized, w.Code)
+
+	w = httptest.NewRecorder()
+	wsAuth.TicketHandler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/ws/ticket", nil))
+	a.Equal(http.StatusUnauthorized, w.Code)
+}
+
+func Test_UserFromContext(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	_, ok := oauth.UserFromContext(context.Background())
+	a.False(ok)
+
+	user, ok := oauth.UserFromContext(oauth.WithUser(context.Background(), oauth.User{UserID: "drummer"}))
+	a.True(ok)
+	a.Equal("drummer", user.UserID)
+}
+
+func Test_MemoryTicketStore(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	store := oauth.NewMemoryTicketStore()
+	store.Clock = oauth.ClockFunc(func() time.Time { return now })
+
+	a.NoError(store.Save(ctx, "ticket-1", oauth.Ticket{User: oauth.User{UserID: "drummer"}, ExpiresAt: now.Add(time.Second)}))
+	a.NoError(store.Save(ctx, "ticket-2", oauth.Ticket{ExpiresAt: now.Add(time.Second)}))
+	ticket, err := store.Take(ctx, "ticket-1")
+	a.NoError(err)
+	a.Equal("drummer", ticket.User.UserID)
+	_, err = store.Take(ctx, "ticket-1")
+	a.Equal(oauth.ErrTicketNotFound, err)
+
+	now = now.Add(time.Second)
+	_, err = store.Take(ctx, "ticket-2")
+	a.Equal(oauth.ErrTicketNotFound, err)
+}